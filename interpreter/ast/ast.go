@@ -45,17 +45,33 @@ func (p *Program) TokenLiteral() string {
 
 var _ Statement = (*LetStatement)(nil)
 
+// LetStatement binds Value to Name or, for a destructuring let such as
+// `let [a, b] = pair;`, to the names of Pattern. Exactly one of Name and
+// Pattern is set.
 type LetStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Value Expression
+	Token   token.Token
+	Name    *Identifier
+	Pattern Pattern
+	Value   Expression
+}
+
+// Names returns the names the statement binds.
+func (l *LetStatement) Names() []string {
+	if l.Pattern != nil {
+		return PatternNames(l.Pattern)
+	}
+	return []string{l.Name.Value}
 }
 
 // String implements Statement.
 func (l *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(l.TokenLiteral() + " ")
-	out.WriteString(l.Name.String())
+	if l.Pattern != nil {
+		out.WriteString(l.Pattern.String())
+	} else {
+		out.WriteString(l.Name.String())
+	}
 	out.WriteString(" = ")
 	if l.Value != nil {
 		out.WriteString(l.Value.String())
@@ -74,6 +90,32 @@ func (l *LetStatement) statementNode() {
 	panic("unimplemented")
 }
 
+var _ Statement = (*FunctionStatement)(nil)
+
+// FunctionStatement declares a named function, as in `fn add(a, b) { a + b }`.
+// Declarations are hoisted: the name is bound before any statement of the
+// enclosing program or block runs.
+type FunctionStatement struct {
+	Token    token.Token
+	Name     *Identifier
+	Function *FunctionLiteral
+}
+
+// String implements Statement.
+func (f *FunctionStatement) String() string {
+	return f.TokenLiteral() + " " + f.Name.String() + strings.TrimPrefix(f.Function.String(), f.Function.TokenLiteral())
+}
+
+// TokenLiteral implements Statement.
+func (f *FunctionStatement) TokenLiteral() string {
+	return f.Token.Literal
+}
+
+// statementNode implements Statement.
+func (f *FunctionStatement) statementNode() {
+	panic("unimplemented")
+}
+
 var _ Expression = (*Identifier)(nil)
 
 type Identifier struct {
@@ -315,19 +357,35 @@ func (b *BlockStatement) statementNode() {
 
 var _ Expression = (*FunctionLiteral)(nil)
 
+// FunctionLiteral is a function such as `fn(a, b = 2, ...rest) { ... }`.
+// Defaults holds the default values of the last len(Defaults) parameters and
+// Rest, if not nil, collects the arguments passed after the parameters.
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	Defaults   []Expression
+	Rest       *Identifier
 	Body       *BlockStatement
+	// Name is the name of a function declaration or of the let binding a
+	// function literal is assigned to, and empty otherwise.
+	Name string
 }
 
 // String implements Expression.
 func (f *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range f.Parameters {
+	firstDefault := len(f.Parameters) - len(f.Defaults)
+	for i, p := range f.Parameters {
+		if i >= firstDefault {
+			params = append(params, p.String()+" = "+f.Defaults[i-firstDefault].String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
 	out.WriteString(f.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ","))
@@ -352,6 +410,9 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	// Tail is set by MarkTailCalls on calls whose result is returned by the
+	// enclosing function.
+	Tail bool
 }
 
 // String implements Expression.
@@ -489,3 +550,117 @@ func (h *HashLiteral) TokenLiteral() string {
 func (h *HashLiteral) expressionNode() {
 	panic("unimplemented")
 }
+
+var _ Expression = (*ImportExpression)(nil)
+
+type ImportExpression struct {
+	Token token.Token
+	Path  string
+}
+
+// String implements Expression.
+func (i *ImportExpression) String() string {
+	return i.TokenLiteral() + " \"" + i.Path + "\""
+}
+
+// TokenLiteral implements Expression.
+func (i *ImportExpression) TokenLiteral() string {
+	return i.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (i *ImportExpression) expressionNode() {
+	panic("unimplemented")
+}
+
+var _ Statement = (*ExportStatement)(nil)
+
+type ExportStatement struct {
+	Token     token.Token
+	Statement Statement
+}
+
+// Names returns the names of the bindings the statement exports.
+func (e *ExportStatement) Names() []string {
+	switch stmt := e.Statement.(type) {
+	case *LetStatement:
+		return stmt.Names()
+	case *FunctionStatement:
+		return []string{stmt.Name.Value}
+	}
+	return nil
+}
+
+// String implements Statement.
+func (e *ExportStatement) String() string {
+	return e.TokenLiteral() + " " + e.Statement.String()
+}
+
+// TokenLiteral implements Statement.
+func (e *ExportStatement) TokenLiteral() string {
+	return e.Token.Literal
+}
+
+// statementNode implements Statement.
+func (e *ExportStatement) statementNode() {
+	panic("unimplemented")
+}
+
+var _ Expression = (*MacroLiteral)(nil)
+
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+// String implements Expression.
+func (m *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(m.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ","))
+	out.WriteString(")")
+	out.WriteString(m.Body.String())
+	return out.String()
+}
+
+// TokenLiteral implements Expression.
+func (m *MacroLiteral) TokenLiteral() string {
+	return m.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (m *MacroLiteral) expressionNode() {
+	panic("unimplemented")
+}
+
+var _ Statement = (*BadStatement)(nil)
+
+// BadStatement stands for a statement that failed to parse, from its first
+// token to End, the position of the last token the parser skipped to
+// recover. It keeps the statements around it in place, so that tools can
+// still analyze them; a program with a BadStatement cannot run.
+type BadStatement struct {
+	Token token.Token
+	End   token.Position
+}
+
+// String implements Statement.
+func (b *BadStatement) String() string {
+	return "<bad statement>"
+}
+
+// TokenLiteral implements Statement.
+func (b *BadStatement) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// statementNode implements Statement.
+func (b *BadStatement) statementNode() {
+	panic("unimplemented")
+}
@@ -0,0 +1,42 @@
+package ast_test
+
+import (
+	"interpreter/ast"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	program := parseProgram(t, walkInput+"fn f(a, b = 1, ...c) { a }")
+	original := program.String()
+	copied := ast.Copy(program)
+	if copied.String() != original {
+		t.Fatalf("wrong copy.\nwant=%q\ngot= %q", original, copied.String())
+	}
+
+	nodes := map[ast.Node]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			nodes[node] = true
+		}
+		return true
+	})
+	ast.Inspect(copied, func(node ast.Node) bool {
+		if nodes[node] {
+			t.Errorf("node %T %q shared by the copy", node, node.String())
+		}
+		return true
+	})
+
+	ast.Modify(copied, func(node ast.Node) ast.Node {
+		if integer, ok := node.(*ast.IntegerLiteral); ok {
+			integer.Value, integer.Token.Literal = 7, "7"
+		}
+		return node
+	})
+	if program.String() != original {
+		t.Errorf("modifying the copy changed the original.\nwant=%q\ngot= %q", original, program.String())
+	}
+	if ast.Copy(nil) != nil {
+		t.Errorf("copy of nil is not nil")
+	}
+}
@@ -0,0 +1,163 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ModifierFunc is called by Modify with every node of a tree and returns the
+// node that replaces it.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites the tree rooted at node bottom-up: the children of a node
+// are replaced first, then the node itself is passed to modifier. The result
+// of modifier takes the place of the node in its parent. Children are visited
+// in the same order as by Walk and nil children are skipped.
+//
+// A statement of a Program or BlockStatement is removed when modifier returns
+// nil for it. Any other replacement must fit the field it is stored in, for
+// example an Expression for an operand or an *Identifier for a parameter;
+// Modify panics otherwise.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		node.Statements = modifyStatements(node.Statements, modifier)
+	case *LetStatement:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Pattern = modifyPattern(node.Pattern, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+	case *FunctionStatement:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		if node.Function != nil {
+			node.Function = mustBe[*FunctionLiteral](Modify(node.Function, modifier))
+		}
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+	case *ExpressionStatement:
+		node.Expression = modifyExpression(node.Expression, modifier)
+	case *BlockStatement:
+		node.Statements = modifyStatements(node.Statements, modifier)
+	case *ExportStatement:
+		if node.Statement != nil {
+			node.Statement = mustBe[Statement](Modify(node.Statement, modifier))
+		}
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+	case *InfixExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Right = modifyExpression(node.Right, modifier)
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Then = modifyBlock(node.Then, modifier)
+		node.Else = modifyBlock(node.Else, modifier)
+	case *FunctionLiteral:
+		firstDefault := len(node.Parameters) - len(node.Defaults)
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+			if i >= firstDefault {
+				node.Defaults[i-firstDefault] = modifyExpression(node.Defaults[i-firstDefault], modifier)
+			}
+		}
+		node.Rest = modifyIdentifier(node.Rest, modifier)
+		node.Body = modifyBlock(node.Body, modifier)
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(param, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+	case *CallExpression:
+		node.Function = modifyExpression(node.Function, modifier)
+		for i, arg := range node.Arguments {
+			node.Arguments[i] = modifyExpression(arg, modifier)
+		}
+	case *ArrayLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i] = modifyExpression(element, modifier)
+		}
+	case *IndexExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression, len(node.Pairs))
+		for _, key := range SortedKeys(node) {
+			value := node.Pairs[key]
+			pairs[modifyExpression(key, modifier)] = modifyExpression(value, modifier)
+		}
+		node.Pairs = pairs
+	case *MatchExpression:
+		node.Subject = modifyExpression(node.Subject, modifier)
+		for _, arm := range node.Arms {
+			arm.Pattern = modifyPattern(arm.Pattern, modifier)
+			arm.Guard = modifyExpression(arm.Guard, modifier)
+			arm.Body = modifyExpression(arm.Body, modifier)
+		}
+	case *BindingPattern:
+		node.Name = modifyIdentifier(node.Name, modifier)
+	case *LiteralPattern:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *DefaultPattern:
+		node.Pattern = modifyPattern(node.Pattern, modifier)
+		node.Default = modifyExpression(node.Default, modifier)
+	case *ArrayPattern:
+		for i, element := range node.Elements {
+			node.Elements[i] = modifyPattern(element, modifier)
+		}
+		node.Rest = modifyPattern(node.Rest, modifier)
+	case *HashPattern:
+		for i, key := range node.Keys {
+			node.Keys[i] = modifyExpression(key, modifier)
+			node.Values[i] = modifyPattern(node.Values[i], modifier)
+		}
+	}
+	return modifier(node)
+}
+
+func modifyStatements(list []Statement, modifier ModifierFunc) []Statement {
+	result := list[:0]
+	for _, stmt := range list {
+		if stmt == nil {
+			continue
+		}
+		if modified := Modify(stmt, modifier); modified != nil {
+			result = append(result, mustBe[Statement](modified))
+		}
+	}
+	return result
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	if exp == nil {
+		return nil
+	}
+	return mustBe[Expression](Modify(exp, modifier))
+}
+
+func modifyPattern(pattern Pattern, modifier ModifierFunc) Pattern {
+	if pattern == nil {
+		return nil
+	}
+	return mustBe[Pattern](Modify(pattern, modifier))
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return mustBe[*BlockStatement](Modify(block, modifier))
+}
+
+func modifyIdentifier(ident *Identifier, modifier ModifierFunc) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	return mustBe[*Identifier](Modify(ident, modifier))
+}
+
+func mustBe[T Node](node Node) T {
+	result, ok := node.(T)
+	if !ok {
+		want := reflect.TypeOf((*T)(nil)).Elem()
+		panic(fmt.Sprintf("ast.Modify: cannot replace %s with %T", want, node))
+	}
+	return result
+}
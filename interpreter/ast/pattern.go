@@ -0,0 +1,275 @@
+package ast
+
+import (
+	"bytes"
+	"interpreter/token"
+	"strings"
+)
+
+// Pattern describes the shape of a value in a match arm. Matching a value
+// against a pattern can bind names to parts of the value.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+var _ Pattern = (*WildcardPattern)(nil)
+
+// WildcardPattern `_` matches any value without binding it.
+type WildcardPattern struct {
+	Token token.Token
+}
+
+// String implements Pattern.
+func (w *WildcardPattern) String() string {
+	return "_"
+}
+
+// TokenLiteral implements Pattern.
+func (w *WildcardPattern) TokenLiteral() string {
+	return w.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (w *WildcardPattern) patternNode() {
+	panic("unimplemented")
+}
+
+var _ Pattern = (*BindingPattern)(nil)
+
+// BindingPattern matches any value and binds it to Name.
+type BindingPattern struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+// String implements Pattern.
+func (b *BindingPattern) String() string {
+	return b.Name.String()
+}
+
+// TokenLiteral implements Pattern.
+func (b *BindingPattern) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (b *BindingPattern) patternNode() {
+	panic("unimplemented")
+}
+
+var _ Pattern = (*LiteralPattern)(nil)
+
+// LiteralPattern matches values of the same type that are equal to the
+// integer, string or boolean literal Value.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+// String implements Pattern.
+func (l *LiteralPattern) String() string {
+	return l.Value.String()
+}
+
+// TokenLiteral implements Pattern.
+func (l *LiteralPattern) TokenLiteral() string {
+	return l.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (l *LiteralPattern) patternNode() {
+	panic("unimplemented")
+}
+
+var _ Pattern = (*ArrayPattern)(nil)
+
+// ArrayPattern matches arrays whose elements match Elements. Without a Rest
+// pattern the array must have exactly len(Elements) elements; with one it
+// may have more, and the array of the remaining elements is matched against
+// Rest.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Pattern
+	Rest     Pattern
+}
+
+// MinLength returns the number of elements an array needs at least to match:
+// every element up to the last one without a default must be present.
+func (a *ArrayPattern) MinLength() int {
+	for i := len(a.Elements) - 1; i >= 0; i-- {
+		if _, ok := a.Elements[i].(*DefaultPattern); !ok {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// String implements Pattern.
+func (a *ArrayPattern) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.String())
+	}
+	if a.Rest != nil {
+		elements = append(elements, "..."+a.Rest.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// TokenLiteral implements Pattern.
+func (a *ArrayPattern) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (a *ArrayPattern) patternNode() {
+	panic("unimplemented")
+}
+
+var _ Pattern = (*HashPattern)(nil)
+
+// HashPattern matches hashes that have every key of Keys, the value of
+// Keys[i] matching Values[i]. Other keys of the hash are ignored.
+type HashPattern struct {
+	Token  token.Token
+	Keys   []Expression
+	Values []Pattern
+}
+
+// String implements Pattern.
+func (h *HashPattern) String() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for i, key := range h.Keys {
+		if isShorthand(key, h.Values[i]) {
+			pairs = append(pairs, h.Values[i].String())
+			continue
+		}
+		pairs = append(pairs, key.String()+":"+h.Values[i].String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// isShorthand reports whether key and value were written as `name` or
+// `name = default`, short for `"name": name`.
+func isShorthand(key Expression, value Pattern) bool {
+	if def, ok := value.(*DefaultPattern); ok {
+		value = def.Pattern
+	}
+	str, ok := key.(*StringLiteral)
+	binding, isBinding := value.(*BindingPattern)
+	return ok && isBinding && str.Token.Type == token.IDENT && str.Value == binding.Name.Value
+}
+
+// TokenLiteral implements Pattern.
+func (h *HashPattern) TokenLiteral() string {
+	return h.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (h *HashPattern) patternNode() {
+	panic("unimplemented")
+}
+
+var _ Pattern = (*DefaultPattern)(nil)
+
+// DefaultPattern is an element of an ArrayPattern or a value of a
+// HashPattern that may be missing. A missing element or key is matched as
+// if it held the value of Default.
+type DefaultPattern struct {
+	Token   token.Token
+	Pattern Pattern
+	Default Expression
+}
+
+// String implements Pattern.
+func (d *DefaultPattern) String() string {
+	return d.Pattern.String() + " = " + d.Default.String()
+}
+
+// TokenLiteral implements Pattern.
+func (d *DefaultPattern) TokenLiteral() string {
+	return d.Token.Literal
+}
+
+// patternNode implements Pattern.
+func (d *DefaultPattern) patternNode() {
+	panic("unimplemented")
+}
+
+// PatternNames returns the names bound by pattern in the order they appear.
+func PatternNames(pattern Pattern) []string {
+	names := []string{}
+	Inspect(pattern, func(node Node) bool {
+		if binding, ok := node.(*BindingPattern); ok {
+			names = append(names, binding.Name.Value)
+		}
+		// defaults are expressions and bind nothing
+		_, isExpression := node.(Expression)
+		return !isExpression
+	})
+	return names
+}
+
+// MatchArm is a single `pattern if guard => body` of a match expression.
+// Guard is nil if the arm has none.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    Expression
+}
+
+func (m *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(m.Pattern.String())
+	if m.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(m.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(m.Body.String())
+	return out.String()
+}
+
+var _ Expression = (*MatchExpression)(nil)
+
+// MatchExpression evaluates to the body of the first arm whose pattern
+// matches Subject and whose guard is truthy, or to null if there is none.
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// String implements Expression.
+func (m *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+	for _, arm := range m.Arms {
+		arms = append(arms, arm.String())
+	}
+	out.WriteString("match")
+	out.WriteString(m.Subject.String())
+	out.WriteString(" {")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// TokenLiteral implements Expression.
+func (m *MatchExpression) TokenLiteral() string {
+	return m.Token.Literal
+}
+
+// expressionNode implements Expression.
+func (m *MatchExpression) expressionNode() {
+	panic("unimplemented")
+}
@@ -0,0 +1,44 @@
+package ast
+
+// MarkTailCalls sets Tail on the calls in tail position in the body of fn:
+// the value of a return statement and the last expression of the body,
+// including the branches of if and match expressions in tail position. The
+// bodies of nested function literals are left alone.
+func MarkTailCalls(fn *FunctionLiteral) {
+	if fn.Body == nil {
+		return
+	}
+	markTailBlock(fn.Body)
+	Inspect(fn.Body, func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral, *MacroLiteral:
+			return false
+		case *ReturnStatement:
+			markTailExpression(node.ReturnValue)
+		}
+		return true
+	})
+}
+
+func markTailBlock(block *BlockStatement) {
+	if block == nil || len(block.Statements) == 0 {
+		return
+	}
+	if stmt, ok := block.Statements[len(block.Statements)-1].(*ExpressionStatement); ok {
+		markTailExpression(stmt.Expression)
+	}
+}
+
+func markTailExpression(expr Expression) {
+	switch expr := expr.(type) {
+	case *CallExpression:
+		expr.Tail = true
+	case *IfExpression:
+		markTailBlock(expr.Then)
+		markTailBlock(expr.Else)
+	case *MatchExpression:
+		for _, arm := range expr.Arms {
+			markTailExpression(arm.Body)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package ast_test
+
+import (
+	"fmt"
+	"testing"
+
+	"interpreter/ast"
+)
+
+func TestMarkTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`fn() { f(1) }`, []string{"f(1)"}},
+		{`fn() { f(1); g(2) }`, []string{"g(2)"}},
+		{`fn() { 1 + f(1) }`, []string{}},
+		{`fn() { if (x) { return f(1); } g(h(2)) }`, []string{"f(1)", "g(h(2))"}},
+		{`fn() { if (x) { f(1) } else { g(2) } }`, []string{"f(1)", "g(2)"}},
+		{`fn() { if (x) { f(1) }; 2 }`, []string{}},
+		{`fn() { match (x) { 1 => f(1), _ if g(2) => h(3) } }`, []string{"f(1)", "h(3)"}},
+		{`fn() { fn() { f(1) }; g(2) }`, []string{"f(1)", "g(2)"}},
+		{`f(1)`, []string{}},
+	}
+	for _, tt := range tests {
+		program := parseProgram(t, tt.input)
+		tail := []string{}
+		ast.Inspect(program, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpression); ok && call.Tail {
+				tail = append(tail, call.String())
+			}
+			return true
+		})
+		if fmt.Sprint(tail) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong tail calls for %q. want=%v, got=%v", tt.input, tt.expected, tail)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package ast
+
+import "sort"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node in depth-first order. It starts by
+// calling v.Visit(node); node must not be nil. If the visitor returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with it for each of
+// the non-nil children of node, followed by a call of w.Visit(nil).
+//
+// Children are visited in source order. The pairs of a HashLiteral are kept
+// in a map, so they are visited sorted by the String of their keys, each key
+// followed by its value.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		walkIdentifier(v, n.Name)
+		walkPattern(v, n.Pattern)
+		walkExpression(v, n.Value)
+	case *FunctionStatement:
+		walkIdentifier(v, n.Name)
+		if n.Function != nil {
+			Walk(v, n.Function)
+		}
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *ExportStatement:
+		if n.Statement != nil {
+			Walk(v, n.Statement)
+		}
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		if n.Then != nil {
+			Walk(v, n.Then)
+		}
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+	case *FunctionLiteral:
+		// each default value follows its parameter
+		firstDefault := len(n.Parameters) - len(n.Defaults)
+		for i, param := range n.Parameters {
+			walkIdentifier(v, param)
+			if i >= firstDefault {
+				walkExpression(v, n.Defaults[i-firstDefault])
+			}
+		}
+		walkIdentifier(v, n.Rest)
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			walkIdentifier(v, param)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *HashLiteral:
+		for _, key := range SortedKeys(n) {
+			walkExpression(v, key)
+			walkExpression(v, n.Pairs[key])
+		}
+	case *MatchExpression:
+		walkExpression(v, n.Subject)
+		for _, arm := range n.Arms {
+			walkPattern(v, arm.Pattern)
+			walkExpression(v, arm.Guard)
+			walkExpression(v, arm.Body)
+		}
+	case *BindingPattern:
+		walkIdentifier(v, n.Name)
+	case *LiteralPattern:
+		walkExpression(v, n.Value)
+	case *DefaultPattern:
+		walkPattern(v, n.Pattern)
+		walkExpression(v, n.Default)
+	case *ArrayPattern:
+		for _, element := range n.Elements {
+			walkPattern(v, element)
+		}
+		walkPattern(v, n.Rest)
+	case *HashPattern:
+		for i, key := range n.Keys {
+			walkExpression(v, key)
+			walkPattern(v, n.Values[i])
+		}
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *ImportExpression, *WildcardPattern, *BadStatement:
+		// leaves
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, stmt := range list {
+		if stmt != nil {
+			Walk(v, stmt)
+		}
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, exp := range list {
+		walkExpression(v, exp)
+	}
+}
+
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+func walkPattern(v Visitor, pattern Pattern) {
+	if pattern != nil {
+		Walk(v, pattern)
+	}
+}
+
+func walkIdentifier(v Visitor, ident *Identifier) {
+	if ident != nil {
+		Walk(v, ident)
+	}
+}
+
+// SortedKeys returns the keys of hash sorted by their String, the order in
+// which Walk and Modify traverse the pairs.
+func SortedKeys(hash *HashLiteral) []Expression {
+	keys := make([]Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ki, kj := keys[i].String(), keys[j].String()
+		if ki != kj {
+			return ki < kj
+		}
+		return hash.Pairs[keys[i]].String() < hash.Pairs[keys[j]].String()
+	})
+	return keys
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in depth-first order. It starts
+// by calling f(node); node must not be nil. If f returns true, Inspect invokes
+// f recursively for each of the non-nil children of node, followed by a call
+// of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
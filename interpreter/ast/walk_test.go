@@ -0,0 +1,180 @@
+package ast_test
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+const walkInput = `
+let add = fn(a, b = 1, c = 2) { return a + b; };
+export let m = macro(x) { x };
+if (!true) { add(1, 2) } else { [3, "four"][0] };
+{"k": 5};
+import "lib";
+match (x) { [1, ...r] if r => -2, {"a": _, b} => "s" };
+`
+
+func TestInspect(t *testing.T) {
+	program := parseProgram(t, walkInput)
+
+	var visited []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			visited = append(visited, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+		}
+		return true
+	})
+
+	expected := []string{
+		"Program",
+		"LetStatement", "Identifier", "FunctionLiteral", "Identifier",
+		"Identifier", "IntegerLiteral", "Identifier", "IntegerLiteral",
+		"BlockStatement", "ReturnStatement", "InfixExpression", "Identifier", "Identifier",
+		"ExportStatement", "LetStatement", "Identifier", "MacroLiteral", "Identifier",
+		"BlockStatement", "ExpressionStatement", "Identifier",
+		"ExpressionStatement", "IfExpression", "PrefixExpression", "Boolean",
+		"BlockStatement", "ExpressionStatement", "CallExpression", "Identifier", "IntegerLiteral", "IntegerLiteral",
+		"BlockStatement", "ExpressionStatement", "IndexExpression", "ArrayLiteral", "IntegerLiteral", "StringLiteral", "IntegerLiteral",
+		"ExpressionStatement", "HashLiteral", "StringLiteral", "IntegerLiteral",
+		"ExpressionStatement", "ImportExpression",
+		"ExpressionStatement", "MatchExpression", "Identifier",
+		"ArrayPattern", "LiteralPattern", "IntegerLiteral", "BindingPattern", "Identifier",
+		"Identifier", "PrefixExpression", "IntegerLiteral",
+		"HashPattern", "StringLiteral", "WildcardPattern", "StringLiteral", "BindingPattern", "Identifier",
+		"StringLiteral",
+	}
+	if strings.Join(visited, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong traversal.\nwant=%v\ngot =%v", expected, visited)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	program := parseProgram(t, `let f = fn(x) { x + 1 }; f(2) + 3`)
+
+	var integers []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if integer, ok := node.(*ast.IntegerLiteral); ok {
+			integers = append(integers, integer.String())
+		}
+		return true
+	})
+	if strings.Join(integers, ",") != "2,3" {
+		t.Errorf("wrong integers visited. got=%v", integers)
+	}
+}
+
+type depthVisitor struct {
+	depth    int
+	maxDepth *int
+	ends     *int
+}
+
+func (v depthVisitor) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*v.ends++
+		return nil
+	}
+	if v.depth > *v.maxDepth {
+		*v.maxDepth = v.depth
+	}
+	return depthVisitor{depth: v.depth + 1, maxDepth: v.maxDepth, ends: v.ends}
+}
+
+func TestWalk(t *testing.T) {
+	program := parseProgram(t, `-(1 + 2)`)
+
+	maxDepth, ends := 0, 0
+	ast.Walk(depthVisitor{maxDepth: &maxDepth, ends: &ends}, program)
+
+	// Program > ExpressionStatement > PrefixExpression > InfixExpression > IntegerLiteral
+	if maxDepth != 4 {
+		t.Errorf("wrong depth. want=4, got=%d", maxDepth)
+	}
+	if ends != 6 {
+		t.Errorf("wrong number of Visit(nil) calls. want=6, got=%d", ends)
+	}
+}
+
+func TestModifyCoversEveryNode(t *testing.T) {
+	program := parseProgram(t, walkInput)
+
+	renamed := ast.Modify(program, func(node ast.Node) ast.Node {
+		if ident, ok := node.(*ast.Identifier); ok {
+			return &ast.Identifier{Token: ident.Token, Value: "_" + ident.Value}
+		}
+		if str, ok := node.(*ast.StringLiteral); ok {
+			return &ast.StringLiteral{Token: str.Token, Value: strings.ToUpper(str.Value)}
+		}
+		return node
+	})
+
+	ast.Inspect(renamed, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if !strings.HasPrefix(node.Value, "_") {
+				t.Errorf("identifier %s was not rewritten", node.Value)
+			}
+		case *ast.StringLiteral:
+			if node.Value != strings.ToUpper(node.Value) {
+				t.Errorf("string %q was not rewritten", node.Value)
+			}
+		}
+		return true
+	})
+}
+
+func TestModifyRemovesStatements(t *testing.T) {
+	program := parseProgram(t, `1; let x = 2; fn() { 3; return 4; 5 }`)
+
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if stmt, ok := node.(*ast.ExpressionStatement); ok {
+			if _, ok := stmt.Expression.(*ast.IntegerLiteral); ok {
+				return nil
+			}
+		}
+		return node
+	})
+
+	expected := "let x = 2;fn(){\nreturn 4;\n}"
+	if program.String() != expected {
+		t.Errorf("wrong program. want=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestModifyPanicsOnMismatchedReplacement(t *testing.T) {
+	program := parseProgram(t, `fn(x) { x }`)
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatalf("expected panic")
+		}
+		expected := "ast.Modify: cannot replace *ast.Identifier with *ast.IntegerLiteral"
+		if r != expected {
+			t.Errorf("wrong panic. want=%q, got=%q", expected, r)
+		}
+	}()
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		if _, ok := node.(*ast.Identifier); ok {
+			return &ast.IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+}
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,357 @@
+// Package diagnostic describes the problems found in Monkey programs, such
+// as syntax errors and the errors of failing programs, for both people and
+// tools. A Diagnostic has a severity, a code naming its kind, the span of
+// source it is about, secondary spans pointing at related source and notes.
+// Render writes it compiler-style with the source lines it points at:
+//
+//	error[syntax]: unexpected end of input, expected RBRACE
+//	 --> main.mk:3:1
+//	  |
+//	1 | if (x) {
+//	  |        - unclosed brace
+//	...
+//	3 |
+//	  | ^
+//
+// and WriteJSON encodes the same data as JSON for editors.
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interpreter/token"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The codes of the diagnostics of the parser and the engines.
+const (
+	Syntax  = "syntax"  // errors of the parser
+	Compile = "compile" // errors of the compiler
+	Runtime = "runtime" // errors of running programs on either engine
+)
+
+// Severity is how serious a Diagnostic is.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+var severities = []string{Error: "error", Warning: "warning", Note: "note"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severities) {
+		return "Severity(" + strconv.Itoa(int(s)) + ")"
+	}
+	return severities[s]
+}
+
+// MarshalText encodes s as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(severities) {
+		return nil, fmt.Errorf("invalid severity %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes the name of a severity.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severities {
+		if name == string(text) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Span is the source from Start up to End. A zero End stands for the single
+// character at Start, and a zero Start for an unknown position.
+type Span struct {
+	Start token.Position `json:"start"`
+	End   token.Position `json:"end"`
+	Label string         `json:"label,omitempty"` // what the span shows, if anything
+}
+
+// MarshalJSON encodes s, leaving out a zero End.
+func (s Span) MarshalJSON() ([]byte, error) {
+	var end *token.Position
+	if s.End != (token.Position{}) {
+		end = &s.End
+	}
+	return json.Marshal(struct {
+		Start token.Position  `json:"start"`
+		End   *token.Position `json:"end,omitempty"`
+		Label string          `json:"label,omitempty"`
+	}{s.Start, end, s.Label})
+}
+
+// At returns the span of the character at pos.
+func At(pos token.Position) Span {
+	return Span{Start: pos}
+}
+
+// TokenSpan returns the span of tok.
+func TokenSpan(tok token.Token) Span {
+	n := len(tok.Literal)
+	if tok.Type == token.STRING {
+		n += 2 // the quotes
+	}
+	if n == 0 || strings.Contains(tok.Literal, "\n") {
+		return At(tok.Pos)
+	}
+	end := tok.Pos
+	end.Offset += n
+	end.Column += n
+	return Span{Start: tok.Pos, End: end}
+}
+
+// IsValid reports whether the position of s is known.
+func (s Span) IsValid() bool {
+	return s.Start.Line > 0
+}
+
+// Diagnostic is a problem found in a program. It is an error whose message
+// is Message, so that code printing errors keeps working with diagnostics.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message"`
+	// File is the path of the source file the spans are in, or "".
+	File string `json:"file,omitempty"`
+	// Primary is the span the diagnostic is about, invalid if unknown.
+	Primary   Span     `json:"primary"`
+	Secondary []Span   `json:"secondary,omitempty"`
+	Notes     []string `json:"notes,omitempty"`
+	// Err is the Go error the diagnostic was made from, or nil.
+	Err error `json:"-"`
+}
+
+// Errorf returns an error diagnostic with code about span.
+func Errorf(code string, span Span, format string, a ...any) *Diagnostic {
+	return &Diagnostic{Severity: Error, Code: code, Message: fmt.Sprintf(format, a...), Primary: span}
+}
+
+func (d *Diagnostic) Error() string {
+	return d.Message
+}
+
+func (d *Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+// String formats d on one line, as "file:line:column: severity[code]:
+// message".
+func (d *Diagnostic) String() string {
+	var out strings.Builder
+	if loc := d.location(); loc != "" {
+		out.WriteString(loc + ": ")
+	}
+	out.WriteString(d.title() + ": " + d.Message)
+	return out.String()
+}
+
+func (d *Diagnostic) title() string {
+	if d.Code == "" {
+		return d.Severity.String()
+	}
+	return d.Severity.String() + "[" + d.Code + "]"
+}
+
+// location returns where d is, as precisely as it is known.
+func (d *Diagnostic) location() string {
+	switch {
+	case !d.Primary.IsValid():
+		return d.File
+	case d.File == "":
+		return d.Primary.Start.String()
+	default:
+		return d.File + ":" + d.Primary.Start.String()
+	}
+}
+
+// List is a list of diagnostics reported together, such as the syntax errors
+// of a file. Its message joins the messages of the diagnostics.
+type List []*Diagnostic
+
+func (l List) Error() string {
+	msgs := make([]string, len(l))
+	for i, d := range l {
+		msgs[i] = d.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// FromError returns the diagnostics err carries: the List or Diagnostic in
+// its chain or, for other errors, a Diagnostic with the message of err and
+// no position.
+func FromError(err error) List {
+	var list List
+	if errors.As(err, &list) {
+		return list
+	}
+	var d *Diagnostic
+	if errors.As(err, &d) {
+		return List{d}
+	}
+	return List{{Severity: Error, Message: err.Error(), Err: err}}
+}
+
+// WriteJSON writes diags to w as a JSON array.
+func WriteJSON(w io.Writer, diags List) error {
+	if diags == nil {
+		diags = List{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diags)
+}
+
+// RenderOption is an option of Render.
+type RenderOption func(*renderer)
+
+// WithColor highlights the output with ANSI escape sequences.
+func WithColor() RenderOption {
+	return func(r *renderer) {
+		r.color = true
+	}
+}
+
+// The ANSI escape sequences of the colors used by Render.
+var (
+	severityColors = []string{Error: "1;31", Warning: "1;33", Note: "1;36"}
+	bold           = "1"
+	blue           = "1;34"
+)
+
+func (s Severity) color() string {
+	if s < 0 || int(s) >= len(severityColors) {
+		return ""
+	}
+	return severityColors[s]
+}
+
+type renderer struct {
+	out   strings.Builder
+	color bool
+}
+
+func (r *renderer) paint(color, s string) string {
+	if !r.color || color == "" {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+// Render writes d to w followed by the lines of src its spans are in,
+// underlining the primary span with carets and the secondary spans with
+// dashes. src is the content of d.File; without it only the location of d
+// is written.
+func (d *Diagnostic) Render(w io.Writer, src string, opts ...RenderOption) error {
+	r := &renderer{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.out.WriteString(r.paint(d.Severity.color(), d.title()) + r.paint(bold, ": "+d.Message) + "\n")
+
+	type mark struct {
+		span    Span
+		primary bool
+	}
+	var marks []mark
+	if d.Primary.IsValid() {
+		marks = append(marks, mark{d.Primary, true})
+	}
+	for _, span := range d.Secondary {
+		if span.IsValid() {
+			marks = append(marks, mark{span, false})
+		}
+	}
+	sort.SliceStable(marks, func(i, j int) bool {
+		a, b := marks[i].span.Start, marks[j].span.Start
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	width := 1
+	for _, m := range marks {
+		width = max(width, len(strconv.Itoa(m.span.Start.Line)))
+	}
+	gutter := strings.Repeat(" ", width)
+	if loc := d.location(); loc != "" {
+		r.out.WriteString(gutter + r.paint(blue, "--> ") + loc + "\n")
+	}
+
+	lines := strings.Split(src, "\n")
+	if src == "" {
+		marks = nil
+	}
+	previous := 0
+	for _, m := range marks {
+		line := m.span.Start.Line
+		if line > len(lines) {
+			continue
+		}
+		if previous == 0 {
+			r.out.WriteString(gutter + r.paint(blue, " |") + "\n")
+		}
+		if line != previous {
+			if previous != 0 && line > previous+1 {
+				r.out.WriteString(r.paint(blue, "...") + "\n")
+			}
+			number := r.paint(blue, fmt.Sprintf("%*d |", width, line))
+			if text := strings.TrimSuffix(lines[line-1], "\r"); text != "" {
+				number += " " + text
+			}
+			r.out.WriteString(number + "\n")
+			previous = line
+		}
+		underline, color := "-", blue
+		if m.primary {
+			underline, color = "^", d.Severity.color()
+		}
+		pad, n := underlined(strings.TrimSuffix(lines[line-1], "\r"), m.span)
+		text := strings.Repeat(underline, n)
+		if m.span.Label != "" {
+			text += " " + m.span.Label
+		}
+		r.out.WriteString(gutter + r.paint(blue, " |") + " " + pad + r.paint(color, text) + "\n")
+	}
+	for _, note := range d.Notes {
+		r.out.WriteString(gutter + r.paint(blue, " =") + r.paint(bold, " note") + ": " + note + "\n")
+	}
+	_, err := io.WriteString(w, r.out.String())
+	return err
+}
+
+// underlined returns the indentation putting an underline below span in
+// line, and the width of the underline in characters.
+func underlined(line string, span Span) (pad string, n int) {
+	start := min(span.Start.Column-1, len(line))
+	end := start + 1
+	switch {
+	case span.End.Line == span.Start.Line && span.End.Column > span.Start.Column:
+		end = span.End.Column - 1
+	case span.End.Line > span.Start.Line:
+		end = len(line)
+	}
+	var indent strings.Builder
+	for _, ch := range line[:start] {
+		// tabs are kept so that the underline lines up with the source
+		if ch == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	n = 1
+	if end <= len(line) && end > start {
+		n = utf8.RuneCountInString(line[start:end])
+	}
+	return indent.String(), n
+}
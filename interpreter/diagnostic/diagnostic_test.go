@@ -0,0 +1,215 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interpreter/token"
+	"strings"
+	"testing"
+)
+
+func pos(offset, line, column int) token.Position {
+	return token.Position{Offset: offset, Line: line, Column: column}
+}
+
+func TestRender(t *testing.T) {
+	src := "let x = 1;\nif (x) {\n\tputs(x + true)\n"
+	tests := []struct {
+		diagnostic *Diagnostic
+		src        string
+		expected   string
+	}{
+		{
+			&Diagnostic{Severity: Error, Code: Runtime, Message: "type mismatch: INTEGER + BOOLEAN", File: "main.mk",
+				Primary: Span{Start: pos(27, 3, 9), End: pos(28, 3, 10)}, Notes: []string{"in f, called at 4:1"}},
+			src,
+			"error[runtime]: type mismatch: INTEGER + BOOLEAN\n" +
+				" --> main.mk:3:9\n" +
+				"  |\n" +
+				"3 | \tputs(x + true)\n" +
+				"  | \t       ^\n" +
+				"  = note: in f, called at 4:1\n",
+		},
+		{
+			&Diagnostic{Severity: Error, Code: Syntax, Message: "unexpected end of input, expected RBRACE",
+				Primary:   At(pos(36, 4, 1)),
+				Secondary: []Span{{Start: pos(18, 2, 8), Label: "unclosed brace"}}},
+			src,
+			"error[syntax]: unexpected end of input, expected RBRACE\n" +
+				" --> 4:1\n" +
+				"  |\n" +
+				"2 | if (x) {\n" +
+				"  |        - unclosed brace\n" +
+				"...\n" +
+				"4 |\n" +
+				"  | ^\n",
+		},
+		{
+			&Diagnostic{Severity: Warning, Message: "x is never used",
+				Primary: Span{Start: pos(4, 1, 5), End: pos(5, 1, 6), Label: "bound here"}},
+			src,
+			"warning: x is never used\n" +
+				" --> 1:5\n" +
+				"  |\n" +
+				"1 | let x = 1;\n" +
+				"  |     ^ bound here\n",
+		},
+		{
+			&Diagnostic{Severity: Error, Code: Syntax, Message: "unknown token", Primary: Span{Start: pos(4, 1, 5), End: pos(9, 1, 10)}},
+			src,
+			"error[syntax]: unknown token\n" +
+				" --> 1:5\n" +
+				"  |\n" +
+				"1 | let x = 1;\n" +
+				"  |     ^^^^^\n",
+		},
+		// without the source or a position only the location is written
+		{
+			&Diagnostic{Severity: Error, Code: Runtime, Message: "division by zero", File: "main.mk", Primary: At(pos(8, 1, 9))},
+			"",
+			"error[runtime]: division by zero\n" +
+				" --> main.mk:1:9\n",
+		},
+		{
+			&Diagnostic{Severity: Error, Code: Runtime, Message: "stack overflow", Notes: []string{"in loop"}},
+			src,
+			"error[runtime]: stack overflow\n" +
+				"  = note: in loop\n",
+		},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := tt.diagnostic.Render(&out, tt.src); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong rendering of %q.\nwant:\n%s\ngot:\n%s", tt.diagnostic.Message, tt.expected, out.String())
+		}
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	d := &Diagnostic{Severity: Error, Message: "boom", Primary: At(pos(0, 1, 1))}
+	var out strings.Builder
+	d.Render(&out, "x", WithColor())
+	expected := "\x1b[1;31merror\x1b[0m\x1b[1m: boom\x1b[0m\n" +
+		" \x1b[1;34m--> \x1b[0m1:1\n" +
+		" \x1b[1;34m |\x1b[0m\n" +
+		"\x1b[1;34m1 |\x1b[0m x\n" +
+		" \x1b[1;34m |\x1b[0m \x1b[1;31m^\x1b[0m\n"
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+func TestTokenSpan(t *testing.T) {
+	tests := []struct {
+		tok      token.Token
+		expected Span
+	}{
+		{token.Token{Type: token.IDENT, Literal: "foo", Pos: pos(4, 1, 5)}, Span{Start: pos(4, 1, 5), End: pos(7, 1, 8)}},
+		{token.Token{Type: token.STRING, Literal: "ab", Pos: pos(0, 1, 1)}, Span{Start: pos(0, 1, 1), End: pos(4, 1, 5)}},
+		{token.Token{Type: token.EOF, Literal: "", Pos: pos(9, 2, 1)}, Span{Start: pos(9, 2, 1)}},
+	}
+	for _, tt := range tests {
+		if got := TokenSpan(tt.tok); got != tt.expected {
+			t.Errorf("wrong span of %v. want=%+v, got=%+v", tt.tok, tt.expected, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		diagnostic *Diagnostic
+		expected   string
+	}{
+		{Errorf(Syntax, At(pos(0, 2, 3)), "bad %s", "token"), "2:3: error[syntax]: bad token"},
+		{&Diagnostic{Severity: Note, Message: "hi", File: "a.mk"}, "a.mk: note: hi"},
+		{&Diagnostic{Severity: Warning, Message: "hi", File: "a.mk", Primary: At(pos(0, 1, 1))}, "a.mk:1:1: warning: hi"},
+	}
+	for _, tt := range tests {
+		if got := tt.diagnostic.String(); got != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestFromError(t *testing.T) {
+	cause := errors.New("step limit exceeded")
+	d := Errorf(Runtime, Span{}, "%s", cause)
+	d.Err = cause
+	list := List{Errorf(Syntax, At(pos(0, 1, 1)), "a"), Errorf(Syntax, At(pos(2, 1, 3)), "b")}
+	tests := []struct {
+		err      error
+		expected List
+	}{
+		{fmt.Errorf("parse errors: %w", list), list},
+		{fmt.Errorf("in module: %w", d), List{d}},
+	}
+	for _, tt := range tests {
+		got := FromError(tt.err)
+		if len(got) != len(tt.expected) {
+			t.Fatalf("wrong number of diagnostics. want=%d, got=%d", len(tt.expected), len(got))
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("wrong diagnostic %d. want=%v, got=%v", i, tt.expected[i], got[i])
+			}
+		}
+	}
+	if !errors.Is(FromError(fmt.Errorf("x: %w", d))[0], cause) {
+		t.Errorf("diagnostic does not wrap its cause")
+	}
+	if err := fmt.Errorf("parse errors: %w", list); err.Error() != "parse errors: a; b" {
+		t.Errorf("wrong message of list: %q", err.Error())
+	}
+	got := FromError(cause)
+	if len(got) != 1 || got[0].Message != cause.Error() || got[0].Primary.IsValid() || got[0].Err != cause {
+		t.Errorf("wrong diagnostic of a plain error: %+v", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	diags := List{
+		{Severity: Error, Code: Syntax, Message: "bad", File: "a.mk",
+			Primary:   Span{Start: pos(4, 1, 5), End: pos(7, 1, 8)},
+			Secondary: []Span{{Start: pos(0, 1, 1), Label: "here"}},
+			Notes:     []string{"a note"}},
+		{Severity: Warning, Message: "unused"},
+	}
+	var out bytes.Buffer
+	if err := WriteJSON(&out, diags); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded[0]["severity"] != "error" || decoded[1]["severity"] != "warning" {
+		t.Errorf("wrong severities: %v", decoded)
+	}
+	secondary := decoded[0]["secondary"].([]any)[0].(map[string]any)
+	if _, ok := secondary["end"]; ok {
+		t.Errorf("zero end encoded: %v", secondary)
+	}
+	if _, ok := decoded[0]["primary"].(map[string]any)["end"]; !ok {
+		t.Errorf("end not encoded: %v", decoded[0]["primary"])
+	}
+	var roundTrip List
+	if err := json.Unmarshal(out.Bytes(), &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+	for i := range diags {
+		if roundTrip[i].String() != diags[i].String() || roundTrip[i].Primary != diags[i].Primary ||
+			fmt.Sprint(roundTrip[i].Secondary) != fmt.Sprint(diags[i].Secondary) {
+			t.Errorf("wrong round trip. want=%+v, got=%+v", diags[i], roundTrip[i])
+		}
+	}
+	out.Reset()
+	WriteJSON(&out, nil)
+	if out.String() != "[]\n" {
+		t.Errorf("wrong encoding of no diagnostics: %q", out.String())
+	}
+}
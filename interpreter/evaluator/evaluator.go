@@ -3,18 +3,28 @@ package evaluator
 import (
 	"fmt"
 	"interpreter/ast"
+	"interpreter/module"
 	"interpreter/object"
+	"interpreter/prelude"
+	"interpreter/token"
+	"sort"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Meter().Step(); err != nil {
+		return limitError(err)
+	}
 	switch node := node.(type) {
 	case *ast.Program:
+		if err := loadPrelude(env); err != nil {
+			return err
+		}
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
@@ -23,7 +33,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return locate(allocate(env, evalPrefixExpression(node.Operator, right)), node.Token.Pos, env)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -33,11 +43,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return locate(allocate(env, evalInfixExpression(node.Operator, left, right)), node.Token.Pos, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 	case *ast.StringLiteral:
-		return &object.StringObject{Value: node.Value}
+		return allocate(env, &object.StringObject{Value: node.Value})
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.BlockStatement:
@@ -51,18 +61,37 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnObject{Value: val}
 	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return locate(evalDestructuringLet(node, env), node.Token.Pos, env)
+		}
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return locate(evalIdentifier(node, env), node.Token.Pos, env)
+	case *ast.FunctionStatement:
+		// bound by hoistFunctions before the enclosing statements run, and
+		// like a function without a value when it ends a block
+		return NULL
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.FunctionObject{Parameters: params, Env: env, Body: body}
+		return &object.FunctionObject{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Env:        env,
+			Body:       node.Body,
+			Pos:        node.Token.Pos,
+			Name:       node.Name,
+		}
 	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return locate(newError("wrong number of arguments. got=%d, want=1", len(node.Arguments)), node.Token.Pos, env)
+			}
+			return quote(node.Arguments[0], env)
+		}
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
@@ -71,13 +100,21 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		frame := object.StackFrame{Function: functionName(node.Function, function), CallSite: node.Token.Pos}
+		if node.Tail {
+			return &object.TailCall{Function: function, Arguments: args, Frame: frame}
+		}
+		result := locate(applyFunction(function, args, env), node.Token.Pos, env)
+		if err, ok := result.(*object.Error); ok {
+			err.Stack = append(err.Stack, frame)
+		}
+		return result
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.ArrayObject{Elements: elements}
+		return allocate(env, &object.ArrayObject{Elements: elements})
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -87,32 +124,119 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return locate(evalIndexExpression(left, index), node.Token.Pos, env)
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return locate(allocate(env, evalHashLiteral(node, env)), node.Token.Pos, env)
+	case *ast.ImportExpression:
+		return locate(evalImportExpression(node, env), node.Token.Pos, env)
+	case *ast.ExportStatement:
+		return Eval(node.Statement, env)
+	case *ast.MatchExpression:
+		return locate(evalMatchExpression(node, env), node.Token.Pos, env)
+	case *ast.MacroLiteral:
+		return locate(newError("macro literal is only allowed in a top-level let statement"), node.Token.Pos, env)
+	case *ast.BadStatement:
+		return locate(newError("syntax error at %s", node.Token.Pos), node.Token.Pos, env)
+	}
+	return nil
+}
 
+// loadPrelude evaluates the prelude in env the first time a program is
+// evaluated in its root environment, unless the prelude was disabled.
+func loadPrelude(env *object.Environment) object.Object {
+	if !env.NeedsPrelude() {
+		return nil
+	}
+	env.MarkPreludeLoaded()
+	if result := evalProgram(prelude.Parse(), env); isError(result) {
+		return result
 	}
 	return nil
 }
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
 
-	for keyNode, valueNode := range node.Pairs {
+func evalImportExpression(node *ast.ImportExpression, env *object.Environment) object.Object {
+	loader := env.Loader()
+	if loader == nil {
+		loader = module.NewLoader(module.SearchPathFromEnv()...)
+		env.SetLoader(loader)
+	}
+	path, err := loader.Resolve(env.File(), node.Path)
+	if err != nil {
+		return newError("%s", err)
+	}
+	if exports, ok := loader.Cached(path); ok {
+		return exports.(object.Object)
+	}
+	if err := loader.Enter(path); err != nil {
+		return newError("%s", err)
+	}
+	defer loader.Leave()
+
+	program, err := loader.Parse(path)
+	if err != nil {
+		return newError("%s", err)
+	}
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	if _, err := ExpandMacros(program, macroEnv); err != nil {
+		return newError("%s", err)
+	}
+	moduleEnv := object.NewModuleEnvironment(path, loader)
+	if env.PreludeDisabled() {
+		moduleEnv.DisablePrelude()
+	}
+	moduleEnv.SetMeter(env.Meter())
+	moduleEnv.SetIO(env.IO())
+	result := Eval(program, moduleEnv)
+	if isError(result) {
+		return result
+	}
+
+	exports := &object.HashObject{Pairs: make(map[object.HashKey]object.HashPair)}
+	for _, stmt := range program.Statements {
+		export, ok := stmt.(*ast.ExportStatement)
+		if !ok {
+			continue
+		}
+		for _, name := range export.Names() {
+			value, _ := moduleEnv.Get(name)
+			key := &object.StringObject{Value: name}
+			exports.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+	}
+	loader.Store(path, exports)
+	return exports
+}
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	// like the compiled code, the pairs are evaluated in the order of the
+	// source of their keys, and all of them before the keys are hashed
+	keyNodes := make([]ast.Expression, 0, len(node.Pairs))
+	for keyNode := range node.Pairs {
+		keyNodes = append(keyNodes, keyNode)
+	}
+	sort.Slice(keyNodes, func(i, j int) bool {
+		return keyNodes[i].String() < keyNodes[j].String()
+	})
+	evaluated := make([]object.HashPair, len(keyNodes))
+	for i, keyNode := range keyNodes {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
-
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
-		}
-
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
-		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		evaluated[i] = object.HashPair{Key: key, Value: value}
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, pair := range evaluated {
+		hashKey, ok := pair.Key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", pair.Key.Type())
+		}
+		pairs[hashKey.HashKey()] = pair
 	}
 	return &object.HashObject{Pairs: pairs}
 }
@@ -122,10 +246,17 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 		return evalArrayIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
+	case isIndexable(left):
+		return left.(object.Indexable).Index(index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
 }
+func isIndexable(obj object.Object) bool {
+	_, ok := obj.(object.Indexable)
+	return ok
+}
+
 func evalHashIndexExpression(hash object.Object, index object.Object) object.Object {
 	hashObject := hash.(*object.HashObject)
 	key, ok := index.(object.Hashable)
@@ -161,19 +292,73 @@ func evalExpressions(args []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// ApplyFunction calls fn, a function or builtin, with args as a call in a
+// program evaluated in env would.
+func ApplyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	return applyFunction(fn, args, env)
+}
+
+// applyFunction calls fn with args. It is a trampoline for tail calls: a
+// tail call returned by the function is applied in a loop instead of by
+// recursion.
+func applyFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	result := callFunction(fn, args, env)
+	for {
+		tail, ok := result.(*object.TailCall)
+		if !ok {
+			return result
+		}
+		result = locate(callFunction(tail.Function, tail.Arguments, env), tail.Frame.CallSite, env)
+		if err, ok := result.(*object.Error); ok {
+			err.Stack = append(err.Stack, tail.Frame)
+		}
+	}
+}
+
+// callFunction calls fn with args, counting the call and the value a
+// builtin returns on meter.
+func callFunction(fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	meter := env.Meter()
 	switch fn := fn.(type) {
 	case *object.FunctionObject:
-		extendedEnv := extendFunctionEnv(fn, args)
+		if err := meter.Enter(); err != nil {
+			return limitError(err)
+		}
+		defer meter.Leave()
+		extendedEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		result := fn.Call(env.IO(), args...)
+		if result == nil {
+			return NULL
+		}
+		if err := meter.Allocate(result); err != nil {
+			return limitError(err)
+		}
+		return result
 
 	}
 	return newError("not a function: %s", fn.Type())
 }
 
+// functionName describes the callee of a call for stack traces.
+func functionName(callee ast.Expression, fn object.Object) string {
+	if fn, ok := fn.(*object.FunctionObject); ok && fn.Name != "" {
+		return fn.Name
+	}
+	if ident, ok := callee.(*ast.Identifier); ok {
+		return ident.Value
+	}
+	if fn, ok := fn.(*object.FunctionObject); ok {
+		return "fn@" + fn.Pos.String()
+	}
+	return callee.String()
+}
+
 func unwrapReturnValue(value object.Object) object.Object {
 	if returnValue, ok := value.(*object.ReturnObject); ok {
 		return returnValue.Value
@@ -181,12 +366,38 @@ func unwrapReturnValue(value object.Object) object.Object {
 	return value
 }
 
-func extendFunctionEnv(fn *object.FunctionObject, args []object.Object) *object.Environment {
+// extendFunctionEnv binds the parameters of fn to args. Missing parameters
+// get their defaults, which see the parameters before them, and extra
+// arguments are collected in the rest parameter.
+func extendFunctionEnv(fn *object.FunctionObject, args []object.Object) (*object.Environment, *object.Error) {
+	required, max := len(fn.Parameters)-len(fn.Defaults), len(fn.Parameters)
+	if fn.Rest != nil {
+		max = -1
+	}
+	if len(args) < required || (max >= 0 && len(args) > max) {
+		return nil, newError("%s", object.ArityMismatch(len(args), required, max))
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(param.Value, args[paramIdx])
+			continue
+		}
+		value := Eval(fn.Defaults[paramIdx-required], env)
+		if err, ok := value.(*object.Error); ok {
+			return nil, err
+		}
+		env.Set(param.Value, value)
 	}
-	return env
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.Value, &object.ArrayObject{Elements: rest})
+	}
+	return env, nil
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
@@ -198,10 +409,11 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
 }
 
 func evalBlockStatements(block *ast.BlockStatement, env *object.Environment) object.Object {
+	hoistFunctions(block.Statements, env)
 	var result object.Object
 	for _, stmt := range block.Statements {
 		result = Eval(stmt, env)
@@ -289,6 +501,9 @@ func evalIntegerInfixExpression(op string, left, right object.Object) object.Obj
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -305,6 +520,7 @@ func evalIntegerInfixExpression(op string, left, right object.Object) object.Obj
 }
 
 func evalProgram(prog *ast.Program, env *object.Environment) object.Object {
+	hoistFunctions(prog.Statements, env)
 	var result object.Object
 	for _, stmt := range prog.Statements {
 		result = Eval(stmt, env)
@@ -318,6 +534,19 @@ func evalProgram(prog *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
+// hoistFunctions binds the functions declared by stmts in env, so they can
+// be called by statements before their declaration and by each other.
+func hoistFunctions(stmts []ast.Statement, env *object.Environment) {
+	for _, stmt := range stmts {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+		if decl, ok := stmt.(*ast.FunctionStatement); ok {
+			env.Set(decl.Name.Value, Eval(decl.Function, env))
+		}
+	}
+}
+
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
@@ -357,10 +586,36 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
+// limitError returns the error stopping a program that exceeded a limit.
+func limitError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Err: err}
+}
+
+// allocate counts the allocation of obj on the meter of env. It returns
+// obj, or an error if the allocation exceeds the limit.
+func allocate(env *object.Environment, obj object.Object) object.Object {
+	if isError(obj) {
+		return obj
+	}
+	if err := env.Meter().Allocate(obj); err != nil {
+		return limitError(err)
+	}
+	return obj
+}
+
 func newError(format string, a ...any) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// locate records that result, if it is an error not knowing where it was
+// raised yet, was raised at pos in the file env evaluates.
+func locate(result object.Object, pos token.Position, env *object.Environment) object.Object {
+	if err, ok := result.(*object.Error); ok && err.Pos.Line == 0 {
+		err.Pos, err.File = pos, env.File()
+	}
+	return result
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -1,9 +1,15 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"interpreter/lexer"
+	"interpreter/module"
 	"interpreter/object"
 	"interpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -133,6 +139,7 @@ func TestErrorHandling(t *testing.T) {
 		{"\"Hello\" - \"World\"", "unknown operator: STRING - STRING"},
 		{"len(1)", "argument to `len` not supported, got INTEGER"},
 		{"len(\"one\", \"two\")", "wrong number of arguments. got=2, want=1"},
+		{"10 / (5 - 5)", "division by zero"},
 	}
 	for idx, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -147,6 +154,107 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorStackTrace(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"len(1)", []string{"len@1:4"}},
+		{"let add = fn(a, b) { a + b };\nadd(1, true)", []string{"add@2:4"}},
+		{`let inner = fn() { -true };
+let outer = fn() { 1 + inner() };
+outer()`, []string{"inner@2:29", "outer@3:6"}},
+		{"fn(x) { x + true }(1)", []string{"fn@1:1@1:19"}},
+		{"let fns = [fn() { first(1) }];\nfns[0]()", []string{"first@1:24", "fn@1:12@2:7"}},
+		{"let a = fn() { 5 + true }; [a(), 1]", []string{"a@1:30"}},
+		{"fn boom() { 5 + true }\nlet alias = boom;\nalias()", []string{"boom@3:6"}},
+		{"fn a(n) { if (n == 0) { -true } else { b(n - 1) } }\nfn b(n) { a(n) }\na(3)", []string{"a@2:12", "a@3:2"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if len(errObj.Stack) != len(tt.expected) {
+			t.Errorf("wrong stack length for %q. want=%d, got=%d (%+v)", tt.input, len(tt.expected), len(errObj.Stack), errObj.Stack)
+			continue
+		}
+		for i, frame := range errObj.Stack {
+			got := frame.Function + "@" + frame.CallSite.String()
+			if got != tt.expected[i] {
+				t.Errorf("wrong frame %d for %q. want=%q, got=%q", i, tt.input, tt.expected[i], got)
+			}
+		}
+	}
+}
+
+func TestErrorTraceback(t *testing.T) {
+	input := `let inner = fn() { -true };
+let outer = fn() { inner() };
+outer()`
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := "Traceback (most recent call last):\n" +
+		"  line 3:6, in outer\n" +
+		"  line 2:25, in inner\n"
+	if errObj.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot=%q", expected, errObj.Traceback())
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "1:3"},
+		{"let x = 1;\n-true", "2:1"},
+		{"foo", "1:1"},
+		{"len(1)", "1:4"},
+		{"let f = fn(x) {\n  x / 0\n};\nf(1)", "2:5"},
+		{"[1][true]", "1:4"},
+		{"{fn() {}: 1}", "1:1"},
+		{"fn(a) { a }()", "1:12"},
+	}
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Pos.String() != tt.expected {
+			t.Errorf("wrong position for %q. want=%s, got=%s", tt.input, tt.expected, errObj.Pos)
+		}
+	}
+}
+
+func TestErrorDiagnostic(t *testing.T) {
+	input := `let inner = fn() { -true };
+let outer = fn() { inner() };
+outer()`
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned for %q", input)
+	}
+	var out strings.Builder
+	errObj.Diagnostic().Render(&out, input)
+	expected := "error[runtime]: unknown operator: -BOOLEAN\n" +
+		" --> 1:20\n" +
+		"  |\n" +
+		"1 | let inner = fn() { -true };\n" +
+		"  |                    ^\n" +
+		"  = note: in inner, called at 2:25\n" +
+		"  = note: in outer, called at 3:6\n"
+	if out.String() != expected {
+		t.Errorf("wrong diagnostic.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -162,6 +270,71 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let [a, b] = [1, 2]; a + b`, 3},
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; rest`, []int64{3, 4}},
+		{`let [a, ...rest] = [1]; rest`, []int64{}},
+		{`let {name, age} = {"name": "monkey", "age": 3}; name`, "monkey"},
+		{`let {"first": f, "info": {age}} = {"first": "m", "info": {"age": 7}}; age`, 7},
+		{`let [a, [b, c]] = [1, [2, 3]]; a * b * c`, 6},
+		{`let [a, b = 10] = [1]; a + b`, 11},
+		{`let [a, b = a * 2] = [4]; b`, 8},
+		{`let [x = 1, y = 2] = []; x + y`, 3},
+		{`let {name, age = 30} = {"name": "m"}; age`, 30},
+		{`let {age = 30} = {"age": 5}; age`, 5},
+		{`let [_, second] = [1, 2]; second`, 2},
+		{`let f = fn(p) { let [x, y] = p; x * y }; f([3, 4])`, 12},
+		{`let f = fn(p) { let {x, y = 1} = p; x - y }; f({"x": 5}) + f({"x": 5, "y": 5})`, 4},
+		{`let a = 1; let [a, b] = [a + 1, a + 2]; a * b`, 6},
+		{`match ([1]) { [a, b = 5] => a + b }`, 6},
+		{`match ({}) { {x = 1} => x }`, 1},
+		{`match ([1, 2]) { [a, b = 5, c = 6] => a + b + c }`, 9},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			testArrayObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.StringObject)
+			if !ok || str.Value != expected {
+				t.Errorf("object is not String %q. got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestDestructuringLetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = [1];`, "pattern [a, b] does not match [1]"},
+		{`let [a] = [1, 2];`, "pattern [a] does not match [1, 2]"},
+		{`let {name} = [1];`, "pattern {name} does not match [1]"},
+		{`let {a} = {"b": 1};`, "pattern {a} does not match {b: 1}"},
+		{`let [a, [b]] = [1, 2];`, "pattern [a, [b]] does not match [1, 2]"},
+		{`let f = fn() { let [x] = 5; x }; f()`, "pattern [x] does not match 5"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := `
   fn(x) { x+2; };
@@ -200,6 +373,131 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`fn add(a, b) { a + b }; add(1, 2)`, 3},
+		{`fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } } fact(5)`, 120},
+		{`let r = isEven(10); fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } } fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } } r`, true},
+		{`fn outer() { fn inner() { 41 } inner() + 1 } outer()`, 42},
+		{`fn outer() { let x = twice(2); fn twice(n) { n * 2 } x } outer()`, 4},
+		{`fn sum(a, b = 10, ...rest) { a + b + len(rest) } sum(1) + sum(1, 2, 3, 4)`, 16},
+		{`let f = 1; fn f() { 2 } f`, 1},
+		{`let f = fn() { fn g() { 1 } }; f()`, nil},
+		{`fn outer(n) { fn inner(k) { if (k == 0) { 0 } else { k + inner(k - 1) } } inner(n) } outer(100)`, 5050},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn add(a, b) { a + b } add`, "fn add(a, b){\n(a + b)\n}"},
+		{`let id = fn(x) { x }; id`, "fn id(x){\nx\n}"},
+		{`[fn(x) { x }][0]`, "fn(x){\nx\n}"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong inspect. want=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(100000)`, 0},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(10000, 0)`, 50005000},
+		{`fn even(n) { if (n == 0) { true } else { odd(n - 1) } } fn odd(n) { if (n == 0) { false } else { even(n - 1) } } even(100001)`, false},
+		{`let count = fn(xs, n) { match (xs) { [] => n, [_, ...rest] => count(rest, n + 1) } }; count([1, 2, 3], 0)`, 3},
+		{`let size = fn(x) { len(x) }; size("abc")`, 3},
+		{`let depth = fn(n) { if (n == 0) { 0 } else { 1 + depth(n - 1) } }; depth(100)`, 100},
+		{`let apply = fn(f, x) { f(x) }; apply(fn(x) { x * 2 }, 21)`, 42},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let f = fn(a, b = 2) { a + b }; f(1)`, 3},
+		{`let f = fn(a, b = 2) { a + b }; f(1, 5)`, 6},
+		{`let f = fn(a, b = a * 10, c = b + 1) { [a, b, c] }; f(1)`, []int64{1, 10, 11}},
+		{`let f = fn(a, b = a * 10, c = b + 1) { [a, b, c] }; f(1, 2)`, []int64{1, 2, 3}},
+		{`let f = fn(...xs) { xs }; f()`, []int64{}},
+		{`let f = fn(...xs) { xs }; f(1, 2, 3)`, []int64{1, 2, 3}},
+		{`let f = fn(a, ...xs) { len(xs) + a }; f(10, 1, 2)`, 12},
+		{`let f = fn(a, b = 5, ...xs) { [a, b, xs] }; let r = f(1); r[1] + len(r[2])`, 5},
+		{`let f = fn(a, b = 5, ...xs) { [a, b, xs] }; let r = f(1, 2, 3, 4); r[1] + len(r[2])`, 4},
+		{`let add = fn(...xs) { reduce(xs, 0, fn(acc, x) { acc + x }) }; add(1, 2, 3, 4)`, 10},
+		{`let f = fn(x = 1) { x }; let g = fn() { f() }; g()`, 1},
+		{`let k = 7; let f = fn(x = k) { x }; f()`, 7},
+		{`let count = fn(n, acc = 0) { if (n == 0) { acc } else { count(n - 1, acc + n) } }; count(4)`, 10},
+		{`let f = fn(a, b = 1) { let c = a + b; c * 2 }; f(1) + f(1, 2)`, 10},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			testArrayObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestFunctionArityErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a, b) { a }(1)`, "wrong number of arguments. got=1, want=2"},
+		{`fn(a) { a }(1, 2)`, "wrong number of arguments. got=2, want=1"},
+		{`fn(a, b = 1) { a }()`, "wrong number of arguments. got=0, want=1..2"},
+		{`fn(a, b = 1) { a }(1, 2, 3)`, "wrong number of arguments. got=3, want=1..2"},
+		{`fn(a, ...r) { a }()`, "wrong number of arguments. got=0, want>=1"},
+		{`fn(a = missing) { a }()`, "identifier not found: missing"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"hello world!"`
 	evaluated := testEval(input)
@@ -245,6 +543,10 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([1, 2, 3])`, []int64{2, 3}},
 		{`rest([])`, nil},
 		{`rest(1)`, "argument to `rest` must be ARRAY, got INTEGER"},
+		{`json_parse("[1, 2]")`, []int64{1, 2}},
+		{`json_parse(json_stringify({"a": [5]}))["a"][0]`, 5},
+		{`json_parse("[1")`, "json_parse: unexpected end of JSON input at offset 2"},
+		{`json_stringify(len)`, "json_stringify: unsupported value BUILTIN"},
 	}
 	for idx, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -272,6 +574,137 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestPrelude(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int64{2, 4, 6}},
+		{`filter(range(0, 6), fn(x) { x / 2 * 2 == x })`, []int64{0, 2, 4}},
+		{`reduce([1, 2, 3], 10, fn(acc, x) { acc + x })`, 16},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, true},
+		{`all([1, 2, 3], fn(x) { x > 2 })`, false},
+		{`contains([1, 2, 3], 2)`, true},
+		{`reverse([1, 2, 3])`, []int64{3, 2, 1}},
+		{`concat([1], [2, 3])`, []int64{1, 2, 3}},
+		{`take([1, 2, 3], 2)`, []int64{1, 2}},
+		{`drop([1, 2, 3], 2)`, []int64{3}},
+		{`range(2, 5)`, []int64{2, 3, 4}},
+		{`len(zip([1, 2, 3], [4, 5]))`, 2},
+		{`zip([1, 2, 3], [4, 5])[1]`, []int64{2, 5}},
+		{`sum(range(1, 101))`, 5050},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`let map = fn(x) { x }; map(5)`, 5},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case []int64:
+			testArrayObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.StringObject)
+			if !ok || str.Value != expected {
+				t.Errorf("object is not String %q. got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestDisablePrelude(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "lib.mk", `export let total = sum([1, 2, 3]);`)
+
+	env := object.NewModuleEnvironment(filepath.Join(dir, "main.mk"), module.NewLoader())
+	testIntegerObject(t, testEvalEnv(`let lib = import "lib.mk"; lib["total"]`, env), 6)
+
+	env = object.NewModuleEnvironment(filepath.Join(dir, "main.mk"), module.NewLoader())
+	env.DisablePrelude()
+	for _, input := range []string{`sum([1, 2, 3])`, `import "lib.mk"`} {
+		evaluated := testEvalEnv(input, env)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != "identifier not found: sum" {
+			t.Errorf("wrong error message. got=%q", errObj.Message)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`match (1) { 1 => "one", 2 => "two" }`, "one"},
+		{`match (3) { 1 => "one", _ => "other" }`, "other"},
+		{`match (3) { 1 => "one" }`, nil},
+		{`match ("a") { 1 => "int", "a" => "str" }`, "str"},
+		{`match (true) { false => 0, true => 1 }`, 1},
+		{`match (-1) { -1 => "neg", _ => "pos" }`, "neg"},
+		{`match (5) { x => x * 2 }`, 10},
+		{`match ([1, 2, 3]) { [a, b] => 0, [a, b, c] => a + b + c }`, 6},
+		{`match ([1, 2, 3]) { [first, ...rest] => rest }`, []int64{2, 3}},
+		{`match ([]) { [x, ...r] => x, [] => -1 }`, -1},
+		{`match ([1]) { [_, ..._] => "non-empty" }`, "non-empty"},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a * b * c }`, 6},
+		{`match ({"name": "monkey", "age": 3}) { {"name": n, "age": 4} => n, {name, age} => name + "!" }`, "monkey!"},
+		{`match ({"a": 1}) { {"b": x} => x, {"a": [y]} => y, {"a": y} => y + 1 }`, 2},
+		{`match ({1: "x"}) { {1: v} => v }`, "x"},
+		{`match ({"a": 1}) { [a] => 1, {"a": a} if a == 1 => 2 }`, 2},
+		{`match (7) { x if x > 10 => "big", x if x > 5 => "medium", _ => "small" }`, "medium"},
+		{`match (fn(x) { x }) { 1 => 1, _ => 2 }`, 2},
+		{`match (1 + 1) { 2 => match ("x") { "x" => 20 } }`, 20},
+		{`let x = 1; match (2) { x => x }; x`, 1},
+		{`let f = fn(v) { match (v) { [h, ...t] => h + f(t), [] => 0 } }; f([1, 2, 3, 4])`, 10},
+		{`let g = fn(p) { let z = 3; match (p) { {x} => x + z, _ => z } }; g({"x": 4}) + g(1)`, 10},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			testArrayObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			str, ok := evaluated.(*object.StringObject)
+			if !ok || str.Value != expected {
+				t.Errorf("object is not String %q. got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (missing) { _ => 1 }`, "identifier not found: missing"},
+		{`match (1) { x if y => 1 }`, "identifier not found: y"},
+		{`match (1) { 1 => 1 + true }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2*2, 3+3]"
 	evaluated := testEval(input)
@@ -379,6 +812,106 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestImportExpression(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "lib/math.mk", `
+let square = fn(x) { x * x };
+export let cube = fn(x) { square(x) * x };
+export let answer = 42;
+`)
+	writeModule(t, dir, "lib/counter.mk", `export let id = import "./math.mk";`)
+	writeModule(t, dir, "vendor/greet.mk", `export let hello = fn(name) { "hello " + name };`)
+	writeModule(t, dir, "lib/parity.mk", `
+export fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+`)
+	writeModule(t, dir, "lib/macros.mk", `
+let double = macro(x) { quote(unquote(x) + unquote(x)) };
+export let twice = fn(n) { double(n) };
+`)
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let m = import "lib/math.mk"; m["answer"]`, 42},
+		{`let m = import "lib/math"; m["cube"](3)`, 27},
+		{`let m = import "lib/math.mk"; m["square"]`, nil},
+		{`let b = import "lib/counter.mk"; b["id"]["cube"](2)`, 8},
+		{`let g = import "greet.mk"; g["hello"]("monkey")`, "hello monkey"},
+		{`let m = import "lib/macros.mk"; m["twice"](4)`, 8},
+		{`let p = import "lib/parity.mk"; if (p["isEven"](6)) { 1 } else { 0 }`, 1},
+		{`import "missing.mk"`, `module "missing.mk" not found`},
+	}
+	for _, tt := range tests {
+		env := object.NewModuleEnvironment(filepath.Join(dir, "main.mk"), module.NewLoader(filepath.Join(dir, "vendor")))
+		evaluated := testEvalEnv(tt.input, env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+				continue
+			}
+			str, ok := evaluated.(*object.StringObject)
+			if !ok || str.Value != expected {
+				t.Errorf("object is not String %q. got=%T (%+v)", expected, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestImportEvaluatesModuleOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "lib.mk", `export let items = [1, 2, 3];`)
+	env := object.NewModuleEnvironment(filepath.Join(dir, "main.mk"), module.NewLoader())
+	evaluated := testEvalEnv(`
+let load = fn() { import "lib.mk" };
+let a = load();
+let b = import "./lib.mk";
+[a, b]`, env)
+	pair, ok := evaluated.(*object.ArrayObject)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+	if pair.Elements[0] != pair.Elements[1] {
+		t.Errorf("module evaluated more than once")
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "a.mk", `export let b = import "b.mk";`)
+	writeModule(t, dir, "b.mk", `export let a = import "a.mk";`)
+	env := object.NewModuleEnvironment(filepath.Join(dir, "main.mk"), module.NewLoader())
+	evaluated := testEvalEnv(`import "a.mk"`, env)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T (%+v)", evaluated, evaluated)
+	}
+	a, b := filepath.Join(dir, "a.mk"), filepath.Join(dir, "b.mk")
+	expected := "import cycle: " + a + " -> " + b + " -> " + a
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+	}
+}
+
+func writeModule(t *testing.T, dir, name, source string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func testArrayObject(t *testing.T, obj object.Object, expected []int64) bool {
 	result, ok := obj.(*object.ArrayObject)
 	if !ok {
@@ -403,11 +936,64 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	return true
 }
 
+func TestLimits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected error // nil if the program must finish
+	}{
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(100)", object.Limits{MaxSteps: 100000, MaxCallDepth: 10, MaxAllocated: 100000}, nil},
+		{"let f = fn() { f() }; f()", object.Limits{MaxSteps: 10000}, object.ErrStepLimit},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", object.Limits{MaxCallDepth: 100}, object.ErrCallDepthLimit},
+		{"let f = fn(s) { f(s + s) }; f(\"ab\")", object.Limits{MaxAllocated: 1 << 20}, object.ErrAllocationLimit},
+		{"let f = fn(a) { f(push(a, 1)) }; f([])", object.Limits{MaxAllocated: 1 << 20}, object.ErrAllocationLimit},
+		{"let f = fn() { f() }; f()", object.Limits{Context: canceled}, object.ErrCanceled},
+		{"let f = fn() { f() }; f()", object.Limits{Context: canceled}, context.Canceled},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		env.DisablePrelude()
+		env.SetLimits(tt.limits)
+		result := testEvalEnv(tt.input, env)
+		err, isErr := result.(*object.Error)
+		if tt.expected == nil {
+			if isErr {
+				t.Errorf("%q stopped: %s", tt.input, err.Message)
+			}
+			continue
+		}
+		if !isErr {
+			t.Errorf("%q was not stopped. got=%s", tt.input, result.Inspect())
+			continue
+		}
+		if !errors.Is(err.Err, tt.expected) {
+			t.Errorf("%q stopped with the wrong error. want=%v, got=%v (%s)", tt.input, tt.expected, err.Err, err.Message)
+		}
+	}
+}
+
+func TestLimitsInModules(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "lib.mk", "export fn spin() { spin() }")
+	env := object.NewModuleEnvironment(filepath.Join(dir, "main.mk"), module.NewLoader())
+	env.DisablePrelude()
+	env.SetLimits(object.Limits{MaxSteps: 10000})
+	result := testEvalEnv(`let lib = import "lib.mk"; lib["spin"]()`, env)
+	if err, ok := result.(*object.Error); !ok || !errors.Is(err.Err, object.ErrStepLimit) {
+		t.Errorf("module code was not limited. got=%s", result.Inspect())
+	}
+}
+
 func testEval(input string) object.Object {
+	return testEvalEnv(input, object.NewEnvironment())
+}
+
+func testEvalEnv(input string, env *object.Environment) object.Object {
 	l := lexer.NewLexer(input)
 	p := parser.NewParser(l)
 	program := p.ParseProgram()
-	env := object.NewEnvironment()
 	return Eval(program, env)
 }
 
@@ -436,3 +1022,25 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	}
 	return true
 }
+
+func TestIO(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "lib.mk", `puts("loading"); export fn greet(name) { println("hello,", name) }`)
+	env := object.NewModuleEnvironment(filepath.Join(dir, "main.mk"), module.NewLoader())
+	var out strings.Builder
+	env.SetIO(object.NewIO(strings.NewReader("world\r\nrest\nof input"), &out))
+	result := testEvalEnv(`
+let lib = import "lib.mk";
+lib["greet"](read_line());
+print(1, [2], "3");
+puts("", true);
+let rest = read_all();
+[rest, read_line()]`, env)
+	expected := "loading\nhello, world\n1 [2] 3\ntrue\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+	if result.Inspect() != "[rest\nof input, null]" {
+		t.Errorf("wrong input read. got=%s", result.Inspect())
+	}
+}
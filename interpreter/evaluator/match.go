@@ -0,0 +1,141 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// evalDestructuringLet binds the names of the pattern of node in env.
+func evalDestructuringLet(node *ast.LetStatement, env *object.Environment) object.Object {
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+	matched, err := matchPattern(node.Pattern, value, env)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return newError("pattern %s does not match %s", node.Pattern.String(), value.Inspect())
+	}
+	return nil
+}
+
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	for _, arm := range node.Arms {
+		// bindings of an arm are only visible in its guard and body
+		armEnv := object.NewEnclosedEnvironment(env)
+		matched, err := matchPattern(arm.Pattern, subject, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return Eval(arm.Body, armEnv)
+	}
+	return NULL
+}
+
+// matchPattern reports whether value matches pattern, binding the names of
+// the pattern in env. The error result is set if evaluating a literal or key
+// of the pattern fails.
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+	case *ast.BindingPattern:
+		env.Set(pattern.Name.Value, value)
+		return true, nil
+	case *ast.LiteralPattern:
+		literal := Eval(pattern.Value, env)
+		if isError(literal) {
+			return false, literal
+		}
+		return object.SameValue(literal, value), nil
+	case *ast.DefaultPattern:
+		return matchPattern(pattern.Pattern, value, env)
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.ArrayObject)
+		if !ok {
+			return false, nil
+		}
+		n := len(pattern.Elements)
+		if len(array.Elements) < pattern.MinLength() || (pattern.Rest == nil && len(array.Elements) > n) {
+			return false, nil
+		}
+		for i, element := range pattern.Elements {
+			var elementValue object.Object
+			if i < len(array.Elements) {
+				elementValue = array.Elements[i]
+			}
+			if matched, err := matchElement(element, elementValue, env); !matched || err != nil {
+				return false, err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := []object.Object{}
+			if len(array.Elements) > n {
+				rest = append(rest, array.Elements[n:]...)
+			}
+			return matchPattern(pattern.Rest, &object.ArrayObject{Elements: rest}, env)
+		}
+		return true, nil
+	case *ast.HashPattern:
+		hash, ok := value.(*object.HashObject)
+		if !ok {
+			return false, nil
+		}
+		for i, keyNode := range pattern.Keys {
+			key := Eval(keyNode, env)
+			if isError(key) {
+				return false, key
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return false, newError("unusable as hash key: %s", key.Type())
+			}
+			var pairValue object.Object
+			if pair, ok := hash.Pairs[hashKey.HashKey()]; ok {
+				pairValue = pair.Value
+			}
+			if matched, err := matchElement(pattern.Values[i], pairValue, env); !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	return false, newError("unknown pattern: %T", pattern)
+}
+
+// matchElement matches an element of an array or a value of a hash, which is
+// nil if it is missing. A missing value only matches a DefaultPattern, which
+// matches its default instead.
+func matchElement(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, object.Object) {
+	if def, ok := pattern.(*ast.DefaultPattern); ok {
+		if value == nil {
+			value = Eval(def.Default, env)
+			if isError(value) {
+				return false, value
+			}
+		}
+		pattern = def.Pattern
+	}
+	if value == nil {
+		return false, nil
+	}
+	return matchPattern(pattern, value, env)
+}
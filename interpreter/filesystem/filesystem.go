@@ -0,0 +1,266 @@
+// Package filesystem provides builtins giving scripts access to files. The
+// builtins are not defined unless the host grants the capability by
+// defining the builtins of an Access, which restricts them to the files
+// under its root directories.
+//
+// Failing calls do not stop the program: every builtin returns a pair
+// [result, error], where error is NULL on success and the message of the
+// failure otherwise, so that scripts can handle it:
+//
+//	let [text, err] = read_file("config.json");
+//	if (err) { puts(err) } else { json_parse(text) }
+//
+// Only calls with arguments of the wrong type return an ERROR.
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/object"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrOutsideRoots is the error of access to a path outside the roots.
+var ErrOutsideRoots = errors.New("outside the allowed directories")
+
+// Access is the capability to access the files under a set of root
+// directories.
+//
+// Paths are resolved and checked against the roots before the builtins use
+// them, and the files are then opened relative to their root with os.Root,
+// which does not follow symbolic links out of it. Another process that
+// replaces a directory or a file with a link between the check and its use
+// therefore cannot lead a builtin out of the roots.
+type Access struct {
+	roots []string
+}
+
+// NewAccess returns an Access to the files under roots, which must be
+// existing directories. Relative paths in scripts are relative to the first
+// root.
+func NewAccess(roots ...string) (*Access, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("no root directories")
+	}
+	a := &Access{}
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		// symbolic links are resolved so that resolved paths can be
+		// compared with the roots
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("root %s is not a directory", root)
+		}
+		a.roots = append(a.roots, resolved)
+	}
+	return a, nil
+}
+
+// Resolve returns the path that path refers to, with symbolic links
+// resolved, or an error wrapping ErrOutsideRoots if that is outside the
+// roots. A path that does not exist resolves if its directory does, but a
+// symbolic link must point to an existing file.
+func (a *Access) Resolve(path string) (string, error) {
+	return a.resolve(path, true)
+}
+
+// resolve resolves path like Resolve, but does not follow a symbolic link
+// in its last element unless followLast is set.
+func (a *Access) resolve(path string, followLast bool) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(a.roots[0], path)
+	}
+	path = filepath.Clean(path)
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", unwrapPathError(err)
+	}
+	resolved := filepath.Join(dir, filepath.Base(path))
+	if followLast {
+		target, err := filepath.EvalSymlinks(resolved)
+		switch {
+		case err == nil:
+			resolved = target
+		case !errors.Is(err, fs.ErrNotExist):
+			return "", unwrapPathError(err)
+		default:
+			if _, err := os.Lstat(resolved); err == nil {
+				// writing through a dangling link would create its target
+				return "", errors.New("dangling symbolic link")
+			}
+		}
+	}
+	if _, _, ok := a.split(resolved); !ok {
+		return "", ErrOutsideRoots
+	}
+	return resolved, nil
+}
+
+// split returns the root the resolved path is under and the path relative
+// to it, which is "." for the root itself.
+func (a *Access) split(resolved string) (root, rel string, ok bool) {
+	for _, root := range a.roots {
+		rel, err := filepath.Rel(root, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return root, rel, true
+		}
+	}
+	return "", "", false
+}
+
+// unwrapPathError returns the cause of err without the path, which is
+// the resolved path rather than the one the script passed.
+func unwrapPathError(err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// Builtins returns the builtins restricted to a, by name:
+//
+//   - read_file(path) returns the contents of a file,
+//   - write_file(path, text) replaces the contents of a file, creating it
+//     if needed, and returns NULL,
+//   - append_file(path, text) appends to a file, creating it if needed,
+//     and returns NULL,
+//   - list_dir(path) returns the sorted names in a directory,
+//   - exists(path) returns whether a file exists,
+//   - remove(path) removes a file, symbolic link or empty directory, other
+//     than a root, and returns NULL.
+func (a *Access) Builtins() map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"read_file": a.builtin("read_file", 1, true, func(root *os.Root, path string, _ []string) (object.Object, error) {
+			f, err := root.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return nil, err
+			}
+			return &object.StringObject{Value: string(data)}, nil
+		}),
+		"write_file": a.builtin("write_file", 2, true, func(root *os.Root, path string, args []string) (object.Object, error) {
+			return object.NULL, writeFile(root, path, os.O_TRUNC, args[0])
+		}),
+		"append_file": a.builtin("append_file", 2, true, func(root *os.Root, path string, args []string) (object.Object, error) {
+			return object.NULL, writeFile(root, path, os.O_APPEND, args[0])
+		}),
+		"list_dir": a.builtin("list_dir", 1, true, func(root *os.Root, path string, _ []string) (object.Object, error) {
+			f, err := root.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			entries, err := f.ReadDir(-1)
+			if err != nil {
+				return nil, err
+			}
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+			names := make([]object.Object, len(entries))
+			for i, entry := range entries {
+				names[i] = &object.StringObject{Value: entry.Name()}
+			}
+			return &object.ArrayObject{Elements: names}, nil
+		}),
+		"exists": a.builtin("exists", 1, true, func(root *os.Root, path string, _ []string) (object.Object, error) {
+			_, err := root.Stat(path)
+			if errors.Is(err, fs.ErrNotExist) {
+				return object.FALSE, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return object.TRUE, nil
+		}),
+		"remove": a.builtin("remove", 1, false, func(root *os.Root, path string, _ []string) (object.Object, error) {
+			if path == "." {
+				return nil, errors.New("cannot remove a root directory")
+			}
+			return object.NULL, root.Remove(path)
+		}),
+	}
+}
+
+// writeFile writes text to the file at path in root, creating it if needed,
+// and opening it with the additional flag os.O_TRUNC or os.O_APPEND.
+func writeFile(root *os.Root, path string, flag int, text string) error {
+	f, err := root.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(text)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Define defines the builtins of a in env.
+func (a *Access) Define(env *object.Environment) {
+	for name, builtin := range a.Builtins() {
+		env.Set(name, builtin)
+	}
+}
+
+// builtin returns the builtin name taking arity STRING arguments, the first
+// of which is a path. It resolves the path, following a link in its last
+// element if followLast is set, calls fn with the root the path is under,
+// the path relative to the root and the other arguments, and returns the
+// pair of its results.
+func (a *Access) builtin(name string, arity int, followLast bool, fn func(root *os.Root, path string, args []string) (object.Object, error)) *object.Builtin {
+	return &object.Builtin{Arity: arity, Fn: func(args ...object.Object) object.Object {
+		if len(args) != arity {
+			return &object.Error{Message: object.ArityMismatch(len(args), arity, arity)}
+		}
+		strs := make([]string, len(args))
+		for i, arg := range args {
+			str, ok := arg.(*object.StringObject)
+			if !ok {
+				return &object.Error{Message: fmt.Sprintf("argument %d to `%s` must be STRING, got %s", i+1, name, arg.Type())}
+			}
+			strs[i] = str.Value
+		}
+		fail := func(err error) object.Object {
+			message := fmt.Sprintf("%s %s: %s", name, strs[0], unwrapPathError(err))
+			return pair(object.NULL, &object.StringObject{Value: message})
+		}
+		resolved, err := a.resolve(strs[0], followLast)
+		if err != nil {
+			return fail(err)
+		}
+		dir, path, _ := a.split(resolved)
+		root, err := os.OpenRoot(dir)
+		if err != nil {
+			return fail(err)
+		}
+		defer root.Close()
+		result, err := fn(root, path, strs[1:])
+		if err != nil {
+			return fail(err)
+		}
+		return pair(result, object.NULL)
+	}}
+}
+
+func pair(result, err object.Object) *object.ArrayObject {
+	return &object.ArrayObject{Elements: []object.Object{result, err}}
+}
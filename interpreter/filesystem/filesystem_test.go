@@ -0,0 +1,202 @@
+package filesystem
+
+import (
+	"errors"
+	"interpreter/object"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setup creates a root directory and a directory outside of it, with
+// symbolic links from the root to files inside and outside.
+func setup(t *testing.T) (root, outside string) {
+	dir := t.TempDir()
+	root, outside = filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside, filepath.Join(root, "sub")} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(root, "a.txt"):        "hello",
+		filepath.Join(root, "sub", "b.txt"): "b",
+		filepath.Join(outside, "secret"):    "secret",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"escape":   filepath.Join(outside, "secret"),
+		"outdir":   outside,
+		"dangling": filepath.Join(outside, "new"),
+		"inside":   filepath.Join(root, "a.txt"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symbolic links not supported: %s", err)
+		}
+	}
+	return root, outside
+}
+
+func call(builtins map[string]*object.Builtin, name string, args ...string) object.Object {
+	objects := make([]object.Object, len(args))
+	for i, arg := range args {
+		objects[i] = &object.StringObject{Value: arg}
+	}
+	return builtins[name].Fn(objects...)
+}
+
+func TestBuiltins(t *testing.T) {
+	root, outside := setup(t)
+	access, err := NewAccess(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtins := access.Builtins()
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string // the Inspect of the result or the error message
+		err      bool
+	}{
+		{"read_file", []string{"a.txt"}, "hello", false},
+		{"read_file", []string{filepath.Join(root, "sub", "b.txt")}, "b", false},
+		{"read_file", []string{"sub/../a.txt"}, "hello", false},
+		{"read_file", []string{"inside"}, "hello", false},
+		{"read_file", []string{"missing"}, "read_file missing: no such file or directory", true},
+		{"read_file", []string{"../outside/secret"}, "read_file ../outside/secret: outside the allowed directories", true},
+		{"read_file", []string{filepath.Join(outside, "secret")}, "read_file " + filepath.Join(outside, "secret") + ": outside the allowed directories", true},
+		{"read_file", []string{"escape"}, "read_file escape: outside the allowed directories", true},
+		{"read_file", []string{"outdir/secret"}, "read_file outdir/secret: outside the allowed directories", true},
+		{"read_file", []string{"sub/../../outside/secret"}, "read_file sub/../../outside/secret: outside the allowed directories", true},
+		{"write_file", []string{"dangling", "x"}, "write_file dangling: dangling symbolic link", true},
+		{"write_file", []string{"escape", "x"}, "write_file escape: outside the allowed directories", true},
+		{"write_file", []string{"outdir/new", "x"}, "write_file outdir/new: outside the allowed directories", true},
+		{"write_file", []string{"nodir/new", "x"}, "write_file nodir/new: no such file or directory", true},
+		{"write_file", []string{"new.txt", "one"}, "null", false},
+		{"append_file", []string{"new.txt", " two"}, "null", false},
+		{"append_file", []string{"log", "line"}, "null", false},
+		{"read_file", []string{"new.txt"}, "one two", false},
+		{"read_file", []string{"log"}, "line", false},
+		{"list_dir", []string{"sub"}, "[b.txt]", false},
+		{"list_dir", []string{"."}, "[a.txt, dangling, escape, inside, log, new.txt, outdir, sub]", false},
+		{"list_dir", []string{"outdir"}, "list_dir outdir: outside the allowed directories", true},
+		{"exists", []string{"a.txt"}, "true", false},
+		{"exists", []string{"missing"}, "false", false},
+		{"exists", []string{"escape"}, "exists escape: outside the allowed directories", true},
+		{"remove", []string{"escape"}, "null", false},
+		{"remove", []string{"new.txt"}, "null", false},
+		{"remove", []string{"sub"}, "remove sub: directory not empty", true},
+		{"remove", []string{"."}, "remove .: cannot remove a root directory", true},
+		{"remove", []string{"outdir/secret"}, "remove outdir/secret: outside the allowed directories", true},
+		{"exists", []string{"new.txt"}, "false", false},
+	}
+	for _, tt := range tests {
+		result, ok := call(builtins, tt.name, tt.args...).(*object.ArrayObject)
+		if !ok || len(result.Elements) != 2 {
+			t.Fatalf("%s(%q): result is not a pair", tt.name, tt.args)
+		}
+		value, errValue := result.Elements[0], result.Elements[1]
+		switch {
+		case tt.err && errValue == object.NULL:
+			t.Errorf("%s(%q): expected an error, got %s", tt.name, tt.args, value.Inspect())
+		case tt.err && errValue.Inspect() != tt.expected:
+			t.Errorf("%s(%q): wrong error. want=%q, got=%q", tt.name, tt.args, tt.expected, errValue.Inspect())
+		case !tt.err && errValue != object.NULL:
+			t.Errorf("%s(%q): unexpected error %s", tt.name, tt.args, errValue.Inspect())
+		case !tt.err && value.Inspect() != tt.expected:
+			t.Errorf("%s(%q): wrong result. want=%s, got=%s", tt.name, tt.args, tt.expected, value.Inspect())
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(outside, "secret")); err != nil {
+		t.Errorf("file outside the root changed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Errorf("file created outside the root")
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	access, err := NewAccess(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	builtins := access.Builtins()
+	tests := []struct {
+		name     string
+		args     []object.Object
+		expected string
+	}{
+		{"read_file", nil, "wrong number of arguments. got=0, want=1"},
+		{"write_file", []object.Object{&object.StringObject{Value: "a"}}, "wrong number of arguments. got=1, want=2"},
+		{"read_file", []object.Object{&object.Integer{Value: 1}}, "argument 1 to `read_file` must be STRING, got INTEGER"},
+		{"write_file", []object.Object{&object.StringObject{Value: "a"}, object.TRUE}, "argument 2 to `write_file` must be STRING, got BOOLEAN"},
+	}
+	for _, tt := range tests {
+		result, ok := builtins[tt.name].Fn(tt.args...).(*object.Error)
+		if !ok || result.Message != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, result)
+		}
+	}
+}
+
+func TestNewAccess(t *testing.T) {
+	root, _ := setup(t)
+	if _, err := NewAccess(); err == nil {
+		t.Errorf("access without roots")
+	}
+	if _, err := NewAccess(filepath.Join(root, "a.txt")); err == nil {
+		t.Errorf("access to a file as root")
+	}
+	if _, err := NewAccess(filepath.Join(root, "missing")); err == nil {
+		t.Errorf("access to a missing root")
+	}
+
+	// a root through a symbolic link, and a second root
+	access, err := NewAccess(filepath.Join(root, "sub"), filepath.Join(root, "outdir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := access.Resolve("new"); err != nil {
+		t.Errorf("new file in the first root: %s", err)
+	}
+	if _, err := access.Resolve(filepath.Join(root, "outdir", "secret")); err != nil {
+		t.Errorf("path in the second root: %s", err)
+	}
+	if _, err := access.Resolve(filepath.Join(root, "a.txt")); !errors.Is(err, ErrOutsideRoots) {
+		t.Errorf("expected ErrOutsideRoots, got %v", err)
+	}
+}
+
+// TestSwapAfterCheck replaces a directory with a link out of the root after
+// the path through it is checked, which must not let the write escape.
+func TestSwapAfterCheck(t *testing.T) {
+	root, outside := setup(t)
+	access, err := NewAccess(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := access.builtin("write_file", 2, true, func(r *os.Root, path string, args []string) (object.Object, error) {
+		sub := filepath.Join(root, "sub")
+		if err := os.Rename(sub, sub+".old"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(outside, sub); err != nil {
+			t.Fatal(err)
+		}
+		return object.NULL, writeFile(r, path, os.O_TRUNC, args[0])
+	})
+	result := write.Fn(&object.StringObject{Value: "sub/b.txt"}, &object.StringObject{Value: "x"}).(*object.ArrayObject)
+	if result.Elements[1] == object.NULL {
+		t.Errorf("write through the swapped directory succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "b.txt")); err == nil {
+		t.Errorf("file created outside the root")
+	}
+}
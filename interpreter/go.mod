@@ -1,3 +1,3 @@
 module interpreter
 
-go 1.22.5
+go 1.24.0
@@ -9,17 +9,25 @@ type Lexer struct {
 	position     int // current position
 	readPosition int // next position
 	ch           byte
+	line         int // line of ch
+	column       int // column of ch
 }
 
 func NewLexer(input string) *Lexer {
 	l := &Lexer{
 		input: input,
+		line:  1,
 	}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -35,6 +43,14 @@ func (l *Lexer) peekChar() byte {
 		return l.input[l.readPosition]
 	}
 }
+
+// peekCharAt returns the character n positions after the next one.
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.readPosition+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+n]
+}
 func (l *Lexer) readIdentifer() string {
 	start := l.position
 	for isLetter(l.ch) {
@@ -68,8 +84,15 @@ func (l *Lexer) readString() string {
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
 	l.skipWhiteSpace()
+	pos := token.Position{Offset: l.position, Line: l.line, Column: l.column}
+	tok := l.readToken()
+	tok.Pos = pos
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 	switch l.ch {
 	case '+':
 		tok = token.NewToken(token.PLUS, string(l.ch))
@@ -93,6 +116,9 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = token.NewToken(token.EQ, "==")
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.NewToken(token.ARROW, "=>")
 		} else {
 
 			tok = token.NewToken(token.ASSIGN, string(l.ch))
@@ -135,6 +161,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok = token.NewToken(token.RBRACKET, string(l.ch))
 	case ':':
 		tok = token.NewToken(token.COLON, string(l.ch))
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.NewToken(token.ELLIPSIS, "...")
+		} else {
+			tok = token.NewToken(token.ILLEGAL, string(l.ch))
+		}
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifer()
@@ -31,6 +31,7 @@ func TestNextToken(t *testing.T) {
   "foo bar"
   [1,2]
   {"name":"monkey"}
+  match (x) { [a, ...b] => a, _ => . }
   `
 	tests := []struct {
 		expectedType    token.TokenType
@@ -125,6 +126,24 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "monkey"},
 		{token.RBRACE, "}"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "b"},
+		{token.RBRACKET, "]"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.ILLEGAL, "."},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 	l := NewLexer(input)
@@ -139,3 +158,38 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  add(x,
+"a b")`
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"add", 2, 3},
+		{"(", 2, 6},
+		{"x", 2, 7},
+		{",", 2, 8},
+		{"a b", 3, 1},
+		{")", 3, 6},
+		{"", 3, 7},
+	}
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test [%d] - literal wrong.expected=%q, got=%q\n", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("test [%d] - position wrong.expected=%d:%d, got=%s\n", i, tt.expectedLine, tt.expectedColumn, tok.Pos)
+		}
+	}
+}
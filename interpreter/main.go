@@ -1,13 +1,67 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/filesystem"
+	"interpreter/module"
+	"interpreter/object"
+	"interpreter/optimizer"
 	"interpreter/repl"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 )
 
+var noPrelude = flag.Bool("no-prelude", false, "do not load the prelude standard library")
+var optimize = flag.Bool("optimize", false, "fold constants and remove dead code before running a file")
+var allowFS = flag.String("allow-fs", "", "comma separated directories scripts may access with the file system builtins")
+var jsonErrors = flag.Bool("json", false, "report errors as JSON")
+var color = flag.Bool("color", false, "highlight errors with colors")
+
+// report writes diags to the standard error, with the source lines they
+// point at.
+func report(diags diagnostic.List) {
+	if *jsonErrors {
+		diagnostic.WriteJSON(os.Stderr, diags)
+		return
+	}
+	var opts []diagnostic.RenderOption
+	if *color {
+		opts = append(opts, diagnostic.WithColor())
+	}
+	for _, d := range diags {
+		var src []byte
+		if d.File != "" {
+			src, _ = os.ReadFile(d.File)
+		}
+		d.Render(os.Stderr, string(src), opts...)
+	}
+}
+
+// defineFileSystem defines the file system builtins in env if -allow-fs is
+// set.
+func defineFileSystem(env *object.Environment) error {
+	if *allowFS == "" {
+		return nil
+	}
+	access, err := filesystem.NewAccess(strings.Split(*allowFS, ",")...)
+	if err != nil {
+		return err
+	}
+	access.Define(env)
+	return nil
+}
+
 func main() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		os.Exit(runFile(flag.Arg(0)))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,5 +69,52 @@ func main() {
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username)
 
 	fmt.Printf("Feel free to type in command \n")
-	repl.Start(os.Stdin, os.Stdout)
+	env := object.NewEnvironment()
+	if *noPrelude {
+		env.DisablePrelude()
+	}
+	if err := defineFileSystem(env); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	repl.StartWithEnvironment(os.Stdin, os.Stdout, env)
+}
+
+// runFile evaluates the program in the file at path and returns the exit code.
+func runFile(path string) int {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	loader := module.NewLoader(module.SearchPathFromEnv()...)
+	program, err := loader.Parse(path)
+	if err != nil {
+		report(diagnostic.FromError(err))
+		return 1
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	if _, err := evaluator.ExpandMacros(program, macroEnv); err != nil {
+		report(diagnostic.FromError(err))
+		return 1
+	}
+	if *optimize {
+		optimizer.Optimize(program, optimizer.All)
+	}
+	loader.Enter(path)
+	defer loader.Leave()
+	env := object.NewModuleEnvironment(path, loader)
+	if *noPrelude {
+		env.DisablePrelude()
+	}
+	if err := defineFileSystem(env); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err, ok := evaluator.Eval(program, env).(*object.Error); ok {
+		report(diagnostic.List{err.Diagnostic()})
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,134 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Extension is appended to import paths that name a file without one.
+const Extension = ".mk"
+
+// SearchPathEnv names the environment variable holding extra directories,
+// separated by os.PathListSeparator, that imports are resolved against.
+const SearchPathEnv = "MONKEYPATH"
+
+// Loader resolves import paths to source files and parses them. It keeps the
+// stack of modules currently being loaded to detect import cycles, and a
+// cache so that every module is evaluated or compiled only once.
+type Loader struct {
+	SearchPath []string
+
+	loading []string
+	cache   map[string]any
+}
+
+func NewLoader(searchPath ...string) *Loader {
+	return &Loader{
+		SearchPath: searchPath,
+		cache:      make(map[string]any),
+	}
+}
+
+// SearchPathFromEnv returns the directories listed in $MONKEYPATH.
+func SearchPathFromEnv() []string {
+	value := os.Getenv(SearchPathEnv)
+	if value == "" {
+		return nil
+	}
+	return filepath.SplitList(value)
+}
+
+// Resolve returns the absolute path of the file that path refers to when it
+// is imported from the file from. An empty from means the importing code was
+// not read from a file and relative paths start at the working directory.
+//
+// Paths starting with "./" or "../" are resolved relative to the importing
+// file only. Other relative paths are tried relative to the importing file
+// first and then against each directory of the search path.
+func (l *Loader) Resolve(from, path string) (string, error) {
+	if path == "" {
+		return "", errors.New("empty import path")
+	}
+	dir := "."
+	if from != "" {
+		dir = filepath.Dir(from)
+	}
+
+	candidates := []string{}
+	switch {
+	case filepath.IsAbs(path):
+		candidates = append(candidates, path)
+	case strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../"):
+		candidates = append(candidates, filepath.Join(dir, path))
+	default:
+		candidates = append(candidates, filepath.Join(dir, path))
+		for _, root := range l.SearchPath {
+			candidates = append(candidates, filepath.Join(root, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if filepath.Ext(candidate) == "" {
+			candidate += Extension
+		}
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		return filepath.Abs(candidate)
+	}
+	return "", fmt.Errorf("module %q not found", path)
+}
+
+// Parse reads and parses the module at the resolved path.
+func (l *Loader) Parse(path string) (*ast.Program, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := parser.NewParser(lexer.NewLexer(string(source)))
+	program := p.ParseProgram()
+	if diags := p.Diagnostics(); len(diags) != 0 {
+		for _, d := range diags {
+			d.File = path
+		}
+		return nil, fmt.Errorf("parse errors in module %s: %w", path, diags)
+	}
+	return program, nil
+}
+
+// Enter marks the module at path as being loaded. It fails if the module is
+// already being loaded, which means it imports itself through a cycle.
+// Every successful Enter must be followed by a call to Leave.
+func (l *Loader) Enter(path string) error {
+	for i, loading := range l.loading {
+		if loading == path {
+			cycle := append(append([]string{}, l.loading[i:]...), path)
+			return fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	l.loading = append(l.loading, path)
+	return nil
+}
+
+// Leave marks the module entered last as loaded.
+func (l *Loader) Leave() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// Cached returns the value stored for the module at path.
+func (l *Loader) Cached(path string) (any, bool) {
+	value, ok := l.cache[path]
+	return value, ok
+}
+
+// Store caches the result of loading the module at path.
+func (l *Loader) Store(path string, value any) {
+	l.cache[path] = value
+}
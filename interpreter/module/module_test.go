@@ -0,0 +1,107 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.mk":         "",
+		"lib/math.mk":     "",
+		"lib/util.mk":     "",
+		"vendor/util.mk":  "",
+		"vendor/extra.mk": "",
+	})
+	loader := NewLoader(filepath.Join(dir, "vendor"))
+	from := filepath.Join(dir, "lib", "math.mk")
+
+	tests := []struct {
+		from     string
+		path     string
+		expected string
+	}{
+		{from, "util.mk", "lib/util.mk"},
+		{from, "./util.mk", "lib/util.mk"},
+		{from, "util", "lib/util.mk"},
+		{from, "../main.mk", "main.mk"},
+		{from, "extra.mk", "vendor/extra.mk"},
+		{from, filepath.Join(dir, "main.mk"), "main.mk"},
+		{filepath.Join(dir, "main.mk"), "lib/math.mk", "lib/math.mk"},
+	}
+	for _, tt := range tests {
+		resolved, err := loader.Resolve(tt.from, tt.path)
+		if err != nil {
+			t.Errorf("Resolve(%q) returned error: %s", tt.path, err)
+			continue
+		}
+		expected := filepath.Join(dir, tt.expected)
+		if resolved != expected {
+			t.Errorf("Resolve(%q) wrong. want=%q, got=%q", tt.path, expected, resolved)
+		}
+	}
+
+	for _, path := range []string{"./extra.mk", "missing.mk", ""} {
+		if _, err := loader.Resolve(from, path); err == nil {
+			t.Errorf("Resolve(%q) should fail", path)
+		}
+	}
+}
+
+func TestEnterDetectsCycles(t *testing.T) {
+	loader := NewLoader()
+	if err := loader.Enter("/a.mk"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := loader.Enter("/b.mk"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	err := loader.Enter("/a.mk")
+	if err == nil {
+		t.Fatalf("expected import cycle error")
+	}
+	expected := "import cycle: /a.mk -> /b.mk -> /a.mk"
+	if err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err.Error())
+	}
+	loader.Leave()
+	if err := loader.Enter("/b.mk"); err != nil {
+		t.Errorf("unexpected error after Leave: %s", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"ok.mk":  "export let x = 1;",
+		"bad.mk": "let = 1;",
+	})
+	loader := NewLoader()
+	program, err := loader.Parse(filepath.Join(dir, "ok.mk"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(program.Statements) != 1 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+	_, err = loader.Parse(filepath.Join(dir, "bad.mk"))
+	if err == nil || !strings.Contains(err.Error(), "parse errors") {
+		t.Errorf("expected parse error, got=%v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package object
+
+import "fmt"
+
+// Builtins lists the builtin functions in the order the compiler numbers them.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Arity: 1, Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *StringObject:
+				return &Integer{Value: int64(len(arg.Value))}
+			case *ArrayObject:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		}},
+	},
+	{
+		"puts",
+		&Builtin{Arity: -1, IOFn: puts},
+	},
+	{
+		"first",
+		&Builtin{Arity: 1, Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*ArrayObject)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+			return nil
+		}},
+	},
+	{
+		"last",
+		&Builtin{Arity: 1, Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*ArrayObject)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+			return nil
+		}},
+	},
+	{
+		"rest",
+		&Builtin{Arity: 1, Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*ArrayObject)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &ArrayObject{Elements: newElements}
+			}
+			return nil
+		}},
+	},
+	{
+		"push",
+		&Builtin{Arity: 2, Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+			arr := args[0].(*ArrayObject)
+			length := len(arr.Elements)
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+			return &ArrayObject{Elements: newElements}
+		}},
+	},
+	{"json_parse", &Builtin{Arity: 1, Fn: jsonParse}},
+	{"json_stringify", &Builtin{Arity: -1, Fn: jsonStringify}},
+	{"print", &Builtin{Arity: -1, IOFn: printArgs("print", "")}},
+	{"println", &Builtin{Arity: -1, IOFn: printArgs("println", "\n")}},
+	{"read_line", &Builtin{Arity: 0, IOFn: readLine}},
+	{"read_all", &Builtin{Arity: 0, IOFn: readAll}},
+}
+
+// GetBuiltinByName returns the builtin called name, or nil if there is none.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -1,10 +1,28 @@
 package object
 
+import "interpreter/module"
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// file, loader, prelude, meter and io are kept on the root environment
+	// of a module and are shared by every environment enclosed by it.
+	file    string
+	loader  *module.Loader
+	prelude preludeState
+	meter   *Meter
+	io      *IO
 }
 
+type preludeState int
+
+const (
+	preludePending preludeState = iota
+	preludeLoaded
+	preludeDisabled
+)
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
 	return &Environment{store: s}
@@ -16,6 +34,15 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+// NewModuleEnvironment returns the root environment for evaluating the
+// module read from file. Imports inside the module are loaded by loader.
+func NewModuleEnvironment(file string, loader *module.Loader) *Environment {
+	env := NewEnvironment()
+	env.file = file
+	env.loader = loader
+	return env
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
@@ -28,3 +55,82 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// File returns the path of the source file being evaluated, or "" if the
+// code was not read from a file.
+func (e *Environment) File() string {
+	return e.root().file
+}
+
+// Loader returns the module loader used for imports, or nil if none is set.
+func (e *Environment) Loader() *module.Loader {
+	return e.root().loader
+}
+
+// SetLoader sets the module loader used for imports on the root environment.
+func (e *Environment) SetLoader(loader *module.Loader) {
+	e.root().loader = loader
+}
+
+func (e *Environment) root() *Environment {
+	for e.outer != nil {
+		e = e.outer
+	}
+	return e
+}
+
+// NeedsPrelude reports whether the prelude has yet to be loaded into the root
+// environment of e.
+func (e *Environment) NeedsPrelude() bool {
+	return e.root().prelude == preludePending
+}
+
+// MarkPreludeLoaded records that the prelude was loaded into the root
+// environment of e.
+func (e *Environment) MarkPreludeLoaded() {
+	e.root().prelude = preludeLoaded
+}
+
+// DisablePrelude keeps the prelude from being loaded into the root
+// environment of e.
+func (e *Environment) DisablePrelude() {
+	e.root().prelude = preludeDisabled
+}
+
+// PreludeDisabled reports whether DisablePrelude was called on e or an
+// environment sharing its root.
+func (e *Environment) PreludeDisabled() bool {
+	return e.root().prelude == preludeDisabled
+}
+
+// SetLimits makes evaluation in the root environment of e, and in the
+// modules it imports, stop with an error when it exceeds limits.
+func (e *Environment) SetLimits(limits Limits) {
+	e.SetMeter(NewMeter(limits))
+}
+
+// SetMeter sets the meter counting the resources used by evaluation in the
+// root environment of e.
+func (e *Environment) SetMeter(meter *Meter) {
+	e.root().meter = meter
+}
+
+// Meter returns the meter set on the root environment of e, or nil if
+// evaluation is not limited.
+func (e *Environment) Meter() *Meter {
+	return e.root().meter
+}
+
+// SetIO sets the input and output of the builtins called in the root
+// environment of e.
+func (e *Environment) SetIO(io *IO) {
+	e.root().io = io
+}
+
+// IO returns the IO set on the root environment of e, or DefaultIO.
+func (e *Environment) IO() *IO {
+	if io := e.root().io; io != nil {
+		return io
+	}
+	return DefaultIO
+}
@@ -0,0 +1,139 @@
+package object
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// IO is the input and output of a run. The builtins that read and write,
+// such as puts and read_line, use the IO the engine passes them instead of
+// the standard streams of the process, so that hosts can redirect them.
+// The zero IO has no input and discards its output.
+type IO struct {
+	out io.Writer
+	in  *bufio.Reader
+}
+
+// NewIO returns an IO reading from in and writing to out. A nil in or out
+// behaves like the input and output of the zero IO.
+func NewIO(in io.Reader, out io.Writer) *IO {
+	stdio := &IO{out: out}
+	if in != nil {
+		stdio.in = bufio.NewReader(in)
+	}
+	return stdio
+}
+
+// DefaultIO reads from the standard input and writes to the standard output
+// of the process. The engines use it when no IO is set.
+var DefaultIO = NewIO(os.Stdin, os.Stdout)
+
+// ReadLine returns the next line of input without its line ending, or
+// io.EOF at the end of the input.
+func (s *IO) ReadLine() (string, error) {
+	if s.in == nil {
+		return "", io.EOF
+	}
+	line, err := s.in.ReadString('\n')
+	if errors.Is(err, io.EOF) && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// ReadAll returns the rest of the input.
+func (s *IO) ReadAll() (string, error) {
+	if s.in == nil {
+		return "", nil
+	}
+	data, err := io.ReadAll(s.in)
+	return string(data), err
+}
+
+// Write writes p to the output.
+func (s *IO) Write(p []byte) (int, error) {
+	if s.out == nil {
+		return len(p), nil
+	}
+	return s.out.Write(p)
+}
+
+// Call calls b with args, passing stdio, or DefaultIO if it is nil, to a
+// builtin doing input or output.
+func (b *Builtin) Call(stdio *IO, args ...Object) Object {
+	if b.IOFn == nil {
+		return b.Fn(args...)
+	}
+	if stdio == nil {
+		stdio = DefaultIO
+	}
+	return b.IOFn(stdio, args...)
+}
+
+// puts writes each argument on a line of its own.
+func puts(stdio *IO, args ...Object) Object {
+	for _, arg := range args {
+		if _, err := io.WriteString(stdio, inspect(arg)+"\n"); err != nil {
+			return newError("puts: %s", err)
+		}
+	}
+	return nil
+}
+
+// printArgs returns the builtin writing its arguments separated by spaces
+// and followed by end.
+func printArgs(name, end string) func(stdio *IO, args ...Object) Object {
+	return func(stdio *IO, args ...Object) Object {
+		strs := make([]string, len(args))
+		for i, arg := range args {
+			strs[i] = inspect(arg)
+		}
+		if _, err := io.WriteString(stdio, strings.Join(strs, " ")+end); err != nil {
+			return newError("%s: %s", name, err)
+		}
+		return nil
+	}
+}
+
+// inspect returns the Inspect of obj, taking the nil the evaluator yields
+// for statements without a value as NULL.
+func inspect(obj Object) string {
+	if obj == nil {
+		return NULL.Inspect()
+	}
+	return obj.Inspect()
+}
+
+// readLine returns the next line of input, or NULL at the end of the input.
+func readLine(stdio *IO, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	line, err := stdio.ReadLine()
+	if errors.Is(err, io.EOF) {
+		return NULL
+	}
+	if err != nil {
+		return newError("read_line: %s", err)
+	}
+	return &StringObject{Value: line}
+}
+
+// readAll returns the rest of the input.
+func readAll(stdio *IO, args ...Object) Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+	text, err := stdio.ReadAll()
+	if err != nil {
+		return newError("read_all: %s", err)
+	}
+	return &StringObject{Value: text}
+}
@@ -0,0 +1,96 @@
+package object
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestIOReadLine(t *testing.T) {
+	stdio := NewIO(strings.NewReader("one\ntwo\r\n\nlast"), io.Discard)
+	for _, expected := range []string{"one", "two", "", "last"} {
+		line, err := stdio.ReadLine()
+		if err != nil || line != expected {
+			t.Errorf("wrong line. want=%q, got=%q (%v)", expected, line, err)
+		}
+	}
+	if _, err := stdio.ReadLine(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestZeroIO(t *testing.T) {
+	for _, stdio := range []*IO{{}, NewIO(nil, nil)} {
+		if _, err := stdio.ReadLine(); !errors.Is(err, io.EOF) {
+			t.Errorf("expected io.EOF, got %v", err)
+		}
+		if text, err := stdio.ReadAll(); text != "" || err != nil {
+			t.Errorf("expected no input, got %q (%v)", text, err)
+		}
+		tests := []struct {
+			name     string
+			args     []Object
+			expected string // the Inspect of the result
+		}{
+			{"read_line", nil, "null"},
+			{"read_all", nil, ""},
+			{"puts", []Object{TRUE}, "null"},
+		}
+		for _, tt := range tests {
+			result := GetBuiltinByName(tt.name).Call(stdio, tt.args...)
+			if result == nil {
+				result = NULL
+			}
+			if result.Inspect() != tt.expected {
+				t.Errorf("%s: wrong result. want=%q, got=%q", tt.name, tt.expected, result.Inspect())
+			}
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestIOBuiltins(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		args     []Object
+		expected string // the output
+		result   string // the Inspect of the result
+	}{
+		{"puts", "", []Object{&StringObject{Value: "a"}, &Integer{Value: 1}}, "a\n1\n", "null"},
+		{"puts", "", nil, "", "null"},
+		{"puts", "", []Object{nil}, "null\n", "null"},
+		{"print", "", []Object{nil, TRUE}, "null true", "null"},
+		{"print", "", []Object{&StringObject{Value: "a"}, TRUE}, "a true", "null"},
+		{"println", "", nil, "\n", "null"},
+		{"read_line", "a\nb", nil, "", "a"},
+		{"read_line", "", nil, "", "null"},
+		{"read_line", "", []Object{NULL}, "", "ERROR: wrong number of arguments. got=1, want=0"},
+		{"read_all", "a\nb\n", nil, "", "a\nb\n"},
+		{"read_all", "", nil, "", ""},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		result := GetBuiltinByName(tt.name).Call(NewIO(strings.NewReader(tt.input), &out), tt.args...)
+		if result == nil {
+			result = NULL
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", tt.name, tt.expected, out.String())
+		}
+		if result.Inspect() != tt.result {
+			t.Errorf("%s: wrong result. want=%q, got=%q", tt.name, tt.result, result.Inspect())
+		}
+	}
+
+	result := GetBuiltinByName("println").Call(NewIO(strings.NewReader(""), failingWriter{}), TRUE)
+	if err, ok := result.(*Error); !ok || err.Message != "println: closed" {
+		t.Errorf("write error not returned. got=%v", result)
+	}
+}
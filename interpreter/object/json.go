@@ -0,0 +1,256 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonParse implements json_parse(text): JSON objects become hashes with
+// string keys, arrays become arrays, and null, booleans, numbers and
+// strings become NULL, BOOLEAN, INTEGER and STRING. Numbers must be
+// integers that fit an INTEGER.
+func jsonParse(args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	text, ok := args[0].(*StringObject)
+	if !ok {
+		return newError("argument to `json_parse` must be STRING, got %s", args[0].Type())
+	}
+	dec := json.NewDecoder(strings.NewReader(text.Value))
+	dec.UseNumber()
+	value, err := decodeJSON(dec)
+	if err == nil {
+		// only whitespace may follow the value
+		rest := text.Value[dec.InputOffset():]
+		end := len(text.Value) - len(strings.TrimLeft(rest, " \t\r\n"))
+		if _, extra := dec.Token(); extra != io.EOF {
+			err = &jsonError{"unexpected data after the value", int64(end)}
+			if extra != nil {
+				err = extra
+			}
+		}
+	}
+	if err != nil {
+		return newError("json_parse: %s", describeJSONError(err, len(text.Value)))
+	}
+	return value
+}
+
+// jsonError is a decode error at an offset of the input.
+type jsonError struct {
+	msg    string
+	offset int64
+}
+
+func (e *jsonError) Error() string {
+	return e.msg
+}
+
+// describeJSONError returns the message of err with the offset it occurred
+// at in an input of length n.
+func describeJSONError(err error, n int) string {
+	var jsonErr *jsonError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &jsonErr):
+		return jsonErr.msg + " at offset " + strconv.FormatInt(jsonErr.offset, 10)
+	case errors.As(err, &syntaxErr):
+		offset := syntaxErr.Offset
+		if strings.HasPrefix(syntaxErr.Error(), "invalid character") {
+			// Offset counts the invalid character
+			offset--
+		}
+		return syntaxErr.Error() + " at offset " + strconv.FormatInt(offset, 10)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "unexpected end of input at offset " + strconv.Itoa(n)
+	}
+	return err.Error()
+}
+
+func decodeJSON(dec *json.Decoder) (Object, error) {
+	start := dec.InputOffset()
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		if tok {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case string:
+		return &StringObject{Value: tok}, nil
+	case json.Number:
+		value, err := jsonInteger(tok)
+		if err != nil {
+			// the decoder is at the end of the number
+			return nil, &jsonError{err.Error(), dec.InputOffset() - int64(len(tok))}
+		}
+		return &Integer{Value: value}, nil
+	case json.Delim:
+		if tok == '[' {
+			elements := []Object{}
+			for dec.More() {
+				element, err := decodeJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, element)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return &ArrayObject{Elements: elements}, nil
+		}
+		pairs := map[HashKey]HashPair{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := &StringObject{Value: keyTok.(string)}
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key.HashKey()] = HashPair{Key: key, Value: value}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return &HashObject{Pairs: pairs}, nil
+	}
+	return nil, &jsonError{"unexpected token", start}
+}
+
+// jsonInteger returns the value of the JSON number n, which must be an
+// integer such as 12 or 1.2e1 that fits an INTEGER.
+func jsonInteger(n json.Number) (int64, error) {
+	if value, err := n.Int64(); err == nil {
+		return value, nil
+	}
+	f, err := n.Float64()
+	if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, errors.New("number " + n.String() + " is not an INTEGER")
+	}
+	return int64(f), nil
+}
+
+// jsonStringify implements json_stringify(value, options), where the
+// optional options hash may set "pretty" to indent the output by two
+// spaces. The keys of objects are written in sorted order, so that equal
+// hashes stringify alike; setting "sort_keys" to false skips the sort and
+// leaves the order unspecified.
+// Hash keys must be strings; functions and other values that JSON cannot
+// represent are errors.
+func jsonStringify(args ...Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("%s", ArityMismatch(len(args), 1, 2))
+	}
+	pretty, sortKeys := false, true
+	if len(args) == 2 {
+		options, ok := args[1].(*HashObject)
+		if !ok {
+			return newError("options of `json_stringify` must be HASH, got %s", args[1].Type())
+		}
+		for _, pair := range options.Pairs {
+			name, ok := pair.Key.(*StringObject)
+			if !ok {
+				return newError("json_stringify: unknown option %s", pair.Key.Inspect())
+			}
+			enabled, ok := pair.Value.(*Boolean)
+			if !ok {
+				return newError("json_stringify: option %q must be BOOLEAN, got %s", name.Value, pair.Value.Type())
+			}
+			switch name.Value {
+			case "pretty":
+				pretty = enabled.Value
+			case "sort_keys":
+				sortKeys = enabled.Value
+			default:
+				return newError("json_stringify: unknown option %q", name.Value)
+			}
+		}
+	}
+	var out bytes.Buffer
+	if err := encodeJSON(&out, args[0], sortKeys); err != nil {
+		return newError("json_stringify: %s", err)
+	}
+	if pretty {
+		var indented bytes.Buffer
+		json.Indent(&indented, out.Bytes(), "", "  ")
+		out = indented
+	}
+	return &StringObject{Value: out.String()}
+}
+
+func encodeJSON(out *bytes.Buffer, obj Object, sortKeys bool) error {
+	switch obj := obj.(type) {
+	case *Null:
+		out.WriteString("null")
+	case *Boolean:
+		out.WriteString(strconv.FormatBool(obj.Value))
+	case *Integer:
+		out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *StringObject:
+		encodeJSONString(out, obj.Value)
+	case *ArrayObject:
+		out.WriteByte('[')
+		for i, element := range obj.Elements {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			if err := encodeJSON(out, element, sortKeys); err != nil {
+				return err
+			}
+		}
+		out.WriteByte(']')
+	case *HashObject:
+		pairs := make([]HashPair, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			if _, ok := pair.Key.(*StringObject); !ok {
+				return errors.New("hash key must be STRING, got " + string(pair.Key.Type()))
+			}
+			pairs = append(pairs, pair)
+		}
+		if sortKeys {
+			sort.Slice(pairs, func(i, j int) bool {
+				return pairs[i].Key.(*StringObject).Value < pairs[j].Key.(*StringObject).Value
+			})
+		}
+		out.WriteByte('{')
+		for i, pair := range pairs {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			encodeJSONString(out, pair.Key.(*StringObject).Value)
+			out.WriteByte(':')
+			if err := encodeJSON(out, pair.Value, sortKeys); err != nil {
+				return err
+			}
+		}
+		out.WriteByte('}')
+	default:
+		return errors.New("unsupported value " + string(obj.Type()))
+	}
+	return nil
+}
+
+// encodeJSONString writes s as a JSON string, without escaping HTML.
+func encodeJSONString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	// Encode ends the value with a newline
+	out.Truncate(out.Len() - 1)
+}
@@ -0,0 +1,110 @@
+package object
+
+import "testing"
+
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the result stringified with sorted keys, or the error message
+	}{
+		{`null`, `null`},
+		{` true `, `true`},
+		{`-42`, `-42`},
+		{`1.2e1`, `12`},
+		{`"a\"é\n"`, `"a\"é\n"`},
+		{`[]`, `[]`},
+		{`{}`, `{}`},
+		{`{"b": [1, {"c": null}], "a": false}`, `{"a":false,"b":[1,{"c":null}]}`},
+		{`{"a": 1, "a": 2}`, `{"a":2}`},
+		{``, `json_parse: unexpected end of input at offset 0`},
+		{`[1,`, `json_parse: unexpected end of JSON input at offset 3`},
+		{`[1}`, `json_parse: invalid character '}' after array element at offset 2`},
+		{`{"a" 1}`, `json_parse: invalid character '1' after object key at offset 5`},
+		{`{1: 2}`, `json_parse: object member name must be a string at offset 2`},
+		{`[1, 2.5]`, `json_parse: number 2.5 is not an INTEGER at offset 4`},
+		{`99999999999999999999`, `json_parse: number 99999999999999999999 is not an INTEGER at offset 0`},
+		{`1 2`, `json_parse: unexpected data after the value at offset 2`},
+		{"[] \n x", `json_parse: invalid character 'x' looking for beginning of value at offset 5`},
+	}
+	sorted := &HashObject{Pairs: map[HashKey]HashPair{}}
+	key := &StringObject{Value: "sort_keys"}
+	sorted.Pairs[key.HashKey()] = HashPair{Key: key, Value: TRUE}
+	for _, tt := range tests {
+		result := jsonParse(&StringObject{Value: tt.input})
+		if err, ok := result.(*Error); ok {
+			if err.Message != tt.expected {
+				t.Errorf("json_parse(%q): wrong error. want=%q, got=%q", tt.input, tt.expected, err.Message)
+			}
+			continue
+		}
+		got := jsonStringify(result, sorted)
+		if str, ok := got.(*StringObject); !ok || str.Value != tt.expected {
+			t.Errorf("json_parse(%q): wrong result. want=%s, got=%s", tt.input, tt.expected, got.Inspect())
+		}
+	}
+	if jsonParse(&StringObject{Value: "true"}) != TRUE || jsonParse(&StringObject{Value: "null"}) != NULL {
+		t.Errorf("json_parse does not return the singletons")
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	hash := func(pairs ...Object) *HashObject {
+		h := &HashObject{Pairs: map[HashKey]HashPair{}}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Pairs[pairs[i].(Hashable).HashKey()] = HashPair{Key: pairs[i], Value: pairs[i+1]}
+		}
+		return h
+	}
+	str := func(s string) *StringObject { return &StringObject{Value: s} }
+	value := hash(
+		str("b"), &ArrayObject{Elements: []Object{&Integer{Value: 1}, NULL, str("<x>")}},
+		str("a"), hash(),
+		str("c"), FALSE,
+	)
+	tests := []struct {
+		args     []Object
+		expected string // the result or the error message
+	}{
+		{[]Object{&Integer{Value: -7}}, `-7`},
+		{[]Object{str("tab\t\"quote\"")}, `"tab\t\"quote\""`},
+		{[]Object{&ArrayObject{}}, `[]`},
+		{[]Object{value}, `{"a":{},"b":[1,null,"<x>"],"c":false}`},
+		{[]Object{value, hash(str("sort_keys"), TRUE)}, `{"a":{},"b":[1,null,"<x>"],"c":false}`},
+		{[]Object{value, hash(str("pretty"), TRUE)}, `{
+  "a": {},
+  "b": [
+    1,
+    null,
+    "<x>"
+  ],
+  "c": false
+}`},
+		{[]Object{hash(str("a"), TRUE), hash(str("pretty"), FALSE)}, `{"a":true}`},
+		{[]Object{}, `wrong number of arguments. got=0, want=1..2`},
+		{[]Object{NULL, &Integer{Value: 1}}, "options of `json_stringify` must be HASH, got INTEGER"},
+		{[]Object{NULL, hash(str("indent"), TRUE)}, `json_stringify: unknown option "indent"`},
+		{[]Object{NULL, hash(str("pretty"), str("yes"))}, `json_stringify: option "pretty" must be BOOLEAN, got STRING`},
+		{[]Object{hash(&Integer{Value: 1}, TRUE)}, `json_stringify: hash key must be STRING, got INTEGER`},
+		{[]Object{&ArrayObject{Elements: []Object{&Builtin{}}}}, `json_stringify: unsupported value BUILTIN`},
+	}
+	for _, tt := range tests {
+		switch result := jsonStringify(tt.args...).(type) {
+		case *StringObject:
+			if result.Value != tt.expected {
+				t.Errorf("wrong result. want=%s, got=%s", tt.expected, result.Value)
+			}
+		case *Error:
+			if result.Message != tt.expected {
+				t.Errorf("wrong error. want=%q, got=%q", tt.expected, result.Message)
+			}
+		default:
+			t.Errorf("unexpected result %s", result.Inspect())
+		}
+	}
+
+	// without sorting, the order of the keys is unspecified
+	result := jsonStringify(hash(str("x"), &Integer{Value: 1}, str("y"), &Integer{Value: 2}), hash(str("sort_keys"), FALSE)).(*StringObject).Value
+	if result != `{"x":1,"y":2}` && result != `{"y":2,"x":1}` {
+		t.Errorf("wrong result %s", result)
+	}
+}
@@ -0,0 +1,122 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Limits bounds the resources a program may use, so that untrusted scripts
+// cannot hang or exhaust the host. A zero field sets no limit.
+type Limits struct {
+	// MaxSteps limits the number of nodes the evaluator evaluates or the
+	// number of instructions the VM executes.
+	MaxSteps int64
+	// MaxCallDepth limits the number of nested function calls. Tail calls
+	// do not nest.
+	MaxCallDepth int
+	// MaxAllocated limits the approximate number of bytes allocated for
+	// values, as estimated by SizeOf.
+	MaxAllocated int64
+	// Context stops the program when it is canceled.
+	Context context.Context
+}
+
+// The errors a program stops with when it exceeds a limit. When Context is
+// canceled the error wraps both ErrCanceled and the error of the context.
+var (
+	ErrStepLimit       = errors.New("step limit exceeded")
+	ErrCallDepthLimit  = errors.New("call depth limit exceeded")
+	ErrAllocationLimit = errors.New("allocation limit exceeded")
+	ErrCanceled        = errors.New("execution canceled")
+)
+
+// contextCheckInterval is the number of steps between checks of the
+// context, which are slower than counting.
+const contextCheckInterval = 1024
+
+// Meter counts the resources a program uses against its Limits. The methods
+// of a nil Meter never fail, so engines can call them without checking
+// whether limits are set.
+type Meter struct {
+	limits    Limits
+	steps     int64
+	depth     int
+	allocated int64
+}
+
+// NewMeter returns a Meter enforcing limits.
+func NewMeter(limits Limits) *Meter {
+	return &Meter{limits: limits}
+}
+
+// Step counts one step.
+func (m *Meter) Step() error {
+	if m == nil {
+		return nil
+	}
+	m.steps++
+	if m.limits.MaxSteps > 0 && m.steps > m.limits.MaxSteps {
+		return ErrStepLimit
+	}
+	if ctx := m.limits.Context; ctx != nil && m.steps%contextCheckInterval == 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %w", ErrCanceled, err)
+		}
+	}
+	return nil
+}
+
+// Steps returns the number of steps counted so far.
+func (m *Meter) Steps() int64 {
+	if m == nil {
+		return 0
+	}
+	return m.steps
+}
+
+// Enter counts a function call, which Leave ends.
+func (m *Meter) Enter() error {
+	if m == nil {
+		return nil
+	}
+	if m.limits.MaxCallDepth > 0 && m.depth >= m.limits.MaxCallDepth {
+		return ErrCallDepthLimit
+	}
+	m.depth++
+	return nil
+}
+
+// Leave ends a call counted by Enter.
+func (m *Meter) Leave() {
+	if m != nil && m.depth > 0 {
+		m.depth--
+	}
+}
+
+// Allocate counts the allocation of obj.
+func (m *Meter) Allocate(obj Object) error {
+	if m == nil {
+		return nil
+	}
+	m.allocated += SizeOf(obj)
+	if m.limits.MaxAllocated > 0 && m.allocated > m.limits.MaxAllocated {
+		return ErrAllocationLimit
+	}
+	return nil
+}
+
+// SizeOf estimates the bytes allocated for obj itself, not counting the
+// values it refers to.
+func SizeOf(obj Object) int64 {
+	const header = 16
+	switch obj := obj.(type) {
+	case *StringObject:
+		return header + int64(len(obj.Value))
+	case *ArrayObject:
+		return header + 16*int64(len(obj.Elements))
+	case *HashObject:
+		return header + 48*int64(len(obj.Pairs))
+	}
+	return header
+}
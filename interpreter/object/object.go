@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"hash/fnv"
 	"interpreter/ast"
+	"interpreter/diagnostic"
+	"interpreter/token"
 	"strings"
 )
 
@@ -14,6 +16,13 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// Indexable is implemented by values other than arrays and hashes that
+// support the index operator, such as values of the host program. Index
+// returns the value at key, or an *Error.
+type Indexable interface {
+	Index(key Object) Object
+}
+
 const (
 	INTEGER_OBJ           = "INTEGER"
 	BOOLEAN_OBJ           = "BOOLEAN"
@@ -26,6 +35,17 @@ const (
 	ARRAY_OBJ             = "ARRAY"
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	QUOTE_OBJ             = "QUOTE"
+	MACRO_OBJ             = "MACRO"
+	TAIL_CALL_OBJ         = "TAIL_CALL"
+)
+
+// The only values of BOOLEAN and NULL. The engines compare them by identity,
+// so builtins must not create others.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
 )
 
 type BuiltinFunction func(args ...Object) Object
@@ -34,6 +54,12 @@ var _ Object = (*Builtin)(nil)
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// IOFn is set instead of Fn for builtins doing input or output, which
+	// the engines pass the IO of the run, see Call.
+	IOFn func(stdio *IO, args ...Object) Object
+	// Arity is the number of arguments the builtin takes, or -1 if it
+	// takes any number of arguments.
+	Arity int
 }
 
 // Inspect implements Object.
@@ -107,10 +133,47 @@ func (r *ReturnObject) Type() ObjectType {
 	return RETURN_OBJ
 }
 
+var _ Object = (*TailCall)(nil)
+
+// TailCall is what the evaluator returns for a call in tail position
+// instead of making the call. The caller of the function the call was made
+// from applies it, so tail calls do not grow the Go stack. Frame describes
+// the call for the stack of an error it returns.
+type TailCall struct {
+	Function  Object
+	Arguments []Object
+	Frame     StackFrame
+}
+
+// Inspect implements Object.
+func (t *TailCall) Inspect() string {
+	return "tail call " + t.Frame.Function
+}
+
+// Type implements Object.
+func (t *TailCall) Type() ObjectType {
+	return TAIL_CALL_OBJ
+}
+
 var _ Object = (*Error)(nil)
 
 type Error struct {
 	Message string
+	// Stack holds the calls the error propagated through, innermost first.
+	Stack []StackFrame
+	// Err is the Go error that stopped the program, such as ErrStepLimit,
+	// or nil for errors raised by the program itself.
+	Err error
+	// Pos is the position of the expression that raised the error in File,
+	// or zero if it is unknown.
+	Pos  token.Position
+	File string
+}
+
+// StackFrame is one function call on an error's call stack.
+type StackFrame struct {
+	Function string         // callee name, or "fn@line:col" for anonymous functions
+	CallSite token.Position // position of the call expression
 }
 
 // Inspect implements Object.
@@ -119,6 +182,31 @@ func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
 
+// Traceback formats the call stack with the most recent call last.
+func (e *Error) Traceback() string {
+	if len(e.Stack) == 0 {
+		return ""
+	}
+	var out bytes.Buffer
+	out.WriteString("Traceback (most recent call last):\n")
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		frame := e.Stack[i]
+		fmt.Fprintf(&out, "  line %s, in %s\n", frame.CallSite, frame.Function)
+	}
+	return out.String()
+}
+
+// Diagnostic returns e as a diagnostic pointing at where it was raised, with
+// the calls it propagated through as notes.
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	d := diagnostic.Errorf(diagnostic.Runtime, diagnostic.At(e.Pos), "%s", e.Message)
+	d.File, d.Err = e.File, e.Err
+	for _, frame := range e.Stack {
+		d.Notes = append(d.Notes, fmt.Sprintf("in %s, called at %s", frame.Function, frame.CallSite))
+	}
+	return d
+}
+
 // Type implements Object.
 func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
@@ -128,8 +216,12 @@ var _ Object = (*FunctionObject)(nil)
 
 type FunctionObject struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // defaults of the last len(Defaults) parameters
+	Rest       *ast.Identifier  // collects extra arguments if not nil
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Pos        token.Position // position of the function literal
+	Name       string         // empty for anonymous functions
 }
 
 // Inspect implements Object.
@@ -137,10 +229,21 @@ func (f *FunctionObject) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
+	firstDefault := len(f.Parameters) - len(f.Defaults)
+	for i, p := range f.Parameters {
+		if i >= firstDefault {
+			params = append(params, p.String()+" = "+f.Defaults[i-firstDefault].String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
 	out.WriteString("fn")
+	if f.Name != "" {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(")")
@@ -262,11 +365,38 @@ var _ Object = (*CompiledFunction)(nil)
 type CompiledFunction struct {
 	Instructions  []byte
 	NumLocals     int
-	NumParameters int
+	NumParameters int // named parameters, not counting a rest parameter
+
+	// NumDefaults is the number of trailing parameters with a default. The
+	// defaults are computed by code at the start of Instructions, and
+	// DefaultEntries[i] is the offset execution starts at when the last
+	// NumDefaults-i parameters are missing. A call passing all parameters
+	// starts at DefaultEntries[NumDefaults].
+	NumDefaults    int
+	DefaultEntries []int
+	// Variadic functions take the arguments after NumParameters as an array
+	// in the local slot following the parameters.
+	Variadic bool
+	Name     string // empty for anonymous functions
+
+	// Positions holds where the instructions that can fail were compiled
+	// from, ordered by offset, and File the path of their source file.
+	Positions []InstructionPosition
+	File      string
+}
+
+// InstructionPosition records that the instruction at Offset was compiled
+// from the expression at Pos.
+type InstructionPosition struct {
+	Offset int
+	Pos    token.Position
 }
 
 // Inspect implements Object.
 func (c *CompiledFunction) Inspect() string {
+	if c.Name != "" {
+		return fmt.Sprintf("CompiledFunction[%s]", c.Name)
+	}
 	return fmt.Sprintf("CompiledFunction[%p]", c)
 }
 
@@ -274,3 +404,83 @@ func (c *CompiledFunction) Inspect() string {
 func (c *CompiledFunction) Type() ObjectType {
 	return COMPILED_FUNCTION_OBJ
 }
+
+// ArityMismatch returns the message of the error raised when a function
+// taking from min to max arguments is passed got arguments. A max of -1
+// means the function is variadic.
+func ArityMismatch(got, min, max int) string {
+	switch {
+	case max < 0:
+		return fmt.Sprintf("wrong number of arguments. got=%d, want>=%d", got, min)
+	case min != max:
+		return fmt.Sprintf("wrong number of arguments. got=%d, want=%d..%d", got, min, max)
+	}
+	return fmt.Sprintf("wrong number of arguments. got=%d, want=%d", got, min)
+}
+
+// SameValue reports whether a and b are of the same type and equal, as a
+// literal pattern and the value it matches must be. Unlike the == operator,
+// it does not fail for values of different types.
+func SameValue(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *StringObject:
+		b, ok := b.(*StringObject)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	}
+	return a == b
+}
+
+var _ Object = (*Quote)(nil)
+
+// Quote holds an unevaluated AST node, as returned by quote(expr).
+type Quote struct {
+	Node ast.Node
+}
+
+// Inspect implements Object.
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Type implements Object.
+func (q *Quote) Type() ObjectType {
+	return QUOTE_OBJ
+}
+
+var _ Object = (*Macro)(nil)
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Inspect implements Object.
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	out.WriteString(m.Body.String())
+	return out.String()
+}
+
+// Type implements Object.
+func (m *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
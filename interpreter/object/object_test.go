@@ -20,3 +20,28 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestSameValue(t *testing.T) {
+	fn := &Builtin{}
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{&Integer{Value: 1}, &Integer{Value: 2}, false},
+		{&Integer{Value: 1}, &StringObject{Value: "1"}, false},
+		{&StringObject{Value: "a"}, &StringObject{Value: "a"}, true},
+		{TRUE, &Boolean{Value: true}, true},
+		{TRUE, FALSE, false},
+		{NULL, &Null{}, true},
+		{NULL, FALSE, false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+		{&ArrayObject{}, &ArrayObject{}, false},
+	}
+	for _, tt := range tests {
+		if got := SameValue(tt.a, tt.b); got != tt.expected {
+			t.Errorf("SameValue(%s, %s): want=%t, got=%t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package optimizer simplifies programs before they are run. Every rewrite
+// keeps the result of a program the same in the evaluator and the VM.
+package optimizer
+
+import (
+	"strconv"
+
+	"interpreter/ast"
+	"interpreter/token"
+)
+
+// Options selects the optimizations Optimize performs.
+type Options struct {
+	// FoldConstants replaces arithmetic, comparisons and string
+	// concatenation of literals with their result.
+	FoldConstants bool
+	// SimplifyConditionals replaces if expressions with a literal condition
+	// by the branch that is taken.
+	SimplifyConditionals bool
+	// RemoveUnreachable drops the statements following a return statement.
+	RemoveUnreachable bool
+}
+
+// All enables every optimization.
+var All = Options{FoldConstants: true, SimplifyConditionals: true, RemoveUnreachable: true}
+
+// Optimize rewrites program in place and returns it.
+func Optimize(program *ast.Program, opts Options) *ast.Program {
+	if opts == (Options{}) {
+		return program
+	}
+	return ast.Modify(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.InfixExpression:
+			if opts.FoldConstants {
+				return foldInfix(node)
+			}
+		case *ast.PrefixExpression:
+			if opts.FoldConstants {
+				return foldPrefix(node)
+			}
+		case *ast.IfExpression:
+			if opts.SimplifyConditionals {
+				return simplifyIf(node)
+			}
+		case *ast.Program:
+			node.Statements = optimizeStatements(node.Statements, opts)
+		case *ast.BlockStatement:
+			node.Statements = optimizeStatements(node.Statements, opts)
+		}
+		return node
+	}).(*ast.Program)
+}
+
+// foldInfix evaluates an operator applied to two literals the way both
+// engines would. Operations that fail at run time, such as division by zero
+// or mixing types, are left for the engines to report.
+func foldInfix(node *ast.InfixExpression) ast.Expression {
+	pos := node.Token.Pos
+	switch left := node.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := node.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return node
+		}
+		switch node.Operator {
+		case "+":
+			return integer(left.Value+right.Value, pos)
+		case "-":
+			return integer(left.Value-right.Value, pos)
+		case "*":
+			return integer(left.Value*right.Value, pos)
+		case "/":
+			if right.Value != 0 {
+				return integer(left.Value/right.Value, pos)
+			}
+		case "<":
+			return boolean(left.Value < right.Value, pos)
+		case ">":
+			return boolean(left.Value > right.Value, pos)
+		case "==":
+			return boolean(left.Value == right.Value, pos)
+		case "!=":
+			return boolean(left.Value != right.Value, pos)
+		}
+	case *ast.Boolean:
+		right, ok := node.Right.(*ast.Boolean)
+		if !ok {
+			return node
+		}
+		switch node.Operator {
+		case "==":
+			return boolean(left.Value == right.Value, pos)
+		case "!=":
+			return boolean(left.Value != right.Value, pos)
+		}
+	case *ast.StringLiteral:
+		right, ok := node.Right.(*ast.StringLiteral)
+		if ok && node.Operator == "+" {
+			value := left.Value + right.Value
+			return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: value, Pos: pos}, Value: value}
+		}
+	}
+	return node
+}
+
+// foldPrefix folds the negation of an integer and of a boolean, and the !
+// of an integer or string, which is false.
+func foldPrefix(node *ast.PrefixExpression) ast.Expression {
+	switch right := node.Right.(type) {
+	case *ast.IntegerLiteral:
+		if node.Operator == "-" {
+			return integer(-right.Value, node.Token.Pos)
+		}
+		return boolean(false, node.Token.Pos)
+	case *ast.StringLiteral:
+		if node.Operator == "!" {
+			return boolean(false, node.Token.Pos)
+		}
+	case *ast.Boolean:
+		if node.Operator == "!" {
+			return boolean(!right.Value, node.Token.Pos)
+		}
+	}
+	return node
+}
+
+// simplifyIf replaces an if expression whose branch is known by the value
+// of that branch when it is a single expression. Other constant if
+// expressions in statement position are handled by optimizeStatements.
+func simplifyIf(node *ast.IfExpression) ast.Expression {
+	taken, ok := takenBranch(node)
+	if !ok || taken == nil || len(taken.Statements) != 1 {
+		return node
+	}
+	if stmt, ok := taken.Statements[0].(*ast.ExpressionStatement); ok {
+		return stmt.Expression
+	}
+	return node
+}
+
+// takenBranch returns the branch of node that runs if its condition is a
+// literal, which is nil for a false condition without an else branch.
+func takenBranch(node *ast.IfExpression) (*ast.BlockStatement, bool) {
+	var truthy bool
+	switch cond := node.Condition.(type) {
+	case *ast.Boolean:
+		truthy = cond.Value
+	case *ast.IntegerLiteral, *ast.StringLiteral:
+		truthy = true
+	default:
+		return nil, false
+	}
+	if truthy {
+		return node.Then, true
+	}
+	return node.Else, true
+}
+
+// optimizeStatements replaces constant if statements by the statements of
+// the branch taken and drops the statements after a return.
+func optimizeStatements(stmts []ast.Statement, opts Options) []ast.Statement {
+	result := []ast.Statement{}
+	for i, stmt := range stmts {
+		last := i == len(stmts)-1
+		if opts.SimplifyConditionals {
+			if branch, ok := inlinableBranch(stmt, last); ok {
+				result = append(result, branch...)
+				continue
+			}
+		}
+		result = append(result, stmt)
+	}
+	if !opts.RemoveUnreachable {
+		return result
+	}
+	for i, stmt := range result {
+		if _, ok := stmt.(*ast.ReturnStatement); !ok {
+			continue
+		}
+		// declared functions are hoisted, so they are reachable
+		reachable := result[:i+1]
+		for _, after := range result[i+1:] {
+			if _, ok := after.(*ast.FunctionStatement); ok {
+				reachable = append(reachable, after)
+			}
+		}
+		return reachable
+	}
+	return result
+}
+
+// inlinableBranch returns the statements that replace stmt if it is an if
+// expression with a literal condition. The branch must not declare
+// functions, which would then be hoisted further. If stmt is the last
+// statement its value is the value of the block, so the replacement must end
+// in an expression or return statement as well.
+func inlinableBranch(stmt ast.Statement, last bool) ([]ast.Statement, bool) {
+	exprStmt, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+	ifExpr, ok := exprStmt.Expression.(*ast.IfExpression)
+	if !ok {
+		return nil, false
+	}
+	taken, ok := takenBranch(ifExpr)
+	if !ok {
+		return nil, false
+	}
+	if taken == nil || len(taken.Statements) == 0 {
+		return nil, !last
+	}
+	for _, s := range taken.Statements {
+		if _, ok := s.(*ast.FunctionStatement); ok {
+			return nil, false
+		}
+	}
+	if last {
+		switch taken.Statements[len(taken.Statements)-1].(type) {
+		case *ast.ExpressionStatement, *ast.ReturnStatement:
+		default:
+			return nil, false
+		}
+	}
+	return taken.Statements, true
+}
+
+func integer(value int64, pos token.Position) *ast.IntegerLiteral {
+	literal := strconv.FormatInt(value, 10)
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: literal, Pos: pos}, Value: value}
+}
+
+func boolean(value bool, pos token.Position) *ast.Boolean {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+	if value {
+		tok = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
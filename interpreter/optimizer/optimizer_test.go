@@ -0,0 +1,112 @@
+package optimizer
+
+import (
+	"testing"
+
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(10 - 4) / 2 == 3", "true"},
+		{"-(2 - 5)", "3"},
+		{"!(1 == 1)", "false"},
+		{"true != false", "true"},
+		{`"a" + "b" + c`, "(ab + c)"},
+		{"x + 1 + 2", "((x + 1) + 2)"},
+		{"10 / 0", "(10 / 0)"},
+		{"1 + true", "(1 + true)"},
+		{"!5", "false"},
+		{"!\"\"", "false"},
+		{"if (1 < 2) { a } else { b }", "a"},
+		{"if (false) { a }; b", "b"},
+		{"if (false) { a }", "iffalse {\na\n}"},
+		{"if (true) { let x = 1; x }", "let x = 1;x"},
+		{"if (true) { let x = 1; }", "iftrue {\nlet x = 1;\n}"},
+		{"if (true) { let x = 1; }; 2", "let x = 1;2"},
+		{"if (true) { fn g() { 1 } g() }", "iftrue {\nfn g(){\n1\n}g()\n}"},
+		{"if (x) { 1 + 1 } else { 2 }", "ifx {\n2\n}else{\n2\n}"},
+		{"let f = fn() { return 1; 2; fn g() { 3 } }", "let f = fn(){\nreturn 1;fn g(){\n3\n}\n};"},
+		{"let f = fn() { if (true) { return 1; } 2 }", "let f = fn(){\nreturn 1;\n};"},
+	}
+	for _, tt := range tests {
+		program := Optimize(parse(t, tt.input), All)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	input := "if (true) { 1 + 1 }; return 3; 4"
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{}, "iftrue {\n(1 + 1)\n}return 3;4"},
+		{Options{FoldConstants: true}, "iftrue {\n2\n}return 3;4"},
+		{Options{SimplifyConditionals: true}, "(1 + 1)return 3;4"},
+		{Options{RemoveUnreachable: true}, "iftrue {\n(1 + 1)\n}return 3;"},
+		{All, "2return 3;"},
+	}
+	for _, tt := range tests {
+		program := Optimize(parse(t, input), tt.opts)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %+v. want=%q, got=%q", tt.opts, tt.expected, program.String())
+		}
+	}
+}
+
+func TestResultsUnchanged(t *testing.T) {
+	inputs := []string{
+		"1 + 2 * 3",
+		"(10 - 4) / 2 == 3",
+		`"foo" + "bar"`,
+		"-(5 - 10)",
+		"!(1 < 2)",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (true) { let x = 5; x * 2 }",
+		"if (false) { 1 }; 5",
+		"let x = if (false) { 1 }; x",
+		`if ("") { 1 } else { 2 }`,
+		"if (0) { 1 } else { 2 }",
+		"let f = fn() { if (true) { return 1; } 2 }; f()",
+		"let f = fn() { return 3; 4 }; f()",
+		"let f = fn() { return g(); fn g() { 7 } }; f()",
+		"let f = fn(n) { if (true) { n } }; f(4)",
+		`match (1 + 1) { 2 => "two", _ => "other" }`,
+		"let a = [1 + 1, 2 * 2]; a[3 - 2]",
+		"1 + true",
+	}
+	for _, input := range inputs {
+		want := eval(parse(t, input))
+		got := eval(Optimize(parse(t, input), All))
+		if want.Inspect() != got.Inspect() {
+			t.Errorf("result of %q changed. want=%s, got=%s", input, want.Inspect(), got.Inspect())
+		}
+	}
+}
+
+func eval(program *ast.Program) object.Object {
+	env := object.NewEnvironment()
+	env.DisablePrelude()
+	return evaluator.Eval(program, env)
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
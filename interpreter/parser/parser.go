@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 	"interpreter/token"
 	"strconv"
@@ -43,6 +44,16 @@ type Parser struct {
 	curToken  token.Token
 	peekToken token.Token
 	errors    []string
+	diags     diagnostic.List
+	depth     int // nesting depth of block statements
+
+	// braces holds the positions of the braces open at curToken. recovering
+	// is set from an error until the parser resynchronizes at the end of the
+	// statement, and errors reported meanwhile are dropped. reported holds
+	// the positions of the errors reported so far.
+	braces     []token.Position
+	recovering bool
+	reported   map[token.Position]bool
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -52,6 +63,7 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:              l,
 		errors:         []string{},
+		reported:       map[token.Position]bool{},
 		prefixParseFns: map[token.TokenType]prefixParseFn{},
 		infixParseFns:  map[token.TokenType]infixParseFn{},
 	}
@@ -66,9 +78,12 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -111,6 +126,15 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+	if !p.expectToken(token.STRING) {
+		return nil
+	}
+	exp.Path = p.curToken.Literal
+	return exp
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 	p.nextToken()
@@ -159,12 +183,24 @@ func (p *Parser) registerInfix(ty token.TokenType, fn infixParseFn) {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	switch {
+	case p.curTokenIs(token.LBRACE):
+		p.braces = append(p.braces, p.curToken.Pos)
+	case p.curTokenIs(token.RBRACE) && len(p.braces) > 0:
+		p.braces = p.braces[:len(p.braces)-1]
+	}
 }
 
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Diagnostics returns the errors as diagnostics pointing at the tokens they
+// were reported at.
+func (p *Parser) Diagnostics() diagnostic.List {
+	return p.diags
+}
+
 // ParseProgram
 // program:= statement*
 func (p *Parser) ParseProgram() *ast.Program {
@@ -172,7 +208,11 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
+		start := p.curToken
 		stmt := p.parseStatement()
+		if p.recovering {
+			stmt = p.recover(start, 0)
+		}
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -181,39 +221,133 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// recover skips the rest of a statement that failed to parse, which began
+// with start in a block with level braces open, and returns a BadStatement
+// in its place. It stops at the end of the statement: at a semicolon, in
+// front of a statement keyword or of the closing brace of the block, or at
+// that brace if the error was reported on it.
+func (p *Parser) recover(start token.Token, level int) ast.Statement {
+	for !p.curTokenIs(token.EOF) && len(p.braces) >= level {
+		if len(p.braces) == level {
+			if p.curTokenIs(token.SEMICOLON) {
+				break
+			}
+			if (level > 0 && p.peekTokenIs(token.RBRACE)) || p.peekTokenIs(token.EOF) ||
+				p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN) || p.peekTokenIs(token.EXPORT) {
+				break
+			}
+		}
+		p.nextToken()
+	}
+	p.recovering = false
+	return &ast.BadStatement{Token: start, End: p.curToken.Pos}
+}
+
 // parseStatement
-// statement:=letStatement | returnStatement | expressionStatement
+// statement:=letStatement | exportStatement | returnStatement | expressionStatement
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 // parseLetStatement
-// letStatement:= "=" expression ";"
+// letStatement:= "let" (identifier | arrayPattern | hashPattern) "=" expression ";"
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.curToken}
-	if !p.expectToken(token.IDENT) {
+	switch {
+	case p.peekTokenIs(token.LBRACKET):
+		p.nextToken()
+		stmt.Pattern = p.parseArrayPattern()
+	case p.peekTokenIs(token.LBRACE):
+		p.nextToken()
+		stmt.Pattern = p.parseHashPattern()
+	case p.expectToken(token.IDENT):
+		stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	default:
+		return nil
+	}
+	if stmt.Name == nil && stmt.Pattern == nil {
 		return nil
 	}
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	if !p.expectToken(token.ASSIGN) {
 		return nil
 	}
 	p.nextToken()
 	stmt.Value = p.parseExpression(LOWEST)
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+		fn.Name = stmt.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
 
+// parseFunctionStatement
+// functionStatement:= "fn" identifier "(" parameters ")" blockStatement
+func (p *Parser) parseFunctionStatement() *ast.FunctionStatement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	fn, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	fn.Token = stmt.Token
+	fn.Name = stmt.Name.Value
+	stmt.Function = fn
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 	return stmt
 }
 
+// parseExportStatement
+// exportStatement:= "export" (letStatement | functionStatement)
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.curToken}
+	if p.depth > 0 {
+		p.error("export is only allowed at the top level of a module")
+		return nil
+	}
+	if p.peekTokenIs(token.FUNCTION) {
+		p.nextToken()
+		if !p.peekTokenIs(token.IDENT) {
+			p.peekError(token.IDENT)
+			return nil
+		}
+		fn := p.parseFunctionStatement()
+		if fn == nil {
+			return nil
+		}
+		stmt.Statement = fn
+		return stmt
+	}
+	if !p.expectToken(token.LET) {
+		return nil
+	}
+	let := p.parseLetStatement()
+	if let == nil {
+		return nil
+	}
+	stmt.Statement = let
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
@@ -263,7 +397,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.error(msg)
 		return nil
 	}
 
@@ -340,14 +474,28 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	p.depth++
+	defer func() { p.depth-- }()
+	level := len(p.braces)
 	p.nextToken()
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		start := p.curToken
 		stmt := p.parseStatement()
+		if p.recovering {
+			stmt = p.recover(start, level)
+		}
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
+		if len(p.braces) < level {
+			// the statement ended at the closing brace of the block
+			break
+		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.error("unexpected end of input, expected RBRACE")
+	}
 	return block
 }
 
@@ -356,6 +504,22 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectToken(token.LPAREN) {
 		return nil
 	}
+	if !p.parseParameterList(expression) {
+		return nil
+	}
+	if !p.expectToken(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+	ast.MarkTailCalls(expression)
+	return expression
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	expression := &ast.MacroLiteral{Token: p.curToken}
+	if !p.expectToken(token.LPAREN) {
+		return nil
+	}
 	expression.Parameters = p.parseFunctionParameters()
 	if !p.expectToken(token.LBRACE) {
 		return nil
@@ -364,6 +528,46 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return expression
 }
 
+// parseParameterList parses the parameters of fn up to the closing paren:
+// names, then names with defaults, then an optional ...rest.
+func (p *Parser) parseParameterList(fn *ast.FunctionLiteral) bool {
+	fn.Parameters = []*ast.Identifier{}
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectToken(token.IDENT) {
+				return false
+			}
+			fn.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			// the rest parameter must be the last one
+			break
+		}
+		if !p.curTokenIs(token.IDENT) {
+			p.error(fmt.Sprintf("expected a parameter name, got %s instead", p.curToken.Type))
+			return false
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		fn.Parameters = append(fn.Parameters, ident)
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			value := p.parseExpression(LOWEST)
+			if value == nil {
+				return false
+			}
+			fn.Defaults = append(fn.Defaults, value)
+		} else if len(fn.Defaults) > 0 {
+			msg := fmt.Sprintf("parameter %s without default follows a parameter with default", ident.Value)
+			p.error(msg)
+			return false
+		}
+		if !p.peekTokenIs(token.RPAREN) && !p.expectToken(token.COMMA) {
+			return false
+		}
+	}
+	return p.expectToken(token.RPAREN)
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 	if p.peekTokenIs(token.RPAREN) {
@@ -420,10 +624,34 @@ func (p *Parser) expectToken(t token.TokenType) bool {
 }
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected  next token to be %s,got %s insted,value %s", t, p.peekToken.Type, p.peekToken.Literal)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekToken, msg)
 }
 
 func (p *Parser) noPrefixParseError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
+	p.error(msg)
+}
+
+// error reports msg at the current token.
+func (p *Parser) error(msg string) {
+	p.errorAt(p.curToken, msg)
+}
+
+// errorAt reports msg at tok and starts recovering. Errors reported while
+// recovering, which mostly follow from the first one, are dropped, and so
+// are further errors at a position that already has one.
+func (p *Parser) errorAt(tok token.Token, msg string) {
+	if p.recovering || p.reported[tok.Pos] {
+		return
+	}
+	p.reported[tok.Pos] = true
 	p.errors = append(p.errors, msg)
+	d := diagnostic.Errorf(diagnostic.Syntax, diagnostic.TokenSpan(tok), "%s", msg)
+	if tok.Type == token.EOF && len(p.braces) > 0 {
+		brace := diagnostic.At(p.braces[len(p.braces)-1])
+		brace.Label = "unclosed brace"
+		d.Secondary = append(d.Secondary, brace)
+	}
+	p.diags = append(p.diags, d)
+	p.recovering = true
 }
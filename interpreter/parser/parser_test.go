@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
 	"interpreter/token"
 	"testing"
@@ -328,6 +329,38 @@ func TestFunctionalLiteralParsing(t *testing.T) {
 	}
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
+func TestMacroLiteralParsing(t *testing.T) {
+	input := "macro(x, y) { x + y; }"
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got = %T", program.Statements[0])
+	}
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got = %T", stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got = %d", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got = %d", len(macro.Body.Statements))
+	}
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got = %T", macro.Body.Statements[0])
+	}
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -514,6 +547,283 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestImportExpression(t *testing.T) {
+	input := `let lib = import "lib/math.mk";`
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+	stmt := program.Statements[0].(*ast.LetStatement)
+	imp, ok := stmt.Value.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("exp is not ast.ImportExpression. got = %T", stmt.Value)
+	}
+	if imp.Path != "lib/math.mk" {
+		t.Errorf("imp.Path not %q. got = %q", "lib/math.mk", imp.Path)
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let answer = 42;`
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExportStatement. got = %T", program.Statements[0])
+	}
+	if !testLetStatement(t, stmt.Statement, "answer") {
+		return
+	}
+	if names := stmt.Names(); len(names) != 1 || names[0] != "answer" {
+		t.Errorf("stmt.Names() wrong. got = %v", names)
+	}
+}
+
+func TestExportOnlyAtTopLevel(t *testing.T) {
+	input := `fn() { export let x = 1; }`
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser error for nested export")
+	}
+	if p.Errors()[0] != "export is only allowed at the top level of a module" {
+		t.Errorf("wrong error. got = %q", p.Errors()[0])
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) { 1 => "one", -1 => "minus one", [a, ...rest] if a > 0 => rest, {"k": [_], name} => name, _ => 0, }`
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got = %T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got = %T", stmt.Expression)
+	}
+	testIdentifier(t, exp.Subject, "x")
+
+	expectedArms := []struct {
+		pattern string
+		guard   string
+		body    string
+	}{
+		{"1", "", "one"},
+		{"(-1)", "", "minus one"},
+		{"[a, ...rest]", "(a > 0)", "rest"},
+		{"{k:[_], name}", "", "name"},
+		{"_", "", "0"},
+	}
+	if len(exp.Arms) != len(expectedArms) {
+		t.Fatalf("wrong number of arms. want=%d, got=%d", len(expectedArms), len(exp.Arms))
+	}
+	for i, want := range expectedArms {
+		arm := exp.Arms[i]
+		if arm.Pattern.String() != want.pattern {
+			t.Errorf("arm %d: wrong pattern. want=%q, got=%q", i, want.pattern, arm.Pattern.String())
+		}
+		guard := ""
+		if arm.Guard != nil {
+			guard = arm.Guard.String()
+		}
+		if guard != want.guard {
+			t.Errorf("arm %d: wrong guard. want=%q, got=%q", i, want.guard, guard)
+		}
+		if arm.Body.String() != want.body {
+			t.Errorf("arm %d: wrong body. want=%q, got=%q", i, want.body, arm.Body.String())
+		}
+	}
+
+	array := exp.Arms[2].Pattern.(*ast.ArrayPattern)
+	if _, ok := array.Rest.(*ast.BindingPattern); !ok {
+		t.Errorf("rest is not ast.BindingPattern. got = %T", array.Rest)
+	}
+	hash := exp.Arms[3].Pattern.(*ast.HashPattern)
+	if key, ok := hash.Keys[1].(*ast.StringLiteral); !ok || key.Value != "name" {
+		t.Errorf("shorthand key is not string \"name\". got = %s", hash.Keys[1])
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      string
+		expectedNames []string
+	}{
+		{"let [a, b] = x;", "let [a, b] = x;", []string{"a", "b"}},
+		{"let [a, ...rest] = x;", "let [a, ...rest] = x;", []string{"a", "rest"}},
+		{"let [a, b = 1 + 2, ..._] = x;", "let [a, b = (1 + 2), ..._] = x;", []string{"a", "b"}},
+		{"let {name, age} = person;", "let {name, age} = person;", []string{"name", "age"}},
+		{"let {name, age = 3} = person;", "let {name, age = 3} = person;", []string{"name", "age"}},
+		{`let {"info": {age}, "tags": [t, ...ts]} = person;`, "let {info:{age}, tags:[t, ...ts]} = person;", []string{"age", "t", "ts"}},
+		{`let [a, [b, c = a]] = x;`, "let [a, [b, c = a]] = x;", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got = %T", program.Statements[0])
+		}
+		if stmt.Name != nil || stmt.Pattern == nil {
+			t.Fatalf("let statement is not destructuring. name=%v, pattern=%v", stmt.Name, stmt.Pattern)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, stmt.String())
+		}
+		if fmt.Sprint(stmt.Names()) != fmt.Sprint(tt.expectedNames) {
+			t.Errorf("wrong names. want=%v, got=%v", tt.expectedNames, stmt.Names())
+		}
+	}
+}
+
+func TestMatchPatternErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { fn => 1 }`, "expected a pattern, got FUNCTION instead"},
+		{`match (x) { [...1] => 1 }`, "expected a name after ..., got INT instead"},
+		{`match (x) { [...a, b] => 1 }`, "expected  next token to be RBRACKET,got COMMA insted,value ,"},
+		{`match (x) { {[1]: a} => 1 }`, "expected a hash pattern key, got LBRACKET instead"},
+		{`match (x) { 1 -> 1 }`, "expected  next token to be ARROW,got MINUS insted,value -"},
+		{`let [a = ] = x`, "no prefix parse function for RBRACKET found"},
+		{`let 5 = x`, "expected  next token to be IDENT,got INT insted,value 5"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser error for %q", tt.input)
+			continue
+		}
+		if p.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, p.Errors()[0])
+		}
+	}
+}
+
+func TestFunctionParameterDefaultsAndRest(t *testing.T) {
+	tests := []struct {
+		input        string
+		expected     string
+		numDefaults  int
+		expectedRest string
+	}{
+		{"fn(a, b = 2) { a }", "fn(a,b = 2){\na\n}", 1, ""},
+		{"fn(a = 1, b = a * 2) { b }", "fn(a = 1,b = (a * 2)){\nb\n}", 2, ""},
+		{"fn(...rest) { rest }", "fn(...rest){\nrest\n}", 0, "rest"},
+		{"fn(a, b = 2, ...rest) { rest }", "fn(a,b = 2,...rest){\nrest\n}", 1, "rest"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		fn, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got = %T", stmt.Expression)
+		}
+		if fn.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, fn.String())
+		}
+		if len(fn.Defaults) != tt.numDefaults {
+			t.Errorf("wrong number of defaults. want=%d, got=%d", tt.numDefaults, len(fn.Defaults))
+		}
+		rest := ""
+		if fn.Rest != nil {
+			rest = fn.Rest.Value
+		}
+		if rest != tt.expectedRest {
+			t.Errorf("wrong rest parameter. want=%q, got=%q", tt.expectedRest, rest)
+		}
+	}
+}
+
+func TestFunctionStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		name     string
+	}{
+		{"fn add(a, b) { a + b }", "fn add(a,b){\n(a + b)\n}", "add"},
+		{"fn f(x = 1, ...r) { x };", "fn f(x = 1,...r){\nx\n}", "f"},
+		{"export fn id(x) { x }", "export fn id(x){\nx\n}", "id"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		if program.Statements[0].String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, program.Statements[0].String())
+		}
+		stmt := program.Statements[0]
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+		fn, ok := stmt.(*ast.FunctionStatement)
+		if !ok {
+			t.Fatalf("statement is not ast.FunctionStatement. got = %T", stmt)
+		}
+		if fn.Name.Value != tt.name || fn.Function.Name != tt.name {
+			t.Errorf("wrong name. want=%q, got=%q and %q", tt.name, fn.Name.Value, fn.Function.Name)
+		}
+	}
+
+	p := NewParser(lexer.NewLexer("let f = fn() { 1 }; fn() { 2 }"))
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+	if name := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Name; name != "f" {
+		t.Errorf("let-bound function has wrong name. want=%q, got=%q", "f", name)
+	}
+	if _, ok := program.Statements[1].(*ast.ExpressionStatement); !ok {
+		t.Errorf("anonymous function is not an expression statement. got = %T", program.Statements[1])
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) { a }", "parameter b without default follows a parameter with default"},
+		{"fn(1) { 1 }", "expected a parameter name, got INT instead"},
+		{"fn(...rest, a) { a }", "expected  next token to be RPAREN,got COMMA insted,value ,"},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser error for %q", tt.input)
+			continue
+		}
+		if p.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, p.Errors()[0])
+		}
+	}
+}
+
 func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
 	ident, ok := exp.(*ast.Identifier)
 	if !ok {
@@ -635,3 +945,121 @@ func checkParseErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input      string
+		errors     []string
+		statements []string // the String of every statement
+	}{
+		{
+			"let x 5; let y = ; let z = 3;",
+			[]string{"expected  next token to be ASSIGN,got INT insted,value 5", "no prefix parse function for SEMICOLON found"},
+			[]string{"<bad statement>", "<bad statement>", "let z = 3;"},
+		},
+		{
+			"foo(1 +, 2); let ok = 1;",
+			[]string{"no prefix parse function for COMMA found"},
+			[]string{"<bad statement>", "let ok = 1;"},
+		},
+		{
+			"let f = fn() { let = 1; 2 }; f()",
+			[]string{"expected  next token to be IDENT,got ASSIGN insted,value ="},
+			[]string{"let f = fn(){\n<bad statement>2\n};", "f()"},
+		},
+		{
+			"if (x) { 1 + } let y = 2;",
+			[]string{"no prefix parse function for RBRACE found"},
+			[]string{"ifx {\n<bad statement>\n}", "let y = 2;"},
+		},
+		{
+			`let f = fn() { let h = {"a" 1}; h }; f()`,
+			[]string{"expected  next token to be COLON,got INT insted,value 1"},
+			[]string{"let f = fn(){\n<bad statement>h\n};", "f()"},
+		},
+		{
+			"let a = 1; } let b = 2;",
+			[]string{"no prefix parse function for RBRACE found"},
+			[]string{"let a = 1;", "<bad statement>", "let b = 2;"},
+		},
+		{
+			"fn f(a b) { a }\nlet c = 1",
+			[]string{"expected  next token to be COMMA,got IDENT insted,value b"},
+			[]string{"<bad statement>", "let c = 1;"},
+		},
+		{
+			"let x = if (a { 1 } else { 2 };\nlet y = x;",
+			[]string{"expected  next token to be RPAREN,got LBRACE insted,value {"},
+			[]string{"<bad statement>", "let y = x;"},
+		},
+		{
+			"match (x) { 1 => , 2 => 3 }; let z = 1;",
+			[]string{"no prefix parse function for COMMA found"},
+			[]string{"<bad statement>", "let z = 1;"},
+		},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		if fmt.Sprintf("%q", p.Errors()) != fmt.Sprintf("%q", tt.errors) {
+			t.Errorf("%q: wrong errors.\nwant=%q\ngot=%q", tt.input, tt.errors, p.Errors())
+		}
+		statements := []string{}
+		for _, stmt := range program.Statements {
+			statements = append(statements, stmt.String())
+		}
+		if fmt.Sprintf("%q", statements) != fmt.Sprintf("%q", tt.statements) {
+			t.Errorf("%q: wrong statements.\nwant=%q\ngot=%q", tt.input, tt.statements, statements)
+		}
+	}
+}
+
+func TestBadStatementSpan(t *testing.T) {
+	p := NewParser(lexer.NewLexer("let x = 1;\nlet y 2 + 3;\nx"))
+	program := p.ParseProgram()
+	bad, ok := program.Statements[1].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.BadStatement. got=%T", program.Statements[1])
+	}
+	start, end := token.Position{Offset: 11, Line: 2, Column: 1}, token.Position{Offset: 22, Line: 2, Column: 12}
+	if bad.Token.Pos != start || bad.End != end {
+		t.Errorf("wrong span. want=%s-%s, got=%s-%s", start, end, bad.Token.Pos, bad.End)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input     string
+		primary   string // start-end of the primary span
+		secondary []string
+	}{
+		{"let = 5", "1:5-1:6", nil},
+		{"let x = 5 +;", "1:12-1:13", nil},
+		{"let x = \"a\" + ;", "1:15-1:16", nil},
+		{"if (x) {\n  let y = 1;\n", "3:1-0:0", []string{"1:8 unclosed brace"}},
+		{"fn f() { if (x) { 1 }", "1:22-0:0", []string{"1:8 unclosed brace"}},
+	}
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+		diags := p.Diagnostics()
+		if len(diags) != 1 || len(p.Errors()) != 1 {
+			t.Errorf("wrong number of diagnostics for %q. got=%v", tt.input, diags)
+			continue
+		}
+		d := diags[0]
+		if d.Code != diagnostic.Syntax || d.Message != p.Errors()[0] {
+			t.Errorf("wrong diagnostic for %q: %s", tt.input, d)
+		}
+		if got := d.Primary.Start.String() + "-" + d.Primary.End.String(); got != tt.primary {
+			t.Errorf("wrong primary span for %q. want=%s, got=%s", tt.input, tt.primary, got)
+		}
+		var secondary []string
+		for _, span := range d.Secondary {
+			secondary = append(secondary, span.Start.String()+" "+span.Label)
+		}
+		if fmt.Sprint(secondary) != fmt.Sprint(tt.secondary) {
+			t.Errorf("wrong secondary spans for %q. want=%q, got=%q", tt.input, tt.secondary, secondary)
+		}
+	}
+}
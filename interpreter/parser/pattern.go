@@ -0,0 +1,176 @@
+package parser
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/token"
+)
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.curToken}
+	if !p.expectToken(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+	if !p.expectToken(token.RPAREN) {
+		return nil
+	}
+	if !p.expectToken(token.LBRACE) {
+		return nil
+	}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectToken(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectToken(token.RBRACE) {
+		return nil
+	}
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+	if !p.expectToken(token.ARROW) {
+		return nil
+	}
+	p.nextToken()
+	arm.Body = p.parseExpression(LOWEST)
+	if arm.Body == nil {
+		return nil
+	}
+	return arm
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		if p.curToken.Literal == "_" {
+			return &ast.WildcardPattern{Token: p.curToken}
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		return &ast.BindingPattern{Token: p.curToken, Name: ident}
+	case token.INT, token.STRING, token.TRUE, token.FALSE:
+		tok := p.curToken
+		value := p.prefixParseFns[tok.Type]()
+		if value == nil {
+			return nil
+		}
+		return &ast.LiteralPattern{Token: tok, Value: value}
+	case token.MINUS:
+		tok := p.curToken
+		if !p.expectToken(token.INT) {
+			return nil
+		}
+		right := p.parseIntegerLiteral()
+		if right == nil {
+			return nil
+		}
+		value := &ast.PrefixExpression{Token: tok, Operator: "-", Right: right}
+		return &ast.LiteralPattern{Token: tok, Value: value}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+	p.error(fmt.Sprintf("expected a pattern, got %s instead", p.curToken.Type))
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.curTokenIs(token.IDENT) {
+				p.error(fmt.Sprintf("expected a name after ..., got %s instead", p.curToken.Type))
+				return nil
+			}
+			pattern.Rest = p.parsePattern()
+			// the rest pattern must be the last element
+			break
+		}
+		element := p.parseDefaultPattern(p.parsePattern())
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectToken(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectToken(token.RBRACKET) {
+		return nil
+	}
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.curToken}
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		var key ast.Expression
+		var value ast.Pattern
+		switch p.curToken.Type {
+		case token.IDENT:
+			// {name} is short for {"name": name}
+			key = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+			value = p.parsePattern()
+		case token.INT, token.STRING, token.TRUE, token.FALSE:
+			key = p.prefixParseFns[p.curToken.Type]()
+			if !p.expectToken(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value = p.parsePattern()
+		default:
+			p.error(fmt.Sprintf("expected a hash pattern key, got %s instead", p.curToken.Type))
+			return nil
+		}
+		value = p.parseDefaultPattern(value)
+		if key == nil || value == nil {
+			return nil
+		}
+		pattern.Keys = append(pattern.Keys, key)
+		pattern.Values = append(pattern.Values, value)
+		if !p.peekTokenIs(token.RBRACE) && !p.expectToken(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectToken(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
+
+// parseDefaultPattern wraps pattern in a DefaultPattern if it is followed by
+// `= default`.
+func (p *Parser) parseDefaultPattern(pattern ast.Pattern) ast.Pattern {
+	if pattern == nil || !p.peekTokenIs(token.ASSIGN) {
+		return pattern
+	}
+	p.nextToken()
+	tok := p.curToken
+	p.nextToken()
+	value := p.parseExpression(LOWEST)
+	if value == nil {
+		return nil
+	}
+	return &ast.DefaultPattern{Token: tok, Pattern: pattern, Default: value}
+}
@@ -0,0 +1,43 @@
+// Package prelude embeds the standard library that both engines load before
+// running user code. It is written in Monkey and defines:
+//
+//	map(arr, f)             apply f to every element
+//	filter(arr, pred)       the elements for which pred is truthy
+//	reduce(arr, initial, f) fold arr from the left with f(acc, element)
+//	any(arr, pred)          whether pred holds for some element
+//	all(arr, pred)          whether pred holds for every element
+//	contains(arr, x)        whether some element equals x
+//	reverse(arr)            the elements in reverse order
+//	concat(a, b)            the elements of a followed by those of b
+//	take(arr, n)            the first n elements
+//	drop(arr, n)            all but the first n elements
+//	range(start, end)       the integers from start up to but excluding end
+//	zip(a, b)               pairs [a[i], b[i]] up to the shorter length
+//	sum(arr)                the sum of an array of integers
+//	join(arr, sep)          the strings of arr separated by sep
+//	repeat(s, n)            the string s repeated n times
+//
+// Bindings starting with an underscore are helpers and not part of the API.
+package prelude
+
+import (
+	_ "embed"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"strings"
+)
+
+//go:embed prelude.mk
+var Source string
+
+// Parse returns a fresh AST of the prelude. The prelude is compiled into the
+// binary, so a parse error is a bug and panics.
+func Parse() *ast.Program {
+	p := parser.NewParser(lexer.NewLexer(Source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		panic("prelude: " + strings.Join(p.Errors(), "; "))
+	}
+	return program
+}
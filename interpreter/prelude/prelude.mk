@@ -0,0 +1,84 @@
+let _map = fn(arr, f, acc) {
+  if (len(arr) == 0) { return acc; }
+  _map(rest(arr), f, push(acc, f(first(arr))))
+};
+let map = fn(arr, f) { _map(arr, f, []) };
+
+let _filter = fn(arr, pred, acc) {
+  if (len(arr) == 0) { return acc; }
+  let x = first(arr);
+  if (pred(x)) { _filter(rest(arr), pred, push(acc, x)) } else { _filter(rest(arr), pred, acc) }
+};
+let filter = fn(arr, pred) { _filter(arr, pred, []) };
+
+let reduce = fn(arr, initial, f) {
+  if (len(arr) == 0) { return initial; }
+  reduce(rest(arr), f(initial, first(arr)), f)
+};
+
+let any = fn(arr, pred) {
+  if (len(arr) == 0) { return false; }
+  if (pred(first(arr))) { return true; }
+  any(rest(arr), pred)
+};
+
+let all = fn(arr, pred) {
+  if (len(arr) == 0) { return true; }
+  if (pred(first(arr))) { all(rest(arr), pred) } else { false }
+};
+
+let contains = fn(arr, x) {
+  if (len(arr) == 0) { return false; }
+  if (first(arr) == x) { return true; }
+  contains(rest(arr), x)
+};
+
+let _reverse = fn(arr, i, acc) {
+  if (i < 0) { return acc; }
+  _reverse(arr, i - 1, push(acc, arr[i]))
+};
+let reverse = fn(arr) { _reverse(arr, len(arr) - 1, []) };
+
+let concat = fn(a, b) { reduce(b, a, push) };
+
+let _take = fn(arr, n, acc) {
+  if (len(arr) == 0) { return acc; }
+  if (n < 1) { return acc; }
+  _take(rest(arr), n - 1, push(acc, first(arr)))
+};
+let take = fn(arr, n) { _take(arr, n, []) };
+
+let drop = fn(arr, n) {
+  if (len(arr) == 0) { return arr; }
+  if (n < 1) { return arr; }
+  drop(rest(arr), n - 1)
+};
+
+let _range = fn(i, end, acc) {
+  if (i < end) { _range(i + 1, end, push(acc, i)) } else { acc }
+};
+let range = fn(start, end) { _range(start, end, []) };
+
+let _zip = fn(a, b, acc) {
+  if (len(a) == 0) { return acc; }
+  if (len(b) == 0) { return acc; }
+  _zip(rest(a), rest(b), push(acc, [first(a), first(b)]))
+};
+let zip = fn(a, b) { _zip(a, b, []) };
+
+let _add = fn(a, b) { a + b };
+let sum = fn(arr) { reduce(arr, 0, _add) };
+
+let _join = fn(arr, sep, acc) {
+  if (len(arr) == 0) { return acc; }
+  _join(rest(arr), sep, acc + sep + first(arr))
+};
+let join = fn(arr, sep) {
+  if (len(arr) == 0) { return ""; }
+  _join(rest(arr), sep, first(arr))
+};
+
+let repeat = fn(s, n) {
+  if (n < 1) { return ""; }
+  s + repeat(s, n - 1)
+};
@@ -1,10 +1,11 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
+	"interpreter/diagnostic"
 	"interpreter/evaluator"
 	"interpreter/lexer"
+	"interpreter/module"
 	"interpreter/object"
 	"interpreter/parser"
 	"io"
@@ -13,24 +14,42 @@ import (
 const PROMPT = ">>"
 
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	StartWithEnvironment(in, out, object.NewEnvironment())
+}
+
+// StartWithEnvironment runs the REPL evaluating every line in env. The
+// lines the programs read and the output they write share in and out.
+func StartWithEnvironment(in io.Reader, out io.Writer, env *object.Environment) {
+	stdio := object.NewIO(in, out)
+	env.SetIO(stdio)
+	if env.Loader() == nil {
+		env.SetLoader(module.NewLoader(module.SearchPathFromEnv()...))
+	}
+	macroEnv := object.NewEnvironment()
 	for {
 		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := stdio.ReadLine()
+		if err != nil {
 			return
 		}
-		line := scanner.Text()
 		l := lexer.NewLexer(line)
 		p := parser.NewParser(l)
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, p.Diagnostics(), line)
+			continue
+		}
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, err.Error()+"\n")
 			continue
 		}
-		evaluated := evaluator.Eval(program, env)
+		evaluated := evaluator.Eval(expanded, env)
 		if evaluated != nil {
+			if err, ok := evaluated.(*object.Error); ok {
+				io.WriteString(out, err.Traceback())
+			}
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
@@ -38,8 +57,9 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// printParserErrors writes diags with the line they were found in.
+func printParserErrors(out io.Writer, diags diagnostic.List, line string) {
+	for _, d := range diags {
+		d.Render(out, line)
 	}
 }
@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
@@ -22,6 +24,9 @@ const (
 	LE = "LE"
 	GE = "GE"
 
+	ARROW    = "ARROW"
+	ELLIPSIS = "ELLIPSIS"
+
 	COMMA     = "COMMA"
 	SEMICOLON = "SEMICOLON"
 	COLON     = "COLON"
@@ -39,6 +44,10 @@ const (
 	RETURN   = "RETURN"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	MACRO    = "MACRO"
+	MATCH    = "MATCH"
 )
 
 var keywords = map[string]TokenType{
@@ -49,12 +58,29 @@ var keywords = map[string]TokenType{
 	"return": RETURN,
 	"true":   TRUE,
 	"false":  FALSE,
+	"import": IMPORT,
+	"export": EXPORT,
+	"macro":  MACRO,
+	"match":  MATCH,
 }
 
 type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is the location of the first character of a token in the source.
+// Line and Column start at 1, Offset is the byte offset from the start of input.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 func NewToken(ty TokenType, val string) Token {
@@ -37,40 +37,103 @@ const (
 	OpReturn
 	OpSetLocal
 	OpGetLocal
+	// OpImport operands are the constant index of a module's function and the
+	// global slot that caches the module's exports.
+	OpImport
+	OpGetBuiltin
+	// The OpMatch opcodes test the shape of a value for match expressions and
+	// push a boolean instead of failing on values of an unexpected type.
+	// OpMatchValue pops two values and pushes whether they are of the same
+	// type and equal. OpMatchArray pops a value and pushes whether it is an
+	// array with at least as many elements as its first operand and at most
+	// as many as its second; a second operand of MatchArrayUnbounded sets no
+	// upper limit. OpMatchHash pops a value and pushes whether it is a hash.
+	OpMatchValue
+	OpMatchArray
+	OpMatchHash
+	// OpHasKey pops a key and a hash and pushes whether the hash has the key.
+	// OpHasIndex pops an index and an array and pushes whether the index is
+	// in bounds.
+	OpHasKey
+	OpHasIndex
+	// OpSliceFrom pops an array and pushes a new array of its elements
+	// starting at the operand.
+	OpSliceFrom
+	// OpMatchFail pops the value a destructuring let failed to match and
+	// stops the VM with an error naming the pattern in the constant at the
+	// operand.
+	OpMatchFail
+	// OpTailCall calls a function like OpCall from tail position. A compiled
+	// function replaces the current frame instead of pushing a new one; any
+	// other callee is called like OpCall and the result returned by the
+	// instructions that follow.
+	OpTailCall
+	// OpJumpIfTrue pops a value and jumps to the operand if it is truthy,
+	// which is when OpBang followed by OpJumpNotTruthy would jump. Optimize
+	// emits it for that pair.
+	OpJumpIfTrue
+	// OpLessThan pops two values and pushes whether the first is less than
+	// the second.
+	OpLessThan
+	// OpHalt pops a value and ends the program with it as the result. The
+	// compiler emits it for return statements of the main program, which
+	// has no caller for OpReturnValue to return to.
+	OpHalt
+	// OpCurrentFunction pushes the function the current frame runs, which
+	// lets a function declared inside another one call itself.
+	OpCurrentFunction
 )
 
+// MatchArrayUnbounded is the second operand of OpMatchArray for array
+// patterns with a rest element.
+const MatchArrayUnbounded = 65535
+
 type Definition struct {
 	Name          string
 	OpearndWidths []int
 }
 
 var definitions = map[Opcode]*Definition{
-	OpConstant:      {"OpConstant", []int{2}},
-	OpAdd:           {"OpAdd", []int{}},
-	OpSub:           {"OpSub", []int{}},
-	OpMul:           {"OpMul", []int{}},
-	OpDiv:           {"OpDiv", []int{}},
-	OpPop:           {"OpPop", []int{}},
-	OpFalse:         {"OpFalse", []int{}},
-	OpTrue:          {"OpTrue", []int{}},
-	OpEqual:         {"OpEqual", []int{}},
-	OpNotEqual:      {"OpNotEqual", []int{}},
-	OpGreaterThan:   {"OpGreaterThan", []int{}},
-	OpBang:          {"OpBang", []int{}},
-	OpMinus:         {"OpMinus", []int{}},
-	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
-	OpJump:          {"OpJump", []int{2}},
-	OpNull:          {"OpNull", []int{}},
-	OpGetGlobal:     {"OpGetGlobal", []int{2}},
-	OpSetGlobal:     {"OpSetGlobal", []int{2}},
-	OpArray:         {"OpArray", []int{2}},
-	OpHash:          {"OpHash", []int{2}},
-	OpIndex:         {"OpIndex", []int{}},
-	OpCall:          {"OpCall", []int{1}},
-	OpReturnValue:   {"OpReturnValue", []int{}},
-	OpReturn:        {"OpReturn", []int{}},
-	OpSetLocal:      {"OpSetLocal", []int{1}},
-	OpGetLocal:      {"OpGetLocal", []int{1}},
+	OpConstant:        {"OpConstant", []int{2}},
+	OpAdd:             {"OpAdd", []int{}},
+	OpSub:             {"OpSub", []int{}},
+	OpMul:             {"OpMul", []int{}},
+	OpDiv:             {"OpDiv", []int{}},
+	OpPop:             {"OpPop", []int{}},
+	OpFalse:           {"OpFalse", []int{}},
+	OpTrue:            {"OpTrue", []int{}},
+	OpEqual:           {"OpEqual", []int{}},
+	OpNotEqual:        {"OpNotEqual", []int{}},
+	OpGreaterThan:     {"OpGreaterThan", []int{}},
+	OpBang:            {"OpBang", []int{}},
+	OpMinus:           {"OpMinus", []int{}},
+	OpJumpNotTruthy:   {"OpJumpNotTruthy", []int{2}},
+	OpJump:            {"OpJump", []int{2}},
+	OpNull:            {"OpNull", []int{}},
+	OpGetGlobal:       {"OpGetGlobal", []int{2}},
+	OpSetGlobal:       {"OpSetGlobal", []int{2}},
+	OpArray:           {"OpArray", []int{2}},
+	OpHash:            {"OpHash", []int{2}},
+	OpIndex:           {"OpIndex", []int{}},
+	OpCall:            {"OpCall", []int{1}},
+	OpReturnValue:     {"OpReturnValue", []int{}},
+	OpReturn:          {"OpReturn", []int{}},
+	OpSetLocal:        {"OpSetLocal", []int{1}},
+	OpGetLocal:        {"OpGetLocal", []int{1}},
+	OpImport:          {"OpImport", []int{2, 2}},
+	OpGetBuiltin:      {"OpGetBuiltin", []int{1}},
+	OpMatchValue:      {"OpMatchValue", []int{}},
+	OpMatchArray:      {"OpMatchArray", []int{2, 2}},
+	OpMatchHash:       {"OpMatchHash", []int{}},
+	OpHasKey:          {"OpHasKey", []int{}},
+	OpHasIndex:        {"OpHasIndex", []int{}},
+	OpSliceFrom:       {"OpSliceFrom", []int{2}},
+	OpMatchFail:       {"OpMatchFail", []int{2}},
+	OpTailCall:        {"OpTailCall", []int{1}},
+	OpJumpIfTrue:      {"OpJumpIfTrue", []int{2}},
+	OpLessThan:        {"OpLessThan", []int{}},
+	OpHalt:            {"OpHalt", []int{}},
+	OpCurrentFunction: {"OpCurrentFunction", []int{}},
 }
 
 func LookUp(op byte) (*Definition, error) {
@@ -87,10 +150,7 @@ func Make(op Opcode, operands ...int) []byte {
 	if !ok {
 		return []byte{}
 	}
-	instructionLen := 1
-	for _, w := range def.OpearndWidths {
-		instructionLen += w
-	}
+	instructionLen := 1 + def.Width()
 	instruction := make([]byte, instructionLen)
 	instruction[0] = byte(op)
 
@@ -114,9 +174,14 @@ func (ins Instructions) String() string {
 	for i < len(ins) {
 		def, err := LookUp(ins[i])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
 			continue
 		}
+		if i+1+def.Width() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: %s truncated\n", i, def.Name)
+			break
+		}
 		operands, read := ReadOperands(def, ins[i+1:])
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 		i += 1 + read
@@ -132,13 +197,20 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
 	}
 
-	switch operandCount {
-	case 0:
-		return def.Name
-	case 1:
-		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	out := def.Name
+	for _, operand := range operands {
+		out += fmt.Sprintf(" %d", operand)
+	}
+	return out
+}
+
+// Width returns the number of bytes the operands of the instruction take.
+func (def *Definition) Width() int {
+	width := 0
+	for _, w := range def.OpearndWidths {
+		width += w
 	}
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+	return width
 }
 
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
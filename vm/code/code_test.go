@@ -14,6 +14,7 @@ func TestMake(t *testing.T) {
 		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpImport, []int{1, 258}, []byte{byte(OpImport), 0, 1, 1, 2}},
 	}
 
 	for _, tt := range tests {
@@ -37,6 +38,8 @@ func TestReadOperands(t *testing.T) {
 	}{
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
+		{OpImport, []int{65535, 1}, 4},
+		{OpMatchArray, []int{258, 1}, 4},
 	}
 
 	for _, tt := range tests {
@@ -64,11 +67,15 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpAdd),
 		Make(OpConstant, 2),
 		Make(OpConstant, 65535),
+		Make(OpImport, 3, 257),
+		Make(OpCall, 1),
 	}
 	expectedStrs := []string{
 		"0000 OpAdd",
 		"0001 OpConstant 2",
 		"0004 OpConstant 65535",
+		"0007 OpImport 3 257",
+		"0012 OpCall 1",
 	}
 	expected := strings.Join(expectedStrs, "\n") + "\n"
 	concatted := Instructions{}
@@ -81,3 +88,18 @@ func TestInstructionsString(t *testing.T) {
 		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", expected, concatted.String())
 	}
 }
+
+func TestInstructionsStringInvalid(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{Instructions{255, byte(OpPop)}, "0000 ERROR: opcode 255 undefined\n0001 OpPop\n"},
+		{Instructions{byte(OpPop), byte(OpConstant), 1}, "0000 OpPop\n0001 ERROR: OpConstant truncated\n"},
+	}
+	for _, tt := range tests {
+		if tt.ins.String() != tt.expected {
+			t.Errorf("wrong string for %v.\nwant=%q\ngot=%q", []byte(tt.ins), tt.expected, tt.ins.String())
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package code
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+type instruction struct {
+	op       Opcode
+	operands []int
+	offset   int // offset in the instructions the list was decoded from
+	removed  bool
+}
+
+// Optimize applies peephole optimizations to ins until none applies:
+//
+//   - jumps to an OpJump go to its target instead,
+//   - an OpJump to an OpReturnValue or OpReturn is replaced by the return,
+//   - an OpJump to the next instruction is removed,
+//   - OpTrue followed by OpJumpNotTruthy is removed,
+//   - OpFalse or OpNull followed by OpJumpNotTruthy become an OpJump,
+//   - OpBang followed by OpJumpNotTruthy becomes an OpJumpIfTrue.
+//
+// The jump targets in the result are relocated, as are entries, offsets
+// of instructions referred to from outside ins, such as the DefaultEntries
+// of a CompiledFunction, which execution can start at, or the offsets of
+// its Positions. ins itself is left unchanged. Instructions that do
+// not decode are returned as they are.
+func Optimize(ins Instructions, entries []int) (Instructions, []int) {
+	for {
+		list, err := decode(ins, entries)
+		if err != nil {
+			return ins, entries
+		}
+		if !rewrite(list, entries) {
+			return ins, entries
+		}
+		ins, entries = encode(list, len(ins), entries)
+	}
+}
+
+func isJump(op Opcode) bool {
+	return op == OpJump || op == OpJumpNotTruthy || op == OpJumpIfTrue
+}
+
+// decode splits ins into instructions and checks that every jump and entry
+// lands on one of them or at the end.
+func decode(ins Instructions, entries []int) ([]instruction, error) {
+	list := []instruction{}
+	boundaries := map[int]bool{len(ins): true}
+	for i := 0; i < len(ins); {
+		def, err := LookUp(ins[i])
+		if err != nil {
+			return nil, err
+		}
+		if i+1+def.Width() > len(ins) {
+			return nil, fmt.Errorf("truncated %s at %d", def.Name, i)
+		}
+		operands, read := ReadOperands(def, ins[i+1:])
+		list = append(list, instruction{op: Opcode(ins[i]), operands: operands, offset: i})
+		boundaries[i] = true
+		i += 1 + read
+	}
+	for _, in := range list {
+		if isJump(in.op) && !boundaries[in.operands[0]] {
+			return nil, fmt.Errorf("jump at %d into an instruction", in.offset)
+		}
+	}
+	for _, e := range entries {
+		if !boundaries[e] {
+			return nil, fmt.Errorf("entry %d inside an instruction", e)
+		}
+	}
+	return list, nil
+}
+
+// rewrite applies one round of optimizations to list and reports whether it
+// changed anything.
+func rewrite(list []instruction, entries []int) bool {
+	at := make(map[int]int, len(list))
+	targets := make(map[int]bool, len(entries))
+	for i, in := range list {
+		at[in.offset] = i
+		if isJump(in.op) {
+			targets[in.operands[0]] = true
+		}
+	}
+	for _, e := range entries {
+		targets[e] = true
+	}
+
+	changed := false
+	for i := range list {
+		in := &list[i]
+		if isJump(in.op) {
+			target := in.operands[0]
+			for hops := 0; hops < len(list); hops++ {
+				j, ok := at[target]
+				if !ok || list[j].op != OpJump || list[j].operands[0] == target {
+					break
+				}
+				target = list[j].operands[0]
+			}
+			if target != in.operands[0] {
+				in.operands[0] = target
+				changed = true
+			}
+		}
+		if in.op == OpJump {
+			if j, ok := at[in.operands[0]]; ok && (list[j].op == OpReturnValue || list[j].op == OpReturn) {
+				in.op, in.operands = list[j].op, []int{}
+				changed = true
+				continue
+			}
+			if i+1 < len(list) && list[i+1].offset == in.operands[0] {
+				in.removed = true
+				changed = true
+				continue
+			}
+		}
+		// a jump into the middle of a pair expects the stack the first
+		// instruction leaves, so such pairs are kept
+		if in.op != OpJumpNotTruthy || i == 0 || targets[in.offset] || list[i-1].removed {
+			continue
+		}
+		prev := &list[i-1]
+		switch prev.op {
+		case OpTrue:
+			prev.removed, in.removed = true, true
+		case OpFalse, OpNull:
+			prev.removed, in.op = true, OpJump
+		case OpBang:
+			prev.removed, in.op = true, OpJumpIfTrue
+		default:
+			continue
+		}
+		changed = true
+	}
+	return changed
+}
+
+// encode assembles the instructions of list that were not removed. Offsets
+// of removed instructions move to the instruction following them. length is
+// the length of the instructions list was decoded from.
+func encode(list []instruction, length int, entries []int) (Instructions, []int) {
+	relocated := make(map[int]int, len(list)+1)
+	positions := make([]int, len(list))
+	out := Instructions{}
+	for i, in := range list {
+		relocated[in.offset] = len(out)
+		positions[i] = len(out)
+		if !in.removed {
+			out = append(out, Make(in.op, in.operands...)...)
+		}
+	}
+	relocated[length] = len(out)
+
+	for i, in := range list {
+		if !in.removed && isJump(in.op) {
+			binary.BigEndian.PutUint16(out[positions[i]+1:], uint16(relocated[in.operands[0]]))
+		}
+	}
+	var newEntries []int
+	for _, e := range entries {
+		newEntries = append(newEntries, relocated[e])
+	}
+	return out, newEntries
+}
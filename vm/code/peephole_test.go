@@ -0,0 +1,182 @@
+package code
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           []Instructions
+		entries         []int
+		expected        []Instructions
+		expectedEntries []int
+	}{
+		{
+			name: "true condition",
+			input: []Instructions{
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 11),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpJump, 7),
+				Make(OpNull),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "false condition",
+			input: []Instructions{
+				Make(OpFalse),
+				Make(OpJumpNotTruthy, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 11),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpJump, 9),
+				Make(OpConstant, 0),
+				Make(OpJump, 10),
+				Make(OpNull),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "negated condition",
+			input: []Instructions{
+				Make(OpGetGlobal, 0),
+				Make(OpBang),
+				Make(OpJumpNotTruthy, 13),
+				Make(OpConstant, 0),
+				Make(OpJump, 14),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpGetGlobal, 0),
+				Make(OpJumpIfTrue, 12),
+				Make(OpConstant, 0),
+				Make(OpJump, 13),
+				Make(OpNull),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "jump to jump",
+			input: []Instructions{
+				Make(OpJumpNotTruthy, 5),
+				Make(OpPop),
+				Make(OpPop),
+				Make(OpJump, 9),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpJumpNotTruthy, 9),
+				Make(OpPop),
+				Make(OpPop),
+				Make(OpJump, 9),
+				Make(OpNull),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "jump to return",
+			input: []Instructions{
+				Make(OpGetLocal, 0),
+				Make(OpJumpNotTruthy, 11),
+				Make(OpConstant, 0),
+				Make(OpJump, 14),
+				Make(OpConstant, 1),
+				Make(OpReturnValue),
+			},
+			expected: []Instructions{
+				Make(OpGetLocal, 0),
+				Make(OpJumpNotTruthy, 9),
+				Make(OpConstant, 0),
+				Make(OpReturnValue),
+				Make(OpConstant, 1),
+				Make(OpReturnValue),
+			},
+		},
+		{
+			name: "jump to next instruction",
+			input: []Instructions{
+				Make(OpJump, 3),
+				Make(OpNull),
+			},
+			expected: []Instructions{
+				Make(OpNull),
+			},
+		},
+		{
+			name: "jump into a pair",
+			input: []Instructions{
+				Make(OpJump, 4),
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 8),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpJump, 4),
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 8),
+				Make(OpNull),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "entries are relocated",
+			input: []Instructions{
+				Make(OpFalse),
+				Make(OpJumpNotTruthy, 5),
+				Make(OpNull),
+				Make(OpReturnValue),
+			},
+			entries: []int{4, 5},
+			expected: []Instructions{
+				Make(OpReturnValue),
+				Make(OpNull),
+				Make(OpReturnValue),
+			},
+			expectedEntries: []int{1, 2},
+		},
+		{
+			name:     "undefined opcode",
+			input:    []Instructions{{255, 0}},
+			expected: []Instructions{{255, 0}},
+		},
+	}
+	for _, tt := range tests {
+		input := concat(tt.input)
+		original := bytes.Clone(input)
+		optimized, entries := Optimize(input, tt.entries)
+		expected := concat(tt.expected)
+		if !bytes.Equal(optimized, expected) {
+			t.Errorf("%s: wrong instructions.\nwant=%v\ngot=%v", tt.name, []byte(expected), []byte(optimized))
+		}
+		if fmt.Sprint(entries) != fmt.Sprint(tt.expectedEntries) {
+			t.Errorf("%s: wrong entries. want=%v, got=%v", tt.name, tt.expectedEntries, entries)
+		}
+		if !bytes.Equal(input, original) {
+			t.Errorf("%s: input was modified", tt.name)
+		}
+	}
+}
+
+func concat(ins []Instructions) Instructions {
+	out := Instructions{}
+	for _, in := range ins {
+		out = append(out, in...)
+	}
+	return out
+}
@@ -0,0 +1,291 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"interpreter/object"
+	"math"
+	"vm/code"
+)
+
+// Magic starts every serialized ByteCode, the contents of a .mkc file.
+const Magic = "\x00mkc"
+
+// FormatVersion is the version of the serialization format written by
+// MarshalBinary. UnmarshalBinary rejects any other version.
+const FormatVersion = 2
+
+// The tags preceding each constant in the constant pool. New constant types
+// get a new tag; existing tags keep their encoding within a FormatVersion.
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagCompiledFunction
+)
+
+// MarshalBinary encodes b in the .mkc format:
+//
+//	magic     4 bytes, Magic
+//	version   uint16, FormatVersion
+//	code      instructions
+//	file      string, File
+//	positions Positions
+//	count     uvarint, the number of constants
+//	constants count times a tag byte followed by the constant
+//
+// Integers are varints, strings and instructions a uvarint length followed
+// by their bytes. Positions are a uvarint count followed by the Offset,
+// line, column and byte offset of each as uvarints. A CompiledFunction is
+// its instructions, NumLocals, NumParameters and NumDefaults as uvarints,
+// DefaultEntries as a uvarint count followed by uvarints, a Variadic byte,
+// its Name and File as strings and its Positions.
+func (b *ByteCode) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(Magic)
+	buf.Write(binary.BigEndian.AppendUint16(nil, FormatVersion))
+	writeBytes(&buf, b.Instructions)
+	writeBytes(&buf, []byte(b.File))
+	writePositions(&buf, b.Positions)
+	writeUvarint(&buf, len(b.Constants))
+	for i, constant := range b.Constants {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			buf.WriteByte(tagInteger)
+			buf.Write(binary.AppendVarint(nil, constant.Value))
+		case *object.StringObject:
+			buf.WriteByte(tagString)
+			writeBytes(&buf, []byte(constant.Value))
+		case *object.CompiledFunction:
+			buf.WriteByte(tagCompiledFunction)
+			writeBytes(&buf, constant.Instructions)
+			writeUvarint(&buf, constant.NumLocals)
+			writeUvarint(&buf, constant.NumParameters)
+			writeUvarint(&buf, constant.NumDefaults)
+			writeUvarint(&buf, len(constant.DefaultEntries))
+			for _, entry := range constant.DefaultEntries {
+				writeUvarint(&buf, entry)
+			}
+			if constant.Variadic {
+				buf.WriteByte(1)
+			} else {
+				buf.WriteByte(0)
+			}
+			writeBytes(&buf, []byte(constant.Name))
+			writeBytes(&buf, []byte(constant.File))
+			writePositions(&buf, constant.Positions)
+		default:
+			return nil, fmt.Errorf("constant %d: cannot serialize %s", i, constant.Type())
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeUvarint(buf *bytes.Buffer, n int) {
+	buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	writeUvarint(buf, len(data))
+	buf.Write(data)
+}
+
+func writePositions(buf *bytes.Buffer, positions []object.InstructionPosition) {
+	writeUvarint(buf, len(positions))
+	for _, p := range positions {
+		writeUvarint(buf, p.Offset)
+		writeUvarint(buf, p.Pos.Line)
+		writeUvarint(buf, p.Pos.Column)
+		writeUvarint(buf, p.Pos.Offset)
+	}
+}
+
+// UnmarshalBinary decodes data written by MarshalBinary into b. It fails
+// unless data is exactly one well-formed ByteCode of the current
+// FormatVersion. Whether the instructions and the parameters, locals and
+// default entries of functions are consistent is left to vm.Verify.
+func (b *ByteCode) UnmarshalBinary(data []byte) error {
+	r := &reader{data: data}
+	if !bytes.HasPrefix(data, []byte(Magic)) {
+		return errors.New("not a .mkc file: bad magic")
+	}
+	r.offset = len(Magic)
+	if version := r.uint16(); r.err == nil && version != FormatVersion {
+		return fmt.Errorf("unsupported .mkc version %d, want %d", version, FormatVersion)
+	}
+	instructions := r.bytes()
+	file := string(r.bytes())
+	positions := r.positions(len(instructions))
+	constants := make([]object.Object, r.count(1))
+	for i := range constants {
+		if r.err != nil {
+			break
+		}
+		constants[i] = r.constant()
+		if r.err != nil {
+			r.err = fmt.Errorf("constant %d: %w", i, r.err)
+		}
+	}
+	if r.err == nil && r.offset != len(data) {
+		r.fail("%d trailing bytes", len(data)-r.offset)
+	}
+	if r.err != nil {
+		return fmt.Errorf("invalid .mkc file: %w", r.err)
+	}
+	b.Instructions = code.Instructions(instructions)
+	b.Constants = constants
+	b.File, b.Positions = file, positions
+	return nil
+}
+
+// reader decodes the .mkc format. After the first error it records, every
+// method returns zero values.
+type reader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *reader) fail(format string, a ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("offset %d: %s", r.offset, fmt.Sprintf(format, a...))
+	}
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.offset >= len(r.data) {
+		r.fail("unexpected end of data")
+		return 0
+	}
+	r.offset++
+	return r.data[r.offset-1]
+}
+
+func (r *reader) uint16() uint16 {
+	if r.err != nil {
+		return 0
+	}
+	if r.offset+2 > len(r.data) {
+		r.fail("unexpected end of data")
+		return 0
+	}
+	r.offset += 2
+	return binary.BigEndian.Uint16(r.data[r.offset-2:])
+}
+
+func (r *reader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	n, read := binary.Varint(r.data[r.offset:])
+	if read <= 0 {
+		r.fail("malformed varint")
+		return 0
+	}
+	r.offset += read
+	return n
+}
+
+// uvarint reads a non-negative int.
+func (r *reader) uvarint() int {
+	if r.err != nil {
+		return 0
+	}
+	n, read := binary.Uvarint(r.data[r.offset:])
+	if read <= 0 || n > math.MaxInt32 {
+		r.fail("malformed or out of range uvarint")
+		return 0
+	}
+	r.offset += read
+	return int(n)
+}
+
+// count reads the number of items of a list in which each item takes at
+// least size bytes, so that a corrupt count cannot cause a huge allocation.
+func (r *reader) count(size int) int {
+	n := r.uvarint()
+	if n > (len(r.data)-r.offset)/size {
+		r.fail("count %d exceeds the remaining data", n)
+		return 0
+	}
+	return n
+}
+
+func (r *reader) bytes() []byte {
+	n := r.count(1)
+	if r.err != nil {
+		return nil
+	}
+	r.offset += n
+	return bytes.Clone(r.data[r.offset-n : r.offset])
+}
+
+// positions reads the positions of instructions of length bytes, which
+// must be in order of their offsets.
+func (r *reader) positions(length int) []object.InstructionPosition {
+	n := r.count(4)
+	if n == 0 {
+		return nil
+	}
+	positions := make([]object.InstructionPosition, n)
+	for i := range positions {
+		p := &positions[i]
+		p.Offset = r.uvarint()
+		p.Pos.Line, p.Pos.Column, p.Pos.Offset = r.uvarint(), r.uvarint(), r.uvarint()
+		switch {
+		case r.err != nil:
+			return nil
+		case p.Offset >= length:
+			r.fail("position of offset %d is past the end of the instructions", p.Offset)
+		case i > 0 && p.Offset <= positions[i-1].Offset:
+			r.fail("positions out of order")
+		}
+	}
+	return positions
+}
+
+func (r *reader) constant() object.Object {
+	switch tag := r.byte(); tag {
+	case tagInteger:
+		return &object.Integer{Value: r.varint()}
+	case tagString:
+		return &object.StringObject{Value: string(r.bytes())}
+	case tagCompiledFunction:
+		return r.compiledFunction()
+	default:
+		r.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+func (r *reader) compiledFunction() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Instructions:  r.bytes(),
+		NumLocals:     r.uvarint(),
+		NumParameters: r.uvarint(),
+		NumDefaults:   r.uvarint(),
+	}
+	if n := r.count(1); n > 0 {
+		fn.DefaultEntries = make([]int, n)
+		for i := range fn.DefaultEntries {
+			fn.DefaultEntries[i] = r.uvarint()
+		}
+	}
+	switch variadic := r.byte(); variadic {
+	case 0, 1:
+		fn.Variadic = variadic == 1
+	default:
+		r.fail("bad variadic flag %d", variadic)
+	}
+	fn.Name = string(r.bytes())
+	fn.File = string(r.bytes())
+	fn.Positions = r.positions(len(fn.Instructions))
+	if r.err != nil {
+		return nil
+	}
+	return fn
+}
@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"interpreter/object"
+	"interpreter/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"vm/code"
+)
+
+func TestByteCodeRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"1 + 2",
+		`let s = "hello"; s + " world"`,
+		"-9223372036854775807 - 1",
+		"fn add(a, b = 2, ...rest) { a + b }; add(1)",
+		"let outer = fn() { let inner = fn(x) { x }; inner(1) }; outer()",
+		`match ([1, "a"]) { [n, s] => s, _ => 0 }`,
+	}
+	for _, input := range inputs {
+		comp := NewCompiler()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", input, err)
+		}
+		bytecode := comp.ByteCode()
+		data, err := bytecode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("cannot serialize %q: %s", input, err)
+		}
+		if !strings.HasPrefix(string(data), Magic) {
+			t.Errorf("no magic header for %q", input)
+		}
+		decoded := &ByteCode{}
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("cannot deserialize %q: %s", input, err)
+		}
+		if !reflect.DeepEqual(decoded, bytecode) {
+			t.Errorf("round trip of %q changed the bytecode.\nwant=%+v\ngot=%+v", input, bytecode, decoded)
+		}
+	}
+}
+
+func TestMarshalUnsupportedConstant(t *testing.T) {
+	bytecode := &ByteCode{Constants: []object.Object{&object.Integer{Value: 1}, &object.Null{}}}
+	_, err := bytecode.MarshalBinary()
+	if err == nil || err.Error() != "constant 1: cannot serialize NULL" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	valid, err := (&ByteCode{
+		Instructions: code.Make(code.OpConstant, 0),
+		Constants: []object.Object{&object.CompiledFunction{
+			Instructions:   code.Make(code.OpReturn),
+			NumLocals:      2,
+			NumParameters:  1,
+			NumDefaults:    1,
+			DefaultEntries: []int{0, 1},
+			Variadic:       true,
+			Name:           "f",
+			File:           "f.mk",
+			Positions:      []object.InstructionPosition{{Offset: 0, Pos: token.Position{Offset: 3, Line: 1, Column: 4}}},
+		}},
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the offsets of the fields of the function constant in valid
+	const (
+		tag      = 13
+		variadic = 22
+		position = 31
+	)
+	if err := (&ByteCode{}).UnmarshalBinary(valid); err != nil {
+		t.Fatalf("valid input rejected: %s", err)
+	}
+
+	with := func(offset int, b byte) []byte {
+		data := append([]byte{}, valid...)
+		data[offset] = b
+		return data
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"empty", nil, "bad magic"},
+		{"bad magic", with(1, 'x'), "bad magic"},
+		{"bad version", with(5, 3), "unsupported .mkc version 3"},
+		{"truncated version", valid[:5], "unexpected end of data"},
+		{"truncated", valid[:len(valid)-1], "count 1 exceeds the remaining data"},
+		{"trailing bytes", append(append([]byte{}, valid...), 0), "1 trailing bytes"},
+		{"unknown tag", with(tag, 9), "unknown constant tag 9"},
+		{"huge length", []byte(Magic + "\x00\x02\xff\xff\xff\xff\xff\x7f"), "malformed or out of range uvarint"},
+		{"length past end", with(6, 100), "count 100 exceeds the remaining data"},
+		{"bad variadic flag", with(variadic, 7), "bad variadic flag 7"},
+		{"position past the end", with(position, 1), "position of offset 1 is past the end of the instructions"},
+	}
+	for _, tt := range tests {
+		err := (&ByteCode{}).UnmarshalBinary(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
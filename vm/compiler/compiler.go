@@ -1,9 +1,15 @@
 package compiler
 
 import (
-	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/module"
 	"interpreter/object"
+	"interpreter/optimizer"
+	"interpreter/prelude"
+	"interpreter/token"
+	"slices"
 	"sort"
 	"vm/code"
 )
@@ -17,6 +23,15 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	// function is the name the function compiled in the scope is bound to,
+	// or "".
+	function string
+	// declarations holds the names of the functions declared in the body of
+	// the function that nothing else in it binds. Nested functions refer to
+	// them as constants.
+	declarations map[string]bool
+	// positions records where the instructions that can fail come from.
+	positions []object.InstructionPosition
 }
 
 type Compiler struct {
@@ -24,18 +39,150 @@ type Compiler struct {
 	constants   []object.Object
 	scopes      []CompilationScope
 	scopeIndex  int
+	// reserved maps the local function declarations in declarations to the
+	// constants reserved for them before they are compiled.
+	reserved map[*ast.FunctionLiteral]int
+
+	// file is the path of the source being compiled and loader resolves the
+	// modules it imports.
+	file   string
+	loader *module.Loader
+
+	noPrelude bool
+	// optimize selects the optimizations applied to programs before they
+	// are compiled.
+	optimize optimizer.Options
+	// peephole enables code.Optimize on the instructions of every function.
+	peephole bool
+	// prelude holds the globals defined by the prelude, which every module
+	// can see.
+	prelude []Symbol
+	// inPrelude is set while the prelude is compiled, whose positions are
+	// not in the source of the program.
+	inPrelude bool
+}
+
+// Option configures a Compiler.
+type Option func(*Compiler)
+
+// WithLoader makes the compiler load imports with loader, resolving relative
+// paths against file, the path of the program being compiled.
+func WithLoader(loader *module.Loader, file string) Option {
+	return func(c *Compiler) {
+		c.loader = loader
+		c.file = file
+	}
+}
+
+// WithoutPrelude keeps the compiler from compiling the prelude in front of
+// the program.
+func WithoutPrelude() Option {
+	return func(c *Compiler) {
+		c.noPrelude = true
+	}
+}
+
+// WithOptimizer makes the compiler run the optimizations enabled in opts on
+// every program before compiling it. Use optimizer.All to enable them all.
+func WithOptimizer(opts optimizer.Options) Option {
+	return func(c *Compiler) {
+		c.optimize = opts
+	}
+}
+
+// WithPeephole makes the compiler run the peephole optimizer on the
+// instructions of every compiled function and of the main program.
+func WithPeephole() Option {
+	return func(c *Compiler) {
+		c.peephole = true
+	}
+}
+
+// State is what a compiler defined that later programs can use: its global
+// symbols and constants. A VM running the later programs must keep the
+// globals of the earlier ones, see vm.NewVMWithGlobals.
+type State struct {
+	symbolTable *SymbolTable
+	constants   []object.Object
+	prelude     []Symbol
 }
 
-func NewCompiler() *Compiler {
+// State returns the state of c after the programs it compiled.
+func (c *Compiler) State() *State {
+	return &State{symbolTable: c.symbolTable.Global(), constants: c.constants, prelude: c.prelude}
+}
+
+// Define defines a global named name, for a value the host sets.
+func (s *State) Define(name string) Symbol {
+	return s.symbolTable.Define(name)
+}
+
+// Resolve returns the symbol name refers to in the global scope.
+func (s *State) Resolve(name string) (Symbol, bool) {
+	return s.symbolTable.Resolve(name)
+}
+
+// WithState makes the compiler continue from state, so that programs can
+// use the globals defined by the programs compiled before. The prelude is
+// not compiled again. Compiling does not change state.
+func WithState(state *State) Option {
+	return func(c *Compiler) {
+		c.symbolTable = state.symbolTable.clone()
+		c.constants = append([]object.Object{}, state.constants...)
+		c.prelude = state.prelude
+		c.noPrelude = true
+	}
+}
+
+func NewCompiler(opts ...Option) *Compiler {
 	mainScope := CompilationScope{
 		instructions:        code.Instructions{},
 		lastInstruction:     EmittedInstruction{},
 		previousInstruction: EmittedInstruction{},
 	}
-	return &Compiler{
+	c := &Compiler{
 		constants:   []object.Object{},
 		scopes:      []CompilationScope{mainScope},
 		symbolTable: NewSymbolTable(),
+		reserved:    map[*ast.FunctionLiteral]int{},
+	}
+	defineBuiltins(c.symbolTable)
+	for _, opt := range opts {
+		opt(c)
+	}
+	if !c.noPrelude {
+		c.compilePrelude()
+	}
+	return c
+}
+
+func defineBuiltins(s *SymbolTable) {
+	for i, v := range object.Builtins {
+		s.DefineBuiltin(i, v.Name)
+	}
+}
+
+// compilePrelude compiles the prelude into the main scope, defining its
+// bindings as globals ahead of the program's own.
+func (c *Compiler) compilePrelude() {
+	program := prelude.Parse()
+	c.inPrelude = true
+	if err := c.Compile(program); err != nil {
+		panic("prelude: " + err.Error())
+	}
+	c.inPrelude = false
+	for _, s := range program.Statements {
+		var names []string
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			names = s.Names()
+		case *ast.FunctionStatement:
+			names = []string{s.Name.Value}
+		}
+		for _, name := range names {
+			sym, _ := c.symbolTable.Resolve(name)
+			c.prelude = append(c.prelude, sym)
+		}
 	}
 }
 
@@ -70,6 +217,10 @@ func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
+		node = optimizer.Optimize(node, c.optimize)
+		if err := c.hoistFunctions(node.Statements); err != nil {
+			return err
+		}
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -77,30 +228,52 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.BlockStatement:
+		if err := c.hoistFunctions(node.Statements); err != nil {
+			return err
+		}
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
 		}
+	case *ast.FunctionStatement:
+		// compiled by hoistFunctions ahead of the enclosing statements
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
 			return err
 		}
 		c.emit(code.OpPop)
+	case *ast.ExportStatement:
+		return c.Compile(node.Statement)
+	case *ast.ImportExpression:
+		return c.compileImport(node)
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+	case *ast.MacroLiteral:
+		return c.errorf(node.Token, "macro literal is only allowed in a top-level let statement")
+	case *ast.BadStatement:
+		return c.errorf(node.Token, "syntax error at %s", node.Token.Pos)
 	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return c.compileDestructuringLet(node)
+		}
+		// a function is defined before its body is compiled so it can call
+		// itself; other values still see an outer binding of the same name
+		var sym Symbol
+		_, isFunction := node.Value.(*ast.FunctionLiteral)
+		if isFunction {
+			sym = c.symbolTable.Define(node.Name.Value)
+		}
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-		sym := c.symbolTable.Define(node.Name.Value)
-		if sym.Scope == GlobalScope {
-
-			c.emit(code.OpSetGlobal, sym.Index)
-		} else {
-			c.emit(code.OpSetLocal, sym.Index)
+		if !isFunction {
+			sym = c.symbolTable.Define(node.Name.Value)
 		}
+		c.storeSymbol(sym)
 	case *ast.ArrayLiteral:
 		for _, e := range node.Elements {
 			err := c.Compile(e)
@@ -127,7 +300,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		c.emit(code.OpHash, len(node.Pairs)*2)
+		c.emitAt(node.Token, code.OpHash, len(node.Pairs)*2)
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -137,7 +310,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
-		c.emit(code.OpIndex)
+		c.emitAt(node.Token, code.OpIndex)
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
 		if err != nil {
@@ -145,52 +318,41 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		switch node.Operator {
 		case "-":
-			c.emit(code.OpMinus)
+			c.emitAt(node.Token, code.OpMinus)
 		case "!":
 			c.emit(code.OpBang)
 
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return c.errorf(node.Token, "unknown operator %s", node.Operator)
 		}
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return nil
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return nil
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
-		}
-
 		err := c.Compile(node.Left)
 		if err != nil {
-			return nil
+			return err
 		}
 		err = c.Compile(node.Right)
 		if err != nil {
-			return nil
+			return err
 		}
 		switch node.Operator {
 		case "+":
-			c.emit(code.OpAdd)
+			c.emitAt(node.Token, code.OpAdd)
 		case "-":
-			c.emit(code.OpSub)
+			c.emitAt(node.Token, code.OpSub)
 		case "*":
-			c.emit(code.OpMul)
+			c.emitAt(node.Token, code.OpMul)
 		case "/":
-			c.emit(code.OpDiv)
+			c.emitAt(node.Token, code.OpDiv)
 		case "==":
-			c.emit(code.OpEqual)
+			c.emitAt(node.Token, code.OpEqual)
 		case "!=":
-			c.emit(code.OpNotEqual)
+			c.emitAt(node.Token, code.OpNotEqual)
 		case ">":
-			c.emit(code.OpGreaterThan)
+			c.emitAt(node.Token, code.OpGreaterThan)
+		case "<":
+			c.emitAt(node.Token, code.OpLessThan)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return c.errorf(node.Token, "unknown operator %s", node.Operator)
 		}
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
@@ -232,22 +394,35 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.Identifier:
 		sym, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("variable %s not define", node.Value)
+			return c.errorf(node.Token, "identifier not found: %s", node.Value)
 		}
-		if sym.Scope == GlobalScope {
-			c.emit(code.OpGetGlobal, sym.Index)
-		} else {
-			c.emit(code.OpGetLocal, sym.Index)
+		if c.symbolTable.isFree(node.Value) {
+			// the VM has no closures, but a local function can refer to
+			// itself, which the frame running it holds, and to the
+			// functions declared next to it, which are constants
+			if node.Value == c.scopes[c.scopeIndex].function {
+				c.emit(code.OpCurrentFunction)
+				return nil
+			}
+			if index, ok := c.symbolTable.resolveFunction(node.Value); ok {
+				c.emit(code.OpConstant, index)
+				return nil
+			}
+			return c.errorf(node.Token, "cannot use %s of an enclosing function", node.Value)
 		}
+		c.loadSymbol(sym)
 	case *ast.StringLiteral:
 		stringLiteral := &object.StringObject{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(stringLiteral))
 	case *ast.FunctionLiteral:
 		c.enterScope()
-		for _, ident := range node.Parameters {
-			c.symbolTable.Define(ident.Value)
+		c.scopes[c.scopeIndex].function = node.Name
+		c.scopes[c.scopeIndex].declarations = declaredFunctions(node)
+		entries, err := c.compileParameters(node)
+		if err != nil {
+			return err
 		}
-		err := c.Compile(node.Body)
+		err = c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -258,16 +433,41 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpReturn)
 		}
 		numLocals := c.symbolTable.numDefinitions
+		positions := c.scopes[c.scopeIndex].positions
 		instructions := c.leaveScope()
-		compileFn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals, NumParameters: len(node.Parameters)}
-		c.emit(code.OpConstant, c.addConstant(compileFn))
+		compileFn := &object.CompiledFunction{
+			Instructions:   instructions,
+			NumLocals:      numLocals,
+			NumParameters:  len(node.Parameters),
+			NumDefaults:    len(node.Defaults),
+			DefaultEntries: entries,
+			Variadic:       node.Rest != nil,
+			Name:           node.Name,
+			Positions:      positions,
+			File:           c.file,
+		}
+		c.optimizeFunction(compileFn)
+		index, ok := c.reserved[node]
+		if ok {
+			c.constants[index] = compileFn
+		} else {
+			index = c.addConstant(compileFn)
+		}
+		c.emit(code.OpConstant, index)
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
-			return nil
+			return err
+		}
+		if c.scopeIndex == 0 {
+			c.emit(code.OpHalt)
+		} else {
+			c.emit(code.OpReturnValue)
 		}
-		c.emit(code.OpReturnValue)
 	case *ast.CallExpression:
+		if name := node.Function.TokenLiteral(); name == "quote" || name == "unquote" {
+			return c.errorf(node.Token, "%s is only supported inside macros", name)
+		}
 		err := c.Compile(node.Function)
 		if err != nil {
 			return err
@@ -278,11 +478,243 @@ func (c *Compiler) Compile(node ast.Node) error {
 				return err
 			}
 		}
-		c.emit(code.OpCall, len(node.Arguments))
+		if node.Tail {
+			c.emitAt(node.Token, code.OpTailCall, len(node.Arguments))
+		} else {
+			c.emitAt(node.Token, code.OpCall, len(node.Arguments))
+		}
 	}
 	return nil
 }
 
+// hoistFunctions defines the functions declared by stmts and stores them
+// before any of the statements run. All names are defined first, so the
+// functions can call each other.
+func (c *Compiler) hoistFunctions(stmts []ast.Statement) error {
+	var decls []*ast.FunctionStatement
+	for _, stmt := range stmts {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+		if decl, ok := stmt.(*ast.FunctionStatement); ok {
+			decls = append(decls, decl)
+		}
+	}
+	symbols := make([]Symbol, len(decls))
+	for i, decl := range decls {
+		symbols[i] = c.symbolTable.Define(decl.Name.Value)
+		if c.scopes[c.scopeIndex].declarations[decl.Name.Value] {
+			index := c.addConstant(nil)
+			c.reserved[decl.Function] = index
+			c.symbolTable.functions[decl.Name.Value] = index
+		}
+	}
+	for i, decl := range decls {
+		if err := c.Compile(decl.Function); err != nil {
+			return err
+		}
+		c.storeSymbol(symbols[i])
+	}
+	return nil
+}
+
+// declaredFunctions returns the names of the functions declared by the
+// statements of the body of fn that no parameter, let statement, pattern or
+// other declaration in fn binds as well. Such a name refers to the same
+// function wherever fn and the functions nested in it use it.
+func declaredFunctions(fn *ast.FunctionLiteral) map[string]bool {
+	if fn.Body == nil {
+		return nil
+	}
+	bindings := map[string]int{}
+	for _, param := range fn.Parameters {
+		bindings[param.Value]++
+	}
+	if fn.Rest != nil {
+		bindings[fn.Rest.Value]++
+	}
+	ast.Inspect(fn, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			// nested functions bind their names in scopes of their own
+			return node == fn
+		case *ast.FunctionStatement:
+			bindings[node.Name.Value]++
+		case *ast.LetStatement:
+			if node.Pattern == nil {
+				bindings[node.Name.Value]++
+			}
+		case *ast.BindingPattern:
+			bindings[node.Name.Value]++
+		}
+		return true
+	})
+	declared := map[string]bool{}
+	for _, stmt := range fn.Body.Statements {
+		if decl, ok := stmt.(*ast.FunctionStatement); ok && bindings[decl.Name.Value] == 1 {
+			declared[decl.Name.Value] = true
+		}
+	}
+	return declared
+}
+
+// compileParameters defines the parameters of fn as locals and emits the
+// code computing their defaults. Each default is computed after the
+// parameters before it are defined, so it can refer to them. The slots of
+// all parameters are reserved first, so that the locals a default defines,
+// such as match bindings, come after them. It returns the entry offsets of
+// CompiledFunction.DefaultEntries, or nil if there are no defaults.
+func (c *Compiler) compileParameters(fn *ast.FunctionLiteral) ([]int, error) {
+	firstDefault := len(fn.Parameters) - len(fn.Defaults)
+	symbols := make([]Symbol, len(fn.Parameters))
+	for i, ident := range fn.Parameters {
+		if i < firstDefault {
+			symbols[i] = c.symbolTable.Define(ident.Value)
+		} else {
+			symbols[i] = c.symbolTable.defineAnonymous()
+		}
+	}
+	var rest Symbol
+	if fn.Rest != nil {
+		rest = c.symbolTable.defineAnonymous()
+	}
+	var entries []int
+	for i, ident := range fn.Parameters[firstDefault:] {
+		entries = append(entries, len(c.currentInstruction()))
+		if err := c.Compile(fn.Defaults[i]); err != nil {
+			return nil, err
+		}
+		c.storeSymbol(c.symbolTable.bind(ident.Value, symbols[firstDefault+i]))
+	}
+	if fn.Rest != nil {
+		c.symbolTable.bind(fn.Rest.Value, rest)
+	}
+	if entries != nil {
+		entries = append(entries, len(c.currentInstruction()))
+	}
+	return entries, nil
+}
+
+// compiledModule locates the code of a compiled module: the constant holding
+// the function that evaluates it and the global slot caching its exports.
+type compiledModule struct {
+	constant int
+	global   int
+}
+
+// errorf returns a compile error about tok in the file being compiled.
+func (c *Compiler) errorf(tok token.Token, format string, a ...any) error {
+	err := diagnostic.Errorf(diagnostic.Compile, diagnostic.At(tok.Pos), format, a...)
+	err.File = c.file
+	return err
+}
+
+func (c *Compiler) compileImport(node *ast.ImportExpression) error {
+	if c.loader == nil {
+		c.loader = module.NewLoader(module.SearchPathFromEnv()...)
+	}
+	path, err := c.loader.Resolve(c.file, node.Path)
+	if err != nil {
+		return err
+	}
+	cached, ok := c.loader.Cached(path)
+	if !ok {
+		compiled, err := c.compileModule(path)
+		if err != nil {
+			return err
+		}
+		c.loader.Store(path, compiled)
+		cached = compiled
+	}
+	compiled := cached.(compiledModule)
+	c.emitAt(node.Token, code.OpImport, compiled.constant, compiled.global)
+	return nil
+}
+
+// compileModule compiles the module at path into a function that runs its
+// top level statements, stores a hash of its exports in a global slot and
+// returns it. The module's top level bindings are globals of their own
+// symbol table, so they are invisible to the importer.
+func (c *Compiler) compileModule(path string) (compiledModule, error) {
+	if err := c.loader.Enter(path); err != nil {
+		return compiledModule{}, err
+	}
+	defer c.loader.Leave()
+	program, err := c.loader.Parse(path)
+	if err != nil {
+		return compiledModule{}, err
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	if _, err := evaluator.ExpandMacros(program, macroEnv); err != nil {
+		return compiledModule{}, err
+	}
+	program = optimizer.Optimize(program, c.optimize)
+
+	global := c.symbolTable.Global()
+	slot := global.defineAnonymous().Index
+	outerTable, outerFile := c.symbolTable, c.file
+	c.symbolTable, c.file = NewModuleSymbolTable(global), path
+	defineBuiltins(c.symbolTable)
+	for _, sym := range c.prelude {
+		c.symbolTable.store[sym.Name] = sym
+	}
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	defer func() {
+		global.numDefinitions = c.symbolTable.Global().numDefinitions
+		c.symbolTable, c.file = outerTable, outerFile
+		c.scopes = c.scopes[:len(c.scopes)-1]
+		c.scopeIndex--
+	}()
+
+	if err := c.hoistFunctions(program.Statements); err != nil {
+		return compiledModule{}, err
+	}
+	names := []string{}
+	for _, s := range program.Statements {
+		if err := c.Compile(s); err != nil {
+			return compiledModule{}, err
+		}
+		if export, ok := s.(*ast.ExportStatement); ok {
+			names = append(names, export.Names()...)
+		}
+	}
+	for _, name := range names {
+		sym, _ := c.symbolTable.Resolve(name)
+		c.emit(code.OpConstant, c.addConstant(&object.StringObject{Value: name}))
+		c.loadSymbol(sym)
+	}
+	c.emit(code.OpHash, len(names)*2)
+	c.emit(code.OpSetGlobal, slot)
+	c.emit(code.OpGetGlobal, slot)
+	c.emit(code.OpReturnValue)
+
+	fn := &object.CompiledFunction{Instructions: c.currentInstruction(), Positions: c.scopes[c.scopeIndex].positions, File: path}
+	c.optimizeFunction(fn)
+	return compiledModule{constant: c.addConstant(fn), global: slot}, nil
+}
+
+func (c *Compiler) loadSymbol(sym Symbol) {
+	switch sym.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, sym.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, sym.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, sym.Index)
+	}
+}
+
+// storeSymbol pops the top of the stack into the slot of sym.
+func (c *Compiler) storeSymbol(sym Symbol) {
+	if sym.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, sym.Index)
+	} else {
+		c.emit(code.OpSetLocal, sym.Index)
+	}
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
@@ -323,6 +755,17 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	return pos
 }
 
+// emitAt emits an instruction that can fail at run time, recording that it
+// comes from the expression at tok so that its errors point there.
+func (c *Compiler) emitAt(tok token.Token, op code.Opcode, operands ...int) int {
+	pos := c.emit(op, operands...)
+	if !c.inPrelude {
+		scope := &c.scopes[c.scopeIndex]
+		scope.positions = append(scope.positions, object.InstructionPosition{Offset: pos, Pos: tok.Pos})
+	}
+	return pos
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstruction())
 	updateInstuction := append(c.currentInstruction(), ins...)
@@ -337,13 +780,43 @@ func (c *Compiler) addConstant(obj object.Object) int {
 }
 
 func (c *Compiler) ByteCode() *ByteCode {
+	fn := &object.CompiledFunction{Instructions: c.currentInstruction(), Positions: c.scopes[c.scopeIndex].positions}
+	c.optimizeFunction(fn)
 	return &ByteCode{
-		Instructions: c.currentInstruction(),
+		Instructions: fn.Instructions,
 		Constants:    c.constants,
+		Positions:    fn.Positions,
+		File:         c.file,
+	}
+}
+
+// optimizeFunction runs the peephole optimizer on fn if it is enabled,
+// relocating its entries and positions.
+func (c *Compiler) optimizeFunction(fn *object.CompiledFunction) {
+	if !c.peephole {
+		return
+	}
+	offsets := slices.Clone(fn.DefaultEntries)
+	for _, p := range fn.Positions {
+		offsets = append(offsets, p.Offset)
+	}
+	ins, relocated := code.Optimize(fn.Instructions, offsets)
+	fn.Instructions = ins
+	if fn.DefaultEntries != nil {
+		fn.DefaultEntries = relocated[:len(fn.DefaultEntries)]
+	}
+	positions := make([]object.InstructionPosition, len(fn.Positions))
+	for i, p := range fn.Positions {
+		positions[i] = object.InstructionPosition{Offset: relocated[len(fn.DefaultEntries)+i], Pos: p.Pos}
 	}
+	fn.Positions = positions
 }
 
 type ByteCode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	// Positions and File locate the main instructions in the source, like
+	// the fields of a CompiledFunction.
+	Positions []object.InstructionPosition
+	File      string
 }
@@ -1,11 +1,17 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
 	"interpreter/lexer"
+	"interpreter/module"
 	"interpreter/object"
+	"interpreter/optimizer"
 	"interpreter/parser"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"vm/code"
@@ -103,11 +109,11 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1<2",
-			expectedConstants: []any{2, 1},
+			expectedConstants: []any{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				code.Make(code.OpPop),
 			},
 		},
@@ -144,6 +150,79 @@ func TestBooleanExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestMatchExpression(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `match (1) { 2 => 3, [a] => a }`,
+			expectedConstants: []any{1, 2, 3, 0},
+			expectedInstructions: []code.Instructions{
+				//0000
+				code.Make(code.OpConstant, 0),
+				//0003
+				code.Make(code.OpSetGlobal, 0),
+				//0006
+				code.Make(code.OpGetGlobal, 0),
+				//0009
+				code.Make(code.OpConstant, 1),
+				//0012
+				code.Make(code.OpMatchValue),
+				//0013
+				code.Make(code.OpJumpNotTruthy, 22),
+				//0016
+				code.Make(code.OpConstant, 2),
+				//0019
+				code.Make(code.OpJump, 50),
+				//0022
+				code.Make(code.OpGetGlobal, 0),
+				//0025
+				code.Make(code.OpMatchArray, 1, 1),
+				//0030
+				code.Make(code.OpJumpNotTruthy, 49),
+				//0033
+				code.Make(code.OpGetGlobal, 0),
+				//0036
+				code.Make(code.OpConstant, 3),
+				//0039
+				code.Make(code.OpIndex),
+				//0040
+				code.Make(code.OpSetGlobal, 1),
+				//0043
+				code.Make(code.OpGetGlobal, 1),
+				//0046
+				code.Make(code.OpJump, 50),
+				//0049
+				code.Make(code.OpNull),
+				//0050
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestOptimizer(t *testing.T) {
+	input := `if (1 < 2) { 10 + 20 } else { 0 }; "a" + "b"; return 1; 2`
+	comp := NewCompiler(WithoutPrelude(), WithOptimizer(optimizer.All))
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error:%s", err)
+	}
+	bytecode := comp.ByteCode()
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpHalt),
+	}
+	if err := testInstructions(expectedInstructions, bytecode.Instructions); err != nil {
+		t.Fatalf("testInstructions error:%s", err)
+	}
+	if err := testConstants(t, []any{30, "ab", 1}, bytecode.Constants); err != nil {
+		t.Fatalf("testConstants error:%s", err)
+	}
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -506,7 +585,7 @@ func TestFunctions(t *testing.T) {
 }
 
 func TestCompilerScopes(t *testing.T) {
-	compiler := NewCompiler()
+	compiler := NewCompiler(WithoutPrelude())
 	if compiler.scopeIndex != 0 {
 		t.Errorf("scopeIndex wrong. want=%d, got=%d", 0, compiler.scopeIndex)
 	}
@@ -714,12 +793,172 @@ func TestLetStatementScopes(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestBuiltins(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `
+			len([]);
+			push([], 1);
+			`,
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetBuiltin, 5),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { len([]) }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpArray, 0),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let countDown = fn(x) { countDown(x - 1); }; countDown(1);`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSub),
+					code.Make(code.OpTailCall, 1),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		pos      string
+	}{
+		{`x + 1`, "identifier not found: x", "1:1"},
+		{`1 + x`, "identifier not found: x", "1:5"},
+		{`let adder = fn(x) { fn(y) { x + y } }`, "cannot use x of an enclosing function", "1:29"},
+		{`fn outer() { fn f() { g() } fn g() { f() } let g = 1; f }`, "cannot use g of an enclosing function", "1:23"},
+		{`fn outer(g) { fn f() { fn() { g() } } fn g() { 1 } f }`, "cannot use g of an enclosing function", "1:31"},
+		{"let f = fn() {\n  return y;\n}", "identifier not found: y", "2:10"},
+	}
+	for _, tt := range tests {
+		err := NewCompiler(WithoutPrelude()).Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+			continue
+		}
+		var d *diagnostic.Diagnostic
+		if !errors.As(err, &d) || d.Code != diagnostic.Compile || d.Primary.Start.String() != tt.pos {
+			t.Errorf("%q: wrong diagnostic. want position %s, got %v", tt.input, tt.pos, d)
+		}
+	}
+}
+
+func TestPrelude(t *testing.T) {
+	compiler := NewCompiler()
+	sym, ok := compiler.symbolTable.Resolve("map")
+	if !ok || sym.Scope != GlobalScope {
+		t.Fatalf("prelude function map not defined as a global. got=%+v", sym)
+	}
+	if len(compiler.currentInstruction()) == 0 {
+		t.Errorf("prelude not compiled into the main scope")
+	}
+
+	compiler = NewCompiler(WithoutPrelude())
+	if _, ok := compiler.symbolTable.Resolve("map"); ok {
+		t.Errorf("prelude defined although disabled")
+	}
+	if len(compiler.currentInstruction()) != 0 {
+		t.Errorf("instructions emitted although prelude is disabled")
+	}
+}
+
+func TestImportExpression(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "lib.mk"), []byte("export let x = 1;"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := `let m = import "lib.mk"; let y = 2; import "./lib.mk";`
+	expectedConstants := []any{
+		1,
+		"x",
+		[]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpSetGlobal, 1),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpGetGlobal, 1),
+			code.Make(code.OpHash, 2),
+			code.Make(code.OpSetGlobal, 0),
+			code.Make(code.OpGetGlobal, 0),
+			code.Make(code.OpReturnValue),
+		},
+		2,
+	}
+	expectedInstructions := []code.Instructions{
+		code.Make(code.OpImport, 2, 0),
+		code.Make(code.OpSetGlobal, 2),
+		code.Make(code.OpConstant, 3),
+		code.Make(code.OpSetGlobal, 3),
+		code.Make(code.OpImport, 2, 0),
+		code.Make(code.OpPop),
+	}
+
+	compiler := NewCompiler(WithoutPrelude(), WithLoader(module.NewLoader(), filepath.Join(dir, "main.mk")))
+	err = compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error:%s", err)
+	}
+	bytecode := compiler.ByteCode()
+	err = testInstructions(expectedInstructions, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions error:%s", err)
+	}
+	err = testConstants(t, expectedConstants, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants error:%s", err)
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
 	for idx, tt := range tests {
 		program := parse(tt.input)
-		compiler := NewCompiler()
+		compiler := NewCompiler(WithoutPrelude())
 		err := compiler.Compile(program)
 
 		if err != nil {
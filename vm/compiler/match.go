@@ -0,0 +1,199 @@
+package compiler
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+	"maps"
+	"vm/code"
+)
+
+// compileMatch compiles a match expression into a chain of tests. The
+// subject is stored in a hidden slot. Each arm loads the parts of the
+// subject its pattern looks at, and every failing test jumps to the next
+// arm. The body of the first arm that matches leaves its value on the stack
+// and jumps to the end; if no arm matches, the expression is null.
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+	subject := c.symbolTable.defineAnonymous()
+	c.storeSymbol(subject)
+
+	endJumps := []int{}
+	for _, arm := range node.Arms {
+		// the bindings of an arm are only visible in its guard and body
+		table := c.symbolTable
+		saved := maps.Clone(table.store)
+
+		failJumps := []int{}
+		load := func() { c.loadSymbol(subject) }
+		err := c.compilePattern(arm.Pattern, load, &failJumps)
+		if err == nil && arm.Guard != nil {
+			err = c.Compile(arm.Guard)
+			failJumps = append(failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+		}
+		if err == nil {
+			err = c.Compile(arm.Body)
+		}
+		table.store = saved
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		nextArm := len(c.currentInstruction())
+		for _, pos := range failJumps {
+			c.changeOperand(pos, nextArm)
+		}
+	}
+	c.emit(code.OpNull)
+
+	end := len(c.currentInstruction())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, end)
+	}
+	return nil
+}
+
+// compilePattern emits the tests and bindings of pattern for the value that
+// load pushes. The positions of the jumps taken when a test fails are
+// appended to failJumps.
+func (c *Compiler) compilePattern(pattern ast.Pattern, load func(), failJumps *[]int) error {
+	fail := func() {
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+	case *ast.BindingPattern:
+		sym := c.symbolTable.Define(pattern.Name.Value)
+		load()
+		c.storeSymbol(sym)
+	case *ast.LiteralPattern:
+		load()
+		if err := c.Compile(pattern.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpMatchValue)
+		fail()
+	case *ast.DefaultPattern:
+		return c.compilePattern(pattern.Pattern, load, failJumps)
+	case *ast.ArrayPattern:
+		max := len(pattern.Elements)
+		if pattern.Rest != nil {
+			max = code.MatchArrayUnbounded
+		}
+		load()
+		c.emit(code.OpMatchArray, pattern.MinLength(), max)
+		fail()
+		for i, element := range pattern.Elements {
+			index := &ast.IntegerLiteral{Value: int64(i)}
+			if _, ok := element.(*ast.DefaultPattern); ok {
+				if err := c.compileElement(element, load, index, code.OpHasIndex, failJumps); err != nil {
+					return err
+				}
+				continue
+			}
+			// OpMatchArray made sure the element exists
+			constant := c.addConstant(&object.Integer{Value: index.Value})
+			loadElement := func() {
+				load()
+				c.emit(code.OpConstant, constant)
+				c.emit(code.OpIndex)
+			}
+			if err := c.compilePattern(element, loadElement, failJumps); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			loadRest := func() {
+				load()
+				c.emit(code.OpSliceFrom, len(pattern.Elements))
+			}
+			if err := c.compilePattern(pattern.Rest, loadRest, failJumps); err != nil {
+				return err
+			}
+		}
+	case *ast.HashPattern:
+		load()
+		c.emit(code.OpMatchHash)
+		fail()
+		for i, key := range pattern.Keys {
+			if err := c.compileElement(pattern.Values[i], load, key, code.OpHasKey, failJumps); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown pattern %T", pattern)
+	}
+	return nil
+}
+
+// compileElement emits the tests of pattern for the element at index of the
+// container that load pushes. has is the opcode testing whether the element
+// exists. If it does not, the test fails unless pattern is a DefaultPattern,
+// whose default is then matched instead.
+func (c *Compiler) compileElement(pattern ast.Pattern, load func(), index ast.Expression, has code.Opcode, failJumps *[]int) error {
+	loadIndex := func() error {
+		load()
+		return c.Compile(index)
+	}
+	def, ok := pattern.(*ast.DefaultPattern)
+	if !ok {
+		if err := loadIndex(); err != nil {
+			return err
+		}
+		c.emit(has)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+		loadElement := func() {
+			loadIndex()
+			c.emit(code.OpIndex)
+		}
+		return c.compilePattern(pattern, loadElement, failJumps)
+	}
+
+	// store the element, or the default if it is missing, in a hidden slot
+	if err := loadIndex(); err != nil {
+		return err
+	}
+	c.emit(has)
+	missing := c.emit(code.OpJumpNotTruthy, 9999)
+	loadIndex()
+	c.emit(code.OpIndex)
+	done := c.emit(code.OpJump, 9999)
+	c.changeOperand(missing, len(c.currentInstruction()))
+	if err := c.Compile(def.Default); err != nil {
+		return err
+	}
+	c.changeOperand(done, len(c.currentInstruction()))
+	element := c.symbolTable.defineAnonymous()
+	c.storeSymbol(element)
+	return c.compilePattern(def.Pattern, func() { c.loadSymbol(element) }, failJumps)
+}
+
+// compileDestructuringLet binds the names of the pattern of node, stopping
+// the VM with an error if the value does not match.
+func (c *Compiler) compileDestructuringLet(node *ast.LetStatement) error {
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+	value := c.symbolTable.defineAnonymous()
+	c.storeSymbol(value)
+
+	failJumps := []int{}
+	if err := c.compilePattern(node.Pattern, func() { c.loadSymbol(value) }, &failJumps); err != nil {
+		return err
+	}
+	if len(failJumps) == 0 {
+		return nil
+	}
+	done := c.emit(code.OpJump, 9999)
+	for _, pos := range failJumps {
+		c.changeOperand(pos, len(c.currentInstruction()))
+	}
+	c.loadSymbol(value)
+	c.emitAt(node.Token, code.OpMatchFail, c.addConstant(&object.StringObject{Value: node.Pattern.String()}))
+	c.changeOperand(done, len(c.currentInstruction()))
+	return nil
+}
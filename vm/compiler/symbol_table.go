@@ -3,8 +3,9 @@ package compiler
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL"
-	LocalScope  SymbolScope = "LOCAL"
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
 )
 
 type Symbol struct {
@@ -17,6 +18,9 @@ type SymbolTable struct {
 	Outer          *SymbolTable
 	store          map[string]Symbol
 	numDefinitions int
+	// functions maps the names of local function declarations that
+	// nested functions refer to as constants to the index of the constant.
+	functions map[string]int
 }
 
 func (s *SymbolTable) Define(name string) Symbol {
@@ -31,6 +35,23 @@ func (s *SymbolTable) Define(name string) Symbol {
 	return symbol
 }
 
+// DefineBuiltin defines name as the builtin at index of object.Builtins.
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// clone returns a copy of s, which must be a global symbol table.
+func (s *SymbolTable) clone() *SymbolTable {
+	clone := NewSymbolTable()
+	for name, symbol := range s.store {
+		clone.store[name] = symbol
+	}
+	clone.numDefinitions = s.numDefinitions
+	return clone
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	result, ok := s.store[name]
 	if !ok && s.Outer != nil {
@@ -40,10 +61,34 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	return result, ok
 }
 
+// isFree reports whether name resolves to a local of an enclosing function,
+// which the function compiled with s cannot reach.
+func (s *SymbolTable) isFree(name string) bool {
+	if _, ok := s.store[name]; ok || s.Outer == nil {
+		return false
+	}
+	sym, ok := s.Outer.Resolve(name)
+	return ok && sym.Scope == LocalScope
+}
+
+// resolveFunction returns the index of the constant holding the function
+// name refers to, if name resolves to a local function declaration recorded
+// in functions.
+func (s *SymbolTable) resolveFunction(name string) (int, bool) {
+	for ; s != nil; s = s.Outer {
+		if _, ok := s.store[name]; ok {
+			index, ok := s.functions[name]
+			return index, ok
+		}
+	}
+	return 0, false
+}
+
 func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{
 		store:          make(map[string]Symbol),
 		numDefinitions: 0,
+		functions:      make(map[string]int),
 	}
 }
 
@@ -52,3 +97,39 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s.Outer = outer
 	return s
 }
+
+// NewModuleSymbolTable returns the global symbol table of an imported module.
+// The module's globals share the VM's globals with the importer, so they are
+// numbered after the globals already defined in global, the importer's
+// global table. Once the module is compiled, global must continue numbering
+// after the module's globals.
+func NewModuleSymbolTable(global *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.numDefinitions = global.numDefinitions
+	return s
+}
+
+// Global returns the outermost symbol table.
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// defineAnonymous reserves an index in s that no name resolves to.
+func (s *SymbolTable) defineAnonymous() Symbol {
+	symbol := Symbol{Index: s.numDefinitions, Scope: GlobalScope}
+	if s.Outer != nil {
+		symbol.Scope = LocalScope
+	}
+	s.numDefinitions += 1
+	return symbol
+}
+
+// bind makes name resolve to symbol, an index reserved with defineAnonymous.
+func (s *SymbolTable) bind(name string, symbol Symbol) Symbol {
+	symbol.Name = name
+	s.store[name] = symbol
+	return symbol
+}
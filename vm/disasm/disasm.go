@@ -0,0 +1,190 @@
+// Package disasm prints compiled bytecode in a readable form: as a listing
+// of the main program and every function in the constant pool, or as a
+// control-flow graph in the Graphviz DOT language.
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"interpreter/object"
+	"sort"
+	"strings"
+
+	"vm/code"
+	"vm/compiler"
+)
+
+// instruction is a decoded instruction. def is nil for bytes that do not
+// decode, which err describes.
+type instruction struct {
+	offset   int
+	op       code.Opcode
+	def      *code.Definition
+	operands []int
+	err      string
+}
+
+// decode splits ins into instructions. An undefined opcode becomes a one
+// byte error instruction; a truncated instruction ends the list.
+func decode(ins code.Instructions) []instruction {
+	list := []instruction{}
+	for i := 0; i < len(ins); {
+		def, err := code.LookUp(ins[i])
+		if err != nil {
+			list = append(list, instruction{offset: i, err: err.Error()})
+			i++
+			continue
+		}
+		if i+1+def.Width() > len(ins) {
+			list = append(list, instruction{offset: i, err: def.Name + " truncated"})
+			break
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		list = append(list, instruction{offset: i, op: code.Opcode(ins[i]), def: def, operands: operands})
+		i += 1 + read
+	}
+	return list
+}
+
+func (in instruction) isJump() bool {
+	return in.def != nil && (in.op == code.OpJump || in.op == code.OpJumpNotTruthy || in.op == code.OpJumpIfTrue)
+}
+
+// labels names the offsets in list that jumps go to L0, L1, ... in order,
+// and the entries of a function with defaults entry0, entry1, ... Offsets
+// inside an instruction or past the end of code get no name.
+func labels(list []instruction, entries []int, length int) map[int]string {
+	boundaries := map[int]bool{length: true}
+	for _, in := range list {
+		boundaries[in.offset] = true
+	}
+	targets := []int{}
+	for _, in := range list {
+		if in.isJump() && boundaries[in.operands[0]] {
+			targets = append(targets, in.operands[0])
+		}
+	}
+	sort.Ints(targets)
+	names := map[int]string{}
+	for i, entry := range entries {
+		if boundaries[entry] {
+			names[entry] = fmt.Sprintf("entry%d", i)
+		}
+	}
+	n := 0
+	for _, target := range targets {
+		if _, ok := names[target]; !ok {
+			names[target] = fmt.Sprintf("L%d", n)
+			n++
+		}
+	}
+	return names
+}
+
+// function is a unit of code to disassemble: the main program or a
+// CompiledFunction of the constant pool.
+type function struct {
+	name    string
+	ins     code.Instructions
+	entries []int
+}
+
+func functions(bytecode *compiler.ByteCode) []function {
+	fns := []function{{name: "main", ins: bytecode.Instructions}}
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fns = append(fns, function{name: fmt.Sprintf("constant %d (%s)", i, annotate(fn)), ins: fn.Instructions, entries: fn.DefaultEntries})
+		}
+	}
+	return fns
+}
+
+// Disassemble lists the constant pool of bytecode, its main instructions and
+// the instructions of each CompiledFunction constant. Jump operands and the
+// default entries of functions are shown as labels, and operands that refer
+// to a constant or builtin are annotated with it.
+func Disassemble(bytecode *compiler.ByteCode) string {
+	var out bytes.Buffer
+	out.WriteString("constants:\n")
+	for i, constant := range bytecode.Constants {
+		fmt.Fprintf(&out, "  %04d %s\n", i, describe(constant))
+	}
+	for _, fn := range functions(bytecode) {
+		fmt.Fprintf(&out, "\n%s:\n", fn.name)
+		list := decode(fn.ins)
+		names := labels(list, fn.entries, len(fn.ins))
+		for _, in := range list {
+			if name, ok := names[in.offset]; ok {
+				fmt.Fprintf(&out, "%s:\n", name)
+			}
+			fmt.Fprintf(&out, "  %04d %s\n", in.offset, format(in, names, bytecode.Constants))
+		}
+		// a jump or entry can point past the last instruction
+		if name, ok := names[len(fn.ins)]; ok {
+			fmt.Fprintf(&out, "%s:\n", name)
+		}
+	}
+	return out.String()
+}
+
+// describe summarizes a constant in one line.
+func describe(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.StringObject:
+		return fmt.Sprintf("STRING %q", constant.Value)
+	case *object.CompiledFunction:
+		name := constant.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		desc := fmt.Sprintf("FUNCTION %s params=%d locals=%d", name, constant.NumParameters, constant.NumLocals)
+		if constant.NumDefaults > 0 {
+			desc += fmt.Sprintf(" defaults=%d", constant.NumDefaults)
+		}
+		if constant.Variadic {
+			desc += " variadic"
+		}
+		return desc
+	}
+	return fmt.Sprintf("%s %s", constant.Type(), constant.Inspect())
+}
+
+// format formats an instruction with its operands.
+func format(in instruction, names map[int]string, constants []object.Object) string {
+	if in.def == nil {
+		return "ERROR: " + in.err
+	}
+	parts := []string{in.def.Name}
+	for i, operand := range in.operands {
+		if name, ok := names[operand]; ok && i == 0 && in.isJump() {
+			parts = append(parts, name)
+			continue
+		}
+		parts = append(parts, fmt.Sprint(operand))
+	}
+	text := strings.Join(parts, " ")
+	switch in.op {
+	case code.OpConstant, code.OpImport, code.OpMatchFail:
+		if index := in.operands[0]; index < len(constants) {
+			text += " ; " + annotate(constants[index])
+		}
+	case code.OpGetBuiltin:
+		if index := in.operands[0]; index < len(object.Builtins) {
+			text += " ; " + object.Builtins[index].Name
+		}
+	}
+	return text
+}
+
+func annotate(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.StringObject:
+		return fmt.Sprintf("%q", constant.Value)
+	case *object.CompiledFunction:
+		if constant.Name != "" {
+			return "fn " + constant.Name
+		}
+		return "fn"
+	}
+	return constant.Inspect()
+}
@@ -0,0 +1,161 @@
+package disasm
+
+import (
+	"interpreter/object"
+	"strings"
+	"testing"
+
+	"vm/code"
+	"vm/compiler"
+)
+
+func concat(ins ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, in := range ins {
+		out = append(out, in...)
+	}
+	return out
+}
+
+var testByteCode = &compiler.ByteCode{
+	Instructions: concat(
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpGetBuiltin, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpImport, 3, 1),
+		code.Make(code.OpPop),
+	),
+	Constants: []object.Object{
+		&object.Integer{Value: 2},
+		&object.StringObject{Value: "a\"b"},
+		&object.CompiledFunction{
+			Instructions: concat(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpJumpNotTruthy, 15),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpJump, 16),
+				code.Make(code.OpNull),
+				code.Make(code.OpMatchArray, 1, 2),
+				code.Make(code.OpReturnValue),
+			),
+			NumLocals:      2,
+			NumParameters:  2,
+			NumDefaults:    1,
+			DefaultEntries: []int{0, 5},
+			Name:           "f",
+		},
+		&object.CompiledFunction{
+			Instructions: concat(code.Make(code.OpReturn)),
+			Variadic:     true,
+			NumLocals:    1,
+		},
+	},
+}
+
+func TestDisassemble(t *testing.T) {
+	expected := `constants:
+  0000 INTEGER 2
+  0001 STRING "a\"b"
+  0002 FUNCTION f params=2 locals=2 defaults=1
+  0003 FUNCTION <anonymous> params=0 locals=1 variadic
+
+main:
+  0000 OpConstant 2 ; fn f
+  0003 OpSetGlobal 0
+  0006 OpGetBuiltin 0 ; len
+  0008 OpConstant 1 ; "a\"b"
+  0011 OpCall 1
+  0013 OpImport 3 1 ; fn
+  0018 OpPop
+
+constant 2 (fn f):
+entry0:
+  0000 OpConstant 0 ; 2
+  0003 OpSetLocal 1
+entry1:
+  0005 OpGetLocal 0
+  0007 OpJumpNotTruthy L0
+  0010 OpGetLocal 1
+  0012 OpJump L1
+L0:
+  0015 OpNull
+L1:
+  0016 OpMatchArray 1 2
+  0021 OpReturnValue
+
+constant 3 (fn):
+  0000 OpReturn
+`
+	if got := Disassemble(testByteCode); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestDisassembleInvalid(t *testing.T) {
+	bytecode := &compiler.ByteCode{
+		Instructions: code.Instructions{byte(code.OpPop), 255, byte(code.OpJump), 0, 6, byte(code.OpConstant), 0},
+	}
+	expected := `constants:
+
+main:
+  0000 OpPop
+  0001 ERROR: opcode 255 undefined
+  0002 OpJump 6
+  0005 ERROR: OpConstant truncated
+`
+	if got := Disassemble(bytecode); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestGraph(t *testing.T) {
+	bytecode := &compiler.ByteCode{
+		Instructions: concat(
+			code.Make(code.OpTrue),
+			code.Make(code.OpJumpNotTruthy, 10),
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpJump, 11),
+			code.Make(code.OpNull),
+			code.Make(code.OpPop),
+		),
+		Constants: []object.Object{&object.StringObject{Value: "x"}},
+	}
+	expected := `digraph bytecode {
+  node [shape=box, fontname=monospace];
+  subgraph cluster_0 {
+    label="main";
+    f0_0 [label="0000 OpTrue\l0001 OpJumpNotTruthy L0\l"];
+    f0_0 -> f0_10 [label="jump"];
+    f0_0 -> f0_4 [label="next"];
+    f0_4 [label="0004 OpConstant 0 ; \"x\"\l0007 OpJump L1\l"];
+    f0_4 -> f0_11;
+    f0_10 [label="L0:\l0010 OpNull\l"];
+    f0_10 -> f0_11;
+    f0_11 [label="L1:\l0011 OpPop\l"];
+    f0_11 -> f0_end;
+    f0_end [label="end", shape=oval];
+  }
+}
+`
+	if got := Graph(bytecode); got != expected {
+		t.Errorf("wrong graph.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestGraphFunctions(t *testing.T) {
+	got := Graph(testByteCode)
+	for _, want := range []string{
+		"subgraph cluster_1 {\n    label=\"constant 2 (fn f)\";",
+		"f1_0 -> f1_5;",
+		"f1_5 [label=\"entry1:\\l0005 OpGetLocal 0\\l0007 OpJumpNotTruthy L0\\l\"];",
+		"subgraph cluster_2 {\n    label=\"constant 3 (fn)\";\n    f2_0 [label=\"0000 OpReturn\\l\"];\n  }",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("graph does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"vm/code"
+	"vm/compiler"
+)
+
+// block is a basic block: a run of instructions entered only at the first
+// and left only after the last.
+type block []instruction
+
+// blocks splits list into basic blocks. A block starts at the first
+// instruction, at jump targets and entries, and after jumps, returns and
+// instructions that do not decode.
+func blocks(list []instruction, names map[int]string) []block {
+	result := []block{}
+	for i, in := range list {
+		if i == 0 || names[in.offset] != "" || ends(list[i-1]) {
+			result = append(result, block{})
+		}
+		result[len(result)-1] = append(result[len(result)-1], in)
+	}
+	return result
+}
+
+// ends reports whether in ends a basic block.
+func ends(in instruction) bool {
+	if in.def == nil {
+		return true
+	}
+	switch in.op {
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpIfTrue,
+		code.OpReturn, code.OpReturnValue, code.OpMatchFail, code.OpHalt:
+		return true
+	}
+	return false
+}
+
+// Graph returns the control-flow graph of the main instructions and of each
+// CompiledFunction constant of bytecode in the Graphviz DOT language. Each
+// function is a cluster of basic blocks; conditional jumps have an edge
+// labelled "jump" to their target and one labelled "next" to the following
+// block.
+func Graph(bytecode *compiler.ByteCode) string {
+	var out bytes.Buffer
+	out.WriteString("digraph bytecode {\n")
+	out.WriteString("  node [shape=box, fontname=monospace];\n")
+	for f, fn := range functions(bytecode) {
+		list := decode(fn.ins)
+		names := labels(list, fn.entries, len(fn.ins))
+		bbs := blocks(list, names)
+		// the node of the block starting at an offset
+		node := map[int]string{}
+		for _, b := range bbs {
+			node[b[0].offset] = fmt.Sprintf("f%d_%d", f, b[0].offset)
+		}
+		node[len(fn.ins)] = fmt.Sprintf("f%d_end", f)
+
+		fmt.Fprintf(&out, "  subgraph cluster_%d {\n", f)
+		fmt.Fprintf(&out, "    label=%q;\n", fn.name)
+		endUsed := false
+		for i, b := range bbs {
+			var label strings.Builder
+			if name, ok := names[b[0].offset]; ok {
+				label.WriteString(name + ":\\l")
+			}
+			for _, in := range b {
+				fmt.Fprintf(&label, "%04d %s\\l", in.offset, escape(format(in, names, bytecode.Constants)))
+			}
+			id := node[b[0].offset]
+			fmt.Fprintf(&out, "    %s [label=\"%s\"];\n", id, label.String())
+
+			next := len(fn.ins)
+			if i+1 < len(bbs) {
+				next = bbs[i+1][0].offset
+			}
+			last := b[len(b)-1]
+			edge := func(to int, label string) {
+				target, ok := node[to]
+				if !ok {
+					// a jump into the middle of an instruction
+					return
+				}
+				endUsed = endUsed || to == len(fn.ins)
+				if label == "" {
+					fmt.Fprintf(&out, "    %s -> %s;\n", id, target)
+				} else {
+					fmt.Fprintf(&out, "    %s -> %s [label=%q];\n", id, target, label)
+				}
+			}
+			switch {
+			case last.def == nil:
+			case last.op == code.OpJump:
+				edge(last.operands[0], "")
+			case last.isJump():
+				edge(last.operands[0], "jump")
+				edge(next, "next")
+			case !ends(last):
+				edge(next, "")
+			}
+		}
+		if endUsed || len(bbs) == 0 {
+			fmt.Fprintf(&out, "    %s [label=\"end\", shape=oval];\n", node[len(fn.ins)])
+		}
+		out.WriteString("  }\n")
+	}
+	out.WriteString("}\n")
+	return out.String()
+}
+
+// escape escapes s for a DOT string.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
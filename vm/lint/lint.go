@@ -0,0 +1,408 @@
+// Package lint reports likely mistakes in Monkey programs without running
+// them. Names are resolved with the compiler's symbol tables, so a program
+// without undefined names compiles.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"interpreter/ast"
+	"interpreter/object"
+	"interpreter/prelude"
+	"interpreter/token"
+	"vm/compiler"
+)
+
+// The IDs of the rules a Finding can come from.
+const (
+	// UnusedVariable reports let bindings and declared functions that are
+	// never referenced. Exported names and names starting with an
+	// underscore are exempt.
+	UnusedVariable = "unused"
+	// ShadowedBinding reports bindings that hide a binding of an enclosing
+	// scope or a builtin.
+	ShadowedBinding = "shadow"
+	// UndefinedName reports references to names that are not defined.
+	UndefinedName = "undefined"
+	// UnreachableCode reports statements following a return statement.
+	UnreachableCode = "unreachable"
+	// BuiltinArity reports calls of builtins with the wrong number of
+	// arguments.
+	BuiltinArity = "builtin-arity"
+	// DiscardedValue reports expression statements other than calls whose
+	// value is not used.
+	DiscardedValue = "discarded"
+)
+
+// Rules lists the IDs of all rules.
+var Rules = []string{UnusedVariable, ShadowedBinding, UndefinedName, UnreachableCode, BuiltinArity, DiscardedValue}
+
+// Finding is a problem found by Lint.
+type Finding struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s (%s)", f.Pos, f.Message, f.Rule)
+}
+
+// Config controls what Lint reports.
+type Config struct {
+	// Disabled holds the IDs of the rules whose findings are suppressed.
+	Disabled map[string]bool
+	// NoPrelude lints the program as if the prelude was not loaded, so its
+	// names are undefined.
+	NoPrelude bool
+}
+
+// Lint checks program and returns its findings ordered by position.
+func Lint(program *ast.Program, config Config) []Finding {
+	table := compiler.NewSymbolTable()
+	for i, def := range object.Builtins {
+		table.DefineBuiltin(i, def.Name)
+	}
+	if !config.NoPrelude {
+		for _, stmt := range prelude.Parse().Statements {
+			switch stmt := stmt.(type) {
+			case *ast.LetStatement:
+				for _, name := range stmt.Names() {
+					table.Define(name)
+				}
+			case *ast.FunctionStatement:
+				table.Define(stmt.Name.Value)
+			}
+		}
+	}
+	l := &linter{config: config, scope: &scope{table: table, bindings: map[string]*binding{}}}
+	l.statements(program.Statements)
+	for _, b := range l.bindings {
+		if !b.used && !b.exported && !strings.HasPrefix(b.name, "_") {
+			l.report(b.pos, UnusedVariable, "%s is never used", b.name)
+		}
+	}
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		return l.findings[i].Pos.Offset < l.findings[j].Pos.Offset
+	})
+	return l.findings
+}
+
+type binding struct {
+	name     string
+	pos      token.Position
+	used     bool
+	exported bool
+}
+
+// scope holds the bindings of a program, function or match arm. table
+// resolves the names the linter does not track, builtins and the prelude.
+type scope struct {
+	table    *compiler.SymbolTable
+	bindings map[string]*binding
+	outer    *scope
+}
+
+type linter struct {
+	config   Config
+	scope    *scope
+	bindings []*binding
+	findings []Finding
+}
+
+func (l *linter) report(pos token.Position, rule string, format string, a ...any) {
+	if l.config.Disabled[rule] {
+		return
+	}
+	l.findings = append(l.findings, Finding{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, a...)})
+}
+
+func (l *linter) enterScope() {
+	l.scope = &scope{
+		table:    compiler.NewEnclosedSymbolTable(l.scope.table),
+		bindings: map[string]*binding{},
+		outer:    l.scope,
+	}
+}
+
+func (l *linter) leaveScope() {
+	l.scope = l.scope.outer
+}
+
+func (l *linter) define(ident *ast.Identifier) *binding {
+	if ident == nil {
+		return nil
+	}
+	name := ident.Value
+	if prev, ok := l.scope.bindings[name]; ok {
+		// redefining a name in the same scope replaces it
+		prev.used = true
+	} else if l.lookup(name) != nil {
+		l.report(ident.Token.Pos, ShadowedBinding, "%s shadows a binding of an enclosing scope", name)
+	} else if sym, ok := l.scope.table.Resolve(name); ok && sym.Scope == compiler.BuiltinScope {
+		l.report(ident.Token.Pos, ShadowedBinding, "%s shadows a builtin", name)
+	}
+	l.scope.table.Define(name)
+	b := &binding{name: name, pos: ident.Token.Pos}
+	l.scope.bindings[name] = b
+	l.bindings = append(l.bindings, b)
+	return b
+}
+
+func (l *linter) lookup(name string) *binding {
+	for s := l.scope; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+func (l *linter) resolve(ident *ast.Identifier) {
+	if b := l.lookup(ident.Value); b != nil {
+		b.used = true
+		return
+	}
+	if _, ok := l.scope.table.Resolve(ident.Value); !ok {
+		l.report(ident.Token.Pos, UndefinedName, "%s is not defined", ident.Value)
+	}
+}
+
+// statements checks a statement list. Function declarations are defined
+// first, as they are hoisted. The value of the last statement is the value
+// of the list, so only the values of the other statements are discarded.
+func (l *linter) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		if export, ok := stmt.(*ast.ExportStatement); ok {
+			stmt = export.Statement
+		}
+		if decl, ok := stmt.(*ast.FunctionStatement); ok {
+			l.define(decl.Name)
+		}
+	}
+	returned := false
+	for i, stmt := range stmts {
+		if _, ok := stmt.(*ast.FunctionStatement); returned && !ok {
+			l.report(statementPos(stmt), UnreachableCode, "unreachable code after return")
+			// one finding per statement list is enough
+			returned = false
+		}
+		if exprStmt, ok := stmt.(*ast.ExpressionStatement); ok && i < len(stmts)-1 {
+			if isPure(exprStmt.Expression) {
+				l.report(exprStmt.Token.Pos, DiscardedValue, "value of %s is not used", exprStmt.Expression.String())
+			}
+		}
+		l.statement(stmt)
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			returned = true
+		}
+	}
+}
+
+func (l *linter) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Pattern != nil {
+			l.expression(stmt.Value)
+			l.pattern(stmt.Pattern)
+			return
+		}
+		// like the compiler, a function can refer to its own name
+		if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+			l.define(stmt.Name)
+			l.expression(stmt.Value)
+			return
+		}
+		l.expression(stmt.Value)
+		l.define(stmt.Name)
+	case *ast.FunctionStatement:
+		l.expression(stmt.Function)
+	case *ast.ExportStatement:
+		l.statement(stmt.Statement)
+		names := []string{}
+		if stmt.Statement != nil {
+			names = stmt.Names()
+		}
+		for _, name := range names {
+			if b := l.lookup(name); b != nil {
+				b.exported = true
+			}
+		}
+	case *ast.ReturnStatement:
+		l.expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		l.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		l.statements(stmt.Statements)
+	}
+}
+
+func (l *linter) expression(expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		l.resolve(expr)
+	case *ast.PrefixExpression:
+		l.expression(expr.Right)
+	case *ast.InfixExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Right)
+	case *ast.IfExpression:
+		l.expression(expr.Condition)
+		if expr.Then != nil {
+			l.statements(expr.Then.Statements)
+		}
+		if expr.Else != nil {
+			l.statements(expr.Else.Statements)
+		}
+	case *ast.FunctionLiteral:
+		l.enterScope()
+		for i, param := range expr.Parameters {
+			l.defineParameter(param)
+			if first := len(expr.Parameters) - len(expr.Defaults); i >= first {
+				l.expression(expr.Defaults[i-first])
+			}
+		}
+		if expr.Rest != nil {
+			l.defineParameter(expr.Rest)
+		}
+		if expr.Body != nil {
+			l.statements(expr.Body.Statements)
+		}
+		l.leaveScope()
+	case *ast.MacroLiteral:
+		l.enterScope()
+		for _, param := range expr.Parameters {
+			l.defineParameter(param)
+		}
+		if expr.Body != nil {
+			l.statements(expr.Body.Statements)
+		}
+		l.leaveScope()
+	case *ast.CallExpression:
+		l.call(expr)
+	case *ast.ArrayLiteral:
+		for _, element := range expr.Elements {
+			l.expression(element)
+		}
+	case *ast.IndexExpression:
+		l.expression(expr.Left)
+		l.expression(expr.Index)
+	case *ast.HashLiteral:
+		for _, key := range ast.SortedKeys(expr) {
+			l.expression(key)
+			l.expression(expr.Pairs[key])
+		}
+	case *ast.MatchExpression:
+		l.expression(expr.Subject)
+		for _, arm := range expr.Arms {
+			l.enterScope()
+			l.pattern(arm.Pattern)
+			if arm.Guard != nil {
+				l.expression(arm.Guard)
+			}
+			l.expression(arm.Body)
+			l.leaveScope()
+		}
+	}
+}
+
+// defineParameter defines a parameter, which is exempt from the unused
+// rule: callbacks often ignore some of their arguments.
+func (l *linter) defineParameter(ident *ast.Identifier) {
+	if b := l.define(ident); b != nil {
+		b.used = true
+	}
+}
+
+func (l *linter) call(call *ast.CallExpression) {
+	switch call.Function.TokenLiteral() {
+	case "quote", "unquote":
+		// quoted code is not evaluated where it appears
+		return
+	}
+	l.expression(call.Function)
+	for _, arg := range call.Arguments {
+		l.expression(arg)
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok || l.lookup(ident.Value) != nil {
+		return
+	}
+	sym, ok := l.scope.table.Resolve(ident.Value)
+	if !ok || sym.Scope != compiler.BuiltinScope {
+		return
+	}
+	if arity := object.Builtins[sym.Index].Builtin.Arity; arity >= 0 && arity != len(call.Arguments) {
+		l.report(call.Token.Pos, BuiltinArity, "wrong number of arguments to %s. got=%d, want=%d", ident.Value, len(call.Arguments), arity)
+	}
+}
+
+func (l *linter) pattern(p ast.Pattern) {
+	switch p := p.(type) {
+	case *ast.BindingPattern:
+		l.define(p.Name)
+	case *ast.LiteralPattern:
+		l.expression(p.Value)
+	case *ast.DefaultPattern:
+		l.expression(p.Default)
+		l.pattern(p.Pattern)
+	case *ast.ArrayPattern:
+		for _, element := range p.Elements {
+			l.pattern(element)
+		}
+		if p.Rest != nil {
+			l.pattern(p.Rest)
+		}
+	case *ast.HashPattern:
+		for _, value := range p.Values {
+			l.pattern(value)
+		}
+	}
+}
+
+// isPure reports whether evaluating expr only computes a value, so a
+// statement consisting of it has no effect. An expression calling a
+// function anywhere is not pure, since the call may have effects.
+func isPure(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean,
+		*ast.PrefixExpression, *ast.InfixExpression, *ast.IndexExpression,
+		*ast.ArrayLiteral, *ast.HashLiteral, *ast.FunctionLiteral:
+	default:
+		return false
+	}
+	pure := true
+	ast.Inspect(expr, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.FunctionLiteral:
+			// the body runs only when the function is called
+			return false
+		case *ast.CallExpression, *ast.ImportExpression, *ast.IfExpression, *ast.MatchExpression:
+			pure = false
+		}
+		return pure
+	})
+	return pure
+}
+
+func statementPos(stmt ast.Statement) token.Position {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token.Pos
+	case *ast.ReturnStatement:
+		return stmt.Token.Pos
+	case *ast.ExpressionStatement:
+		return stmt.Token.Pos
+	case *ast.BlockStatement:
+		return stmt.Token.Pos
+	case *ast.ExportStatement:
+		return stmt.Token.Pos
+	case *ast.FunctionStatement:
+		return stmt.Token.Pos
+	case *ast.BadStatement:
+		return stmt.Token.Pos
+	}
+	return token.Position{}
+}
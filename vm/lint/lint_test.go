@@ -0,0 +1,137 @@
+package lint
+
+import (
+	"fmt"
+	"testing"
+
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x", nil},
+		{"let x = 1;", []string{"1:5 unused"}},
+		{"let _x = 1;", nil},
+		{"export let x = 1;", nil},
+		{"fn f() { 1 }", []string{"1:4 unused"}},
+		{"f(); fn f() { 1 }", nil},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3)", nil},
+		{"let f = fn(a, b) { a }; f(1, 2)", nil},
+		{"let [a, b] = [1, 2]; a", []string{"1:9 unused"}},
+		{"let x = 1; let f = fn() { let x = 2; x }; f() + x", []string{"1:31 shadow"}},
+		{"let f = fn(x) { x }; let x = 1; f(x)", nil},
+		{"let g = fn(len) { len }; g(1)", []string{"1:12 shadow"}},
+		{"let x = 1; let x = x + 1; x", nil},
+		{"y", []string{"1:1 undefined"}},
+		{"let x = x;", []string{"1:5 unused", "1:9 undefined"}},
+		{"let f = fn() { g() }; f()", []string{"1:16 undefined"}},
+		{"map([1], fn(x) { x })", nil},
+		{"match (1) { [a, b] => a + b, n if n > 0 => n, _ => 0 }", nil},
+		{"match (1) { n => m }", []string{"1:13 unused", "1:18 undefined"}},
+		{"let f = fn() { return 1; 2; 3 }; f()", []string{"1:26 unreachable", "1:26 discarded"}},
+		{"let f = fn() { return g(); fn g() { 1 } }; f()", nil},
+		{"len(1, 2)", []string{"1:4 builtin-arity"}},
+		{"push([])", []string{"1:5 builtin-arity"}},
+		{"puts(1, 2, 3)", nil},
+		{"let len = fn(a, b) { a }; len(1, 2)", []string{"1:5 shadow"}},
+		{"1 + 1; 2", []string{"1:1 discarded"}},
+		{"let f = fn() { 1 }; f() + 1; -f(); [f()]; {1: f()}; [1][f()]; 2", nil},
+		{`[if (true) { puts(1) }]; 2`, nil},
+		{"let f = fn() { 1 }; [fn() { f() }, 1 + 2]; 2", []string{"1:21 discarded"}},
+		{"let f = fn() { x; 1 }; f()", []string{"1:16 discarded", "1:16 undefined"}},
+		{"puts(1); 2", nil},
+		{"if (true) { 1 }; 2", nil},
+		{"let m = macro(a) { quote(unquote(a) + b) }; m(1)", nil},
+	}
+	for _, tt := range tests {
+		findings := Lint(parse(t, tt.input), Config{})
+		got := []string{}
+		for _, f := range findings {
+			got = append(got, fmt.Sprintf("%d:%d %s", f.Pos.Line, f.Pos.Column, f.Rule))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong findings for %q.\nwant=%v\ngot=%v", tt.input, tt.expected, findings)
+		}
+	}
+}
+
+func TestPrelude(t *testing.T) {
+	input := "filter([1], fn(x) { true })"
+	if findings := Lint(parse(t, input), Config{}); len(findings) != 0 {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+	findings := Lint(parse(t, input), Config{NoPrelude: true})
+	if len(findings) != 1 || findings[0].Rule != UndefinedName {
+		t.Errorf("wrong findings without prelude: %v", findings)
+	}
+}
+
+func TestDisabledRules(t *testing.T) {
+	input := "let x = 1; y; len(1, 2)"
+	tests := []struct {
+		disabled []string
+		expected []string
+	}{
+		{nil, []string{UnusedVariable, DiscardedValue, UndefinedName, BuiltinArity}},
+		{[]string{UnusedVariable, DiscardedValue}, []string{UndefinedName, BuiltinArity}},
+		{Rules, []string{}},
+	}
+	for _, tt := range tests {
+		config := Config{Disabled: map[string]bool{}}
+		for _, rule := range tt.disabled {
+			config.Disabled[rule] = true
+		}
+		got := []string{}
+		for _, f := range Lint(parse(t, input), config) {
+			got = append(got, f.Rule)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong rules with %v disabled. want=%v, got=%v", tt.disabled, tt.expected, got)
+		}
+	}
+}
+
+func TestFindingString(t *testing.T) {
+	findings := Lint(parse(t, "len(1, 2)"), Config{})
+	if len(findings) != 1 {
+		t.Fatalf("wrong number of findings. got=%v", findings)
+	}
+	expected := "1:4: wrong number of arguments to len. got=2, want=1 (builtin-arity)"
+	if findings[0].String() != expected {
+		t.Errorf("wrong string. want=%q, got=%q", expected, findings[0].String())
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestLintAfterSyntaxError(t *testing.T) {
+	p := parser.NewParser(lexer.NewLexer("let x = ;\nlet y = 1;\nz"))
+	program := p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatal("expected parser errors")
+	}
+	var got []string
+	for _, f := range Lint(program, Config{}) {
+		got = append(got, f.String())
+	}
+	expected := []string{
+		"2:5: y is never used (unused)",
+		"3:1: z is not defined (undefined)",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("wrong findings. want=%q, got=%q", expected, got)
+	}
+}
@@ -1,5 +1,260 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/module"
+	"interpreter/object"
+	"interpreter/optimizer"
+	"interpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"vm/compiler"
+	"vm/disasm"
+	"vm/lint"
+	"vm/vm"
+)
+
+const usage = `usage: vm <command> [arguments]
+
+commands:
+  compile [-o file.mkc] [-optimize] [-no-prelude] [-json] [-color] file.mk
+  run [-optimize] [-no-prelude] [-json] [-color] file.mk|file.mkc
+  disasm [-dot] [-optimize] [-no-prelude] [-json] [-color] file.mk|file.mkc
+  lint [-disable rule,...] [-no-prelude] file...
+`
+
 func main() {
-	// Code here
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "compile":
+		os.Exit(compileCommand(os.Args[2:]))
+	case "run":
+		os.Exit(runCommand(os.Args[2:]))
+	case "disasm":
+		os.Exit(disasmCommand(os.Args[2:]))
+	case "lint":
+		os.Exit(lintCommand(os.Args[2:]))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// compileFlags adds the flags controlling compilation to flags.
+func compileFlags(flags *flag.FlagSet) (optimize, noPrelude *bool) {
+	optimize = flags.Bool("optimize", false, "fold constants, remove dead code and run the peephole optimizer")
+	noPrelude = flags.Bool("no-prelude", false, "do not load the prelude standard library")
+	return optimize, noPrelude
+}
+
+// reportFlags adds the flags controlling how errors are reported to flags.
+func reportFlags(flags *flag.FlagSet) (json, color *bool) {
+	json = flags.Bool("json", false, "report errors as JSON")
+	color = flags.Bool("color", false, "highlight errors with colors")
+	return json, color
+}
+
+// report writes the diagnostics of err, an error of the program in the file
+// at path, to the standard error: as JSON, or rendered with the source lines
+// they point at.
+func report(path string, err error, json, color bool) {
+	diags := diagnostic.FromError(err)
+	for _, d := range diags {
+		if d.File == "" {
+			d.File = path
+		}
+	}
+	if json {
+		diagnostic.WriteJSON(os.Stderr, diags)
+		return
+	}
+	var opts []diagnostic.RenderOption
+	if color {
+		opts = append(opts, diagnostic.WithColor())
+	}
+	for _, d := range diags {
+		var src []byte
+		if filepath.Ext(d.File) != ".mkc" {
+			src, _ = os.ReadFile(d.File)
+		}
+		d.Render(os.Stderr, string(src), opts...)
+	}
+}
+
+// compileFile compiles the program in the file at path and the modules it
+// imports.
+func compileFile(path string, optimize, noPrelude bool) (*compiler.ByteCode, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	loader := module.NewLoader(module.SearchPathFromEnv()...)
+	program, err := loader.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	if _, err := evaluator.ExpandMacros(program, macroEnv); err != nil {
+		return nil, err
+	}
+	opts := []compiler.Option{compiler.WithLoader(loader, path)}
+	if optimize {
+		opts = append(opts, compiler.WithOptimizer(optimizer.All), compiler.WithPeephole())
+	}
+	if noPrelude {
+		opts = append(opts, compiler.WithoutPrelude())
+	}
+	comp := compiler.NewCompiler(opts...)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	return comp.ByteCode(), nil
+}
+
+// compileCommand compiles a source file to a .mkc file and returns the exit
+// code.
+func compileCommand(args []string) int {
+	flags := flag.NewFlagSet("compile", flag.ExitOnError)
+	output := flags.String("o", "", "output file (default: the input file with the extension .mkc)")
+	optimize, noPrelude := compileFlags(flags)
+	json, color := reportFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	path := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+	bytecode, err := compileFile(path, *optimize, *noPrelude)
+	if err != nil {
+		report(path, err, *json, *color)
+		return 1
+	}
+	data, err := bytecode.MarshalBinary()
+	if err == nil {
+		err = os.WriteFile(*output, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// loadFile returns the bytecode in a .mkc file, or compiles a source file.
+func loadFile(path string, optimize, noPrelude bool) (*compiler.ByteCode, error) {
+	if filepath.Ext(path) != ".mkc" {
+		return compileFile(path, optimize, noPrelude)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bytecode := &compiler.ByteCode{}
+	if err := bytecode.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return bytecode, nil
+}
+
+// runCommand runs a .mkc file, or a source file after compiling it, and
+// returns the exit code.
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	optimize, noPrelude := compileFlags(flags)
+	json, color := reportFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	path := flags.Arg(0)
+	bytecode, err := loadFile(path, *optimize, *noPrelude)
+	var machine *vm.VM
+	if err == nil {
+		machine, err = vm.NewVerifiedVM(bytecode)
+	}
+	if err == nil {
+		err = machine.Run()
+	}
+	if err != nil {
+		report(path, err, *json, *color)
+		return 1
+	}
+	return 0
+}
+
+// disasmCommand prints the disassembly of a .mkc or source file and returns
+// the exit code.
+func disasmCommand(args []string) int {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	dot := flags.Bool("dot", false, "print the control-flow graph in the Graphviz DOT language")
+	optimize, noPrelude := compileFlags(flags)
+	json, color := reportFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	bytecode, err := loadFile(flags.Arg(0), *optimize, *noPrelude)
+	if err != nil {
+		report(flags.Arg(0), err, *json, *color)
+		return 1
+	}
+	if *dot {
+		fmt.Print(disasm.Graph(bytecode))
+	} else {
+		fmt.Print(disasm.Disassemble(bytecode))
+	}
+	return 0
+}
+
+// lintCommand lints the files in args and returns the exit code, 1 if any
+// file has findings or does not parse.
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	disable := flags.String("disable", "", "comma separated IDs of rules to suppress: "+strings.Join(lint.Rules, ", "))
+	noPrelude := flags.Bool("no-prelude", false, "report uses of prelude functions as undefined")
+	flags.Parse(args)
+
+	config := lint.Config{Disabled: map[string]bool{}, NoPrelude: *noPrelude}
+	for _, rule := range strings.Split(*disable, ",") {
+		if rule != "" {
+			config.Disabled[strings.TrimSpace(rule)] = true
+		}
+	}
+	code := 0
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+			continue
+		}
+		// the statements around syntax errors are still linted
+		p := parser.NewParser(lexer.NewLexer(string(src)))
+		program := p.ParseProgram()
+		for _, d := range p.Diagnostics() {
+			d.File = path
+			fmt.Println(d.String())
+			code = 1
+		}
+		for _, finding := range lint.Lint(program, config) {
+			fmt.Printf("%s:%s\n", path, finding)
+			code = 1
+		}
+	}
+	return code
 }
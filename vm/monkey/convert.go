@@ -0,0 +1,315 @@
+package monkey
+
+import (
+	"fmt"
+	"interpreter/object"
+	"reflect"
+)
+
+var objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// ToObject converts a Go value to a Monkey value:
+//
+//   - nil to NULL, and an object.Object to itself,
+//   - integers to INTEGER, strings to STRING and bools to BOOLEAN,
+//   - slices and arrays to ARRAY, and maps to HASH, converting their
+//     elements,
+//   - structs and pointers to structs to a GoObject,
+//   - functions to builtins.
+//
+// A function is called with its arguments converted to its parameter types,
+// where object.Object takes any value and other interfaces take the result
+// of FromObject. It may return nothing, a value, an error, or a value and
+// an error; a non-nil error is raised as a Monkey error.
+func ToObject(value any) (object.Object, error) {
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+	return toObject(reflect.ValueOf(value))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	if !v.IsValid() {
+		return object.NULL, nil
+	}
+	if v.Type().Implements(objectType) {
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.String:
+		return &object.StringObject{Value: v.String()}, nil
+	case reflect.Bool:
+		if v.Bool() {
+			return object.TRUE, nil
+		}
+		return object.FALSE, nil
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		if v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Struct {
+			return wrap(v), nil
+		}
+		return toObject(v.Elem())
+	case reflect.Struct:
+		return wrap(v), nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]object.Object, v.Len())
+		for n := range elements {
+			element, err := toObject(v.Index(n))
+			if err != nil {
+				return nil, err
+			}
+			elements[n] = element
+		}
+		return &object.ArrayObject{Elements: elements}, nil
+	case reflect.Map:
+		pairs := map[object.HashKey]object.HashPair{}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := toObject(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.HashObject{Pairs: pairs}, nil
+	case reflect.Func:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return builtin(v), nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Monkey value", v.Type())
+}
+
+// builtin wraps the function fn in a builtin.
+func builtin(fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+	arity := t.NumIn()
+	if t.IsVariadic() {
+		arity = -1
+	}
+	return &object.Builtin{Arity: arity, Fn: func(args ...object.Object) object.Object {
+		required := t.NumIn()
+		if t.IsVariadic() {
+			required--
+		}
+		if len(args) < required || (arity >= 0 && len(args) > arity) {
+			return &object.Error{Message: object.ArityMismatch(len(args), required, arity)}
+		}
+		in := make([]reflect.Value, len(args))
+		for n, arg := range args {
+			paramType := t.In(min(n, t.NumIn()-1))
+			if t.IsVariadic() && n >= required {
+				paramType = paramType.Elem()
+			}
+			value, err := convertTo(arg, paramType)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("argument %d: %s", n+1, err)}
+			}
+			in[n] = value
+		}
+		out, err := call(fn, in)
+		if err != nil {
+			return &object.Error{Message: err.Error(), Err: err}
+		}
+		if len(out) > 0 && t.Out(len(out)-1) == errorType {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return &object.Error{Message: err.Error(), Err: err}
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return object.NULL
+		}
+		result, err := toObject(out[0])
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return result
+	}}
+}
+
+// call calls fn with in, returning a panic of fn as an error so that a
+// failing Go function fails the script instead of the host.
+func call(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn.Call(in), nil
+}
+
+// convertTo converts obj to a Go value of type t.
+func convertTo(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("cannot use %s as %s", typeName(obj), t)
+	}
+	if g, ok := obj.(*GoObject); ok {
+		switch {
+		case !g.Value.IsValid():
+			return mismatch()
+		case g.Value.Type().AssignableTo(t):
+			return g.Value, nil
+		case g.Value.Kind() == reflect.Pointer && !g.Value.IsNil() && g.Value.Type().Elem().AssignableTo(t):
+			return g.Value.Elem(), nil
+		case g.Value.CanAddr() && g.Value.Addr().Type().AssignableTo(t):
+			return g.Value.Addr(), nil
+		}
+		return mismatch()
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		value, err := FromObject(obj)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if value == nil {
+			return reflect.Zero(t), nil
+		}
+		if !reflect.TypeOf(value).AssignableTo(t) {
+			return mismatch()
+		}
+		result := reflect.New(t).Elem()
+		result.Set(reflect.ValueOf(value))
+		return result, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		result := reflect.New(t).Elem()
+		if result.OverflowInt(integer.Value) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		result.SetInt(integer.Value)
+		return result, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*object.Integer)
+		if !ok {
+			return mismatch()
+		}
+		result := reflect.New(t).Elem()
+		if integer.Value < 0 || result.OverflowUint(uint64(integer.Value)) {
+			return reflect.Value{}, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		result.SetUint(uint64(integer.Value))
+		return result, nil
+	case reflect.String:
+		str, ok := obj.(*object.StringObject)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(str.Value).Convert(t), nil
+	case reflect.Bool:
+		boolean, ok := obj.(*object.Boolean)
+		if !ok {
+			return mismatch()
+		}
+		return reflect.ValueOf(boolean.Value).Convert(t), nil
+	case reflect.Slice:
+		array, ok := obj.(*object.ArrayObject)
+		if !ok {
+			return mismatch()
+		}
+		result := reflect.MakeSlice(t, len(array.Elements), len(array.Elements))
+		for n, element := range array.Elements {
+			value, err := convertTo(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Index(n).Set(value)
+		}
+		return result, nil
+	case reflect.Map:
+		hash, ok := obj.(*object.HashObject)
+		if !ok {
+			return mismatch()
+		}
+		result := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.Pairs {
+			key, err := convertTo(pair.Key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			value, err := convertTo(pair.Value, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.SetMapIndex(key, value)
+		}
+		return result, nil
+	}
+	return mismatch()
+}
+
+// FromObject converts a Monkey value to a Go value: INTEGER to int64,
+// STRING to string, BOOLEAN to bool, NULL to nil, ARRAY to []any, HASH to
+// map[any]any and a GoObject to the value it wraps. Other values, such as
+// functions, cannot be converted.
+func FromObject(obj object.Object) (any, error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.StringObject:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Null, nil:
+		return nil, nil
+	case *GoObject:
+		if !obj.Value.IsValid() {
+			return nil, nil
+		}
+		return obj.Value.Interface(), nil
+	case *object.ArrayObject:
+		result := make([]any, len(obj.Elements))
+		for n, element := range obj.Elements {
+			value, err := FromObject(element)
+			if err != nil {
+				return nil, err
+			}
+			result[n] = value
+		}
+		return result, nil
+	case *object.HashObject:
+		result := make(map[any]any, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, err := FromObject(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := FromObject(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = value
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+}
@@ -0,0 +1,356 @@
+// Package monkey embeds Monkey in Go programs. An Interpreter compiles and
+// runs programs on either engine, the tree-walking evaluator or the
+// bytecode VM, and keeps their globals between runs, so a host can define
+// values and functions for scripts and read back what they define.
+package monkey
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/filesystem"
+	"interpreter/lexer"
+	"interpreter/module"
+	"interpreter/object"
+	"interpreter/parser"
+	"reflect"
+
+	"vm/compiler"
+	"vm/vm"
+)
+
+// Engine selects how an Interpreter runs programs.
+type Engine int
+
+const (
+	// Evaluator runs programs by walking their syntax tree.
+	Evaluator Engine = iota
+	// VM compiles programs to bytecode and runs them on the VM.
+	VM
+)
+
+func (e Engine) String() string {
+	if e == VM {
+		return "vm"
+	}
+	return "evaluator"
+}
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithEngine makes the Interpreter run programs on engine. The default is
+// Evaluator.
+func WithEngine(engine Engine) Option {
+	return func(i *Interpreter) {
+		i.engine = engine
+	}
+}
+
+// WithoutPrelude keeps the Interpreter from loading the prelude standard
+// library.
+func WithoutPrelude() Option {
+	return func(i *Interpreter) {
+		i.noPrelude = true
+	}
+}
+
+// WithLimits bounds the resources of every Run and Call separately.
+func WithLimits(limits object.Limits) Option {
+	return func(i *Interpreter) {
+		i.limits = &limits
+	}
+}
+
+// WithFileSystem defines the file system builtins of access, which are not
+// defined otherwise.
+func WithFileSystem(access *filesystem.Access) Option {
+	return func(i *Interpreter) {
+		i.fileSystem = access
+	}
+}
+
+// WithIO makes the programs read their input from and write their output
+// to stdio instead of the standard input and output of the process.
+func WithIO(stdio *object.IO) Option {
+	return func(i *Interpreter) {
+		i.io = stdio
+	}
+}
+
+// RuntimeError is the error of a program that failed while running.
+type RuntimeError struct {
+	Message string
+	// Err is the *diagnostic.Diagnostic describing the error, which wraps
+	// the Go error that stopped the program, such as object.ErrStepLimit.
+	Err error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Program is a program compiled by an Interpreter, to be run by the same
+// Interpreter.
+type Program struct {
+	program *ast.Program
+	// the bytecode and compiler state of the program on the VM, compiled
+	// against the globals of generation
+	bytecode   *compiler.ByteCode
+	state      *compiler.State
+	generation int
+}
+
+// Interpreter compiles and runs programs that share their globals. It is
+// not safe for concurrent use.
+type Interpreter struct {
+	engine     Engine
+	noPrelude  bool
+	limits     *object.Limits
+	fileSystem *filesystem.Access
+	io         *object.IO
+	loader     *module.Loader
+	// macros defined by the programs compiled so far
+	macroEnv *object.Environment
+
+	// the globals of the evaluator
+	env *object.Environment
+
+	// the globals of the VM, their symbols, the constants of the programs
+	// that defined them, and a counter of the changes to the symbols, which
+	// invalidate programs compiled before them
+	state      *compiler.State
+	globals    []object.Object
+	constants  []object.Object
+	generation int
+}
+
+// New returns an Interpreter, with the prelude loaded unless it is created
+// WithoutPrelude.
+func New(opts ...Option) *Interpreter {
+	i := &Interpreter{
+		loader:   module.NewLoader(module.SearchPathFromEnv()...),
+		macroEnv: object.NewEnvironment(),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.loadPrelude()
+	if i.fileSystem != nil {
+		for name, builtin := range i.fileSystem.Builtins() {
+			i.SetGlobal(name, builtin)
+		}
+	}
+	return i
+}
+
+// loadPrelude sets up the globals of the engine, which are those of the
+// prelude unless i is created WithoutPrelude.
+func (i *Interpreter) loadPrelude() {
+	empty := &ast.Program{}
+	if i.engine == VM {
+		compilerOpts := []compiler.Option{compiler.WithLoader(i.loader, "")}
+		if i.noPrelude {
+			compilerOpts = append(compilerOpts, compiler.WithoutPrelude())
+		}
+		comp := compiler.NewCompiler(compilerOpts...)
+		if err := comp.Compile(empty); err != nil {
+			panic("monkey: prelude: " + err.Error())
+		}
+		bytecode := comp.ByteCode()
+		i.state, i.constants = comp.State(), bytecode.Constants
+		i.globals = make([]object.Object, vm.GlobalSize)
+		machine := vm.NewVMWithGlobals(bytecode, i.globals)
+		machine.SetIO(i.io)
+		if err := machine.Run(); err != nil {
+			panic("monkey: prelude: " + err.Error())
+		}
+		return
+	}
+	i.env = object.NewEnvironment()
+	i.env.SetLoader(i.loader)
+	i.env.SetIO(i.io)
+	if i.noPrelude {
+		i.env.DisablePrelude()
+	}
+	if err, ok := evaluator.Eval(empty, i.env).(*object.Error); ok {
+		panic("monkey: prelude: " + err.Message)
+	}
+}
+
+// Engine returns the engine of i.
+func (i *Interpreter) Engine() Engine {
+	return i.engine
+}
+
+// Compile parses source, expands its macros and, on the VM, compiles it
+// against the globals defined so far.
+func (i *Interpreter) Compile(source string) (*Program, error) {
+	p := parser.NewParser(lexer.NewLexer(source))
+	program := p.ParseProgram()
+	if diags := p.Diagnostics(); len(diags) != 0 {
+		return nil, fmt.Errorf("parse errors: %w", diags)
+	}
+	evaluator.DefineMacros(program, i.macroEnv)
+	if _, err := evaluator.ExpandMacros(program, i.macroEnv); err != nil {
+		return nil, err
+	}
+	result := &Program{program: program}
+	if i.engine == VM {
+		if err := i.compile(result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// compile compiles p to bytecode against the current globals.
+func (i *Interpreter) compile(p *Program) error {
+	comp := compiler.NewCompiler(compiler.WithLoader(i.loader, ""), compiler.WithState(i.state))
+	if err := comp.Compile(p.program); err != nil {
+		return err
+	}
+	p.bytecode, p.state, p.generation = comp.ByteCode(), comp.State(), i.generation
+	return nil
+}
+
+// Run runs p and returns the value of its last statement, or NULL if that
+// is not an expression. A program that fails returns a *RuntimeError; the
+// globals it defined before failing are kept on the evaluator only.
+func (i *Interpreter) Run(p *Program) (object.Object, error) {
+	var result object.Object
+	if i.engine == VM {
+		if p.generation != i.generation {
+			// globals were defined since p was compiled
+			if err := i.compile(p); err != nil {
+				return nil, err
+			}
+		}
+		machine := vm.NewVMWithGlobals(p.bytecode, i.globals)
+		machine.SetIO(i.io)
+		if i.limits != nil {
+			machine.SetLimits(*i.limits)
+		}
+		if err := machine.Run(); err != nil {
+			return nil, &RuntimeError{Message: err.Error(), Err: err}
+		}
+		i.state, i.constants = p.state, p.bytecode.Constants
+		i.generation++
+		result = machine.LastPoppedStackElem()
+	} else {
+		if i.limits != nil {
+			i.env.SetLimits(*i.limits)
+		}
+		result = evaluator.Eval(p.program, i.env)
+	}
+	if err, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Message: err.Message, Err: err.Diagnostic()}
+	}
+	statements := p.program.Statements
+	if len(statements) == 0 || result == nil {
+		return evaluator.NULL, nil
+	}
+	if _, ok := statements[len(statements)-1].(*ast.ExpressionStatement); !ok {
+		return evaluator.NULL, nil
+	}
+	return result, nil
+}
+
+// RunString compiles and runs source.
+func (i *Interpreter) RunString(source string) (object.Object, error) {
+	p, err := i.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	return i.Run(p)
+}
+
+// SetGlobal defines the global name with value converted by ToObject, for
+// the programs compiled afterwards.
+func (i *Interpreter) SetGlobal(name string, value any) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	if i.engine != VM {
+		i.env.Set(name, obj)
+		return nil
+	}
+	symbol, ok := i.state.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = i.state.Define(name)
+		i.generation++
+	}
+	if symbol.Index >= len(i.globals) {
+		return fmt.Errorf("too many globals to define %s", name)
+	}
+	i.globals[symbol.Index] = obj
+	return nil
+}
+
+// GetGlobal returns the value of the global name.
+func (i *Interpreter) GetGlobal(name string) (object.Object, bool) {
+	if i.engine != VM {
+		return i.env.Get(name)
+	}
+	symbol, ok := i.state.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || i.globals[symbol.Index] == nil {
+		return nil, false
+	}
+	return i.globals[symbol.Index], true
+}
+
+// Register defines the global name as the Go function fn, see ToObject.
+func (i *Interpreter) Register(name string, fn any) error {
+	if reflect.TypeOf(fn) == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		return fmt.Errorf("cannot register %T as a function", fn)
+	}
+	return i.SetGlobal(name, fn)
+}
+
+// Call calls the function in the global name with args converted by
+// ToObject and returns its result.
+func (i *Interpreter) Call(name string, args ...any) (object.Object, error) {
+	fn, ok := i.GetGlobal(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined global %s", name)
+	}
+	objects := make([]object.Object, len(args))
+	for n, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, err
+		}
+		objects[n] = obj
+	}
+	var result object.Object
+	if i.engine == VM {
+		if _, ok := fn.(*object.CompiledFunction); !ok {
+			if _, ok := fn.(*object.Builtin); !ok {
+				return nil, fmt.Errorf("%s is not a function: %s", name, fn.Type())
+			}
+		}
+		machine := vm.NewVMWithGlobals(&compiler.ByteCode{Constants: i.constants}, i.globals)
+		machine.SetIO(i.io)
+		if i.limits != nil {
+			machine.SetLimits(*i.limits)
+		}
+		var err error
+		if result, err = machine.Call(fn, objects...); err != nil {
+			return nil, &RuntimeError{Message: err.Error(), Err: err}
+		}
+	} else {
+		if i.limits != nil {
+			i.env.SetLimits(*i.limits)
+		}
+		result = evaluator.ApplyFunction(fn, objects, i.env)
+	}
+	if err, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Message: err.Message, Err: err.Diagnostic()}
+	}
+	return result, nil
+}
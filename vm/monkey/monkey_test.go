@@ -0,0 +1,393 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/filesystem"
+	"interpreter/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var engines = []Engine{Evaluator, VM}
+
+// value converts obj with FromObject, failing t on errors.
+func value(t *testing.T, obj object.Object) any {
+	t.Helper()
+	v, err := FromObject(obj)
+	if err != nil {
+		t.Fatalf("FromObject(%s): %s", obj.Inspect(), err)
+	}
+	return v
+}
+
+// runString runs input in i. The VM does not stop at errors returned by
+// builtins but leaves them on the stack, so runString returns them as
+// errors for both engines.
+func runString(i *Interpreter, input string) (object.Object, error) {
+	result, err := i.RunString(input)
+	if e, ok := result.(*object.Error); ok && err == nil {
+		return nil, &RuntimeError{Message: e.Message, Err: e.Err}
+	}
+	return result, err
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		inputs   []string // run in order; the last gives the result
+		expected any
+	}{
+		{[]string{"1 + 2"}, int64(3)},
+		{[]string{`"a" + "b"`}, "a" + "b"},
+		{[]string{"let x = 5;"}, nil},
+		{[]string{"let x = 5;", "x * 2"}, int64(10)},
+		{[]string{"let f = fn(x) { x + 1 };", "let y = f(1);", "f(y)"}, int64(3)},
+		{[]string{"[1, true, puts()]"}, []any{int64(1), true, nil}},
+		{[]string{`{"a": 1}`}, map[any]any{"a": int64(1)}},
+		{[]string{"sum(range(0, 4))"}, int64(6)},
+		{[]string{"let len = fn(x) { 42 };", `len("abc")`}, int64(42)},
+		{[]string{"let twice = macro(x) { quote(unquote(x) * 2) };", "twice(4)"}, int64(8)},
+	}
+	for _, engine := range engines {
+		for _, tt := range tests {
+			i := New(WithEngine(engine))
+			var result object.Object
+			for _, input := range tt.inputs {
+				var err error
+				if result, err = i.RunString(input); err != nil {
+					t.Fatalf("%s: %q: %s", engine, input, err)
+				}
+			}
+			if got := value(t, result); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: %q: wrong result. want=%#v, got=%#v", engine, tt.inputs, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, engine := range engines {
+		i := New(WithEngine(engine))
+		if _, err := i.RunString("let x = ;"); err == nil || !strings.HasPrefix(err.Error(), "parse errors: ") {
+			t.Errorf("%s: wrong parse error: %v", engine, err)
+		}
+		var runtimeErr *RuntimeError
+		if _, err := i.RunString("1 + true"); !errors.As(err, &runtimeErr) {
+			t.Errorf("%s: expected a RuntimeError, got %v", engine, err)
+		}
+		if _, err := i.RunString("1 + 1"); err != nil {
+			t.Errorf("%s: run after an error failed: %s", engine, err)
+		}
+	}
+}
+
+func TestWithoutPrelude(t *testing.T) {
+	for _, engine := range engines {
+		i := New(WithEngine(engine), WithoutPrelude())
+		if _, ok := i.GetGlobal("map"); ok {
+			t.Errorf("%s: prelude loaded", engine)
+		}
+		if _, err := i.RunString("map([1], fn(x) { x })"); err == nil {
+			t.Errorf("%s: expected an error calling map", engine)
+		}
+		if _, ok := New(WithEngine(engine)).GetGlobal("map"); !ok {
+			t.Errorf("%s: prelude not loaded", engine)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, engine := range engines {
+		i := New(WithEngine(engine), WithLimits(object.Limits{MaxSteps: 1000}))
+		if _, err := i.RunString("let loop = fn() { loop() };"); err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if _, err := i.RunString("loop()"); !errors.Is(err, object.ErrStepLimit) {
+			t.Errorf("%s: Run: expected ErrStepLimit, got %v", engine, err)
+		}
+		if _, err := i.Call("loop"); !errors.Is(err, object.ErrStepLimit) {
+			t.Errorf("%s: Call: expected ErrStepLimit, got %v", engine, err)
+		}
+		// the limits apply to each run separately
+		for n := 0; n < 3; n++ {
+			if _, err := i.RunString("sum(range(0, 10))"); err != nil {
+				t.Errorf("%s: %s", engine, err)
+			}
+		}
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	for _, engine := range engines {
+		i := New(WithEngine(engine))
+		for name, v := range map[string]any{
+			"n":     7,
+			"name":  "monkey",
+			"ok":    true,
+			"list":  []int{1, 2},
+			"table": map[string]bool{"a": true},
+		} {
+			if err := i.SetGlobal(name, v); err != nil {
+				t.Fatalf("%s: SetGlobal(%s): %s", engine, name, err)
+			}
+		}
+		result, err := i.RunString(`if (ok && table["a"]) { name + ":" + puts() } else { 0 }`)
+		if err == nil {
+			t.Errorf("%s: expected an error adding NULL, got %s", engine, result.Inspect())
+		}
+		result, err = i.RunString(`if (table["a"]) { name } else { "" }; let total = n + list[1];`)
+		if err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if got := value(t, result); got != nil {
+			t.Errorf("%s: expected NULL after a let statement, got %#v", engine, got)
+		}
+		total, ok := i.GetGlobal("total")
+		if !ok || value(t, total) != int64(9) {
+			t.Errorf("%s: wrong total: %v", engine, total)
+		}
+		if _, ok := i.GetGlobal("missing"); ok {
+			t.Errorf("%s: undefined global found", engine)
+		}
+		if _, ok := i.GetGlobal("len"); ok {
+			t.Errorf("%s: builtin found as a global", engine)
+		}
+		if err := i.SetGlobal("n", 1.5); err == nil {
+			t.Errorf("%s: float converted", engine)
+		}
+
+		// a global redefined by the host after a program was compiled
+		p, err := i.Compile("n + 1")
+		if err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		i.SetGlobal("n", 1)
+		i.SetGlobal("other", 2)
+		for run := 0; run < 2; run++ {
+			result, err := i.Run(p)
+			if err != nil || value(t, result) != int64(2) {
+				t.Errorf("%s: run %d: wrong result %v, %v", engine, run, result, err)
+			}
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	errEmpty := errors.New("empty name")
+	funcs := map[string]any{
+		"add": func(a, b int) int { return a + b },
+		"greet": func(name string) (string, error) {
+			if name == "" {
+				return "", errEmpty
+			}
+			return "hello " + name, nil
+		},
+		"total": func(xs ...uint8) int {
+			total := 0
+			for _, x := range xs {
+				total += int(x)
+			}
+			return total
+		},
+		"keys": func(m map[string]int) []string {
+			keys := []string{}
+			for k := range m {
+				keys = append(keys, k)
+			}
+			return keys
+		},
+		"describe": func(v any, obj object.Object) string { return fmt.Sprintf("%v %s", v, obj.Type()) },
+		"nothing":  func() {},
+		"div":      func(a, b int) (int, error) { return a / b, nil },
+	}
+	tests := []struct {
+		input    string
+		expected any
+		err      string // the expected error, if any
+	}{
+		{input: "add(1, 2)", expected: int64(3)},
+		{input: `greet("monkey")`, expected: "hello monkey"},
+		{input: `greet("")`, err: "empty name"},
+		{input: "total()", expected: int64(0)},
+		{input: "total(1, 2, 3)", expected: int64(6)},
+		{input: "total(1, 256)", err: "argument 2: 256 overflows uint8"},
+		{input: "total(-1)", err: "argument 1: -1 overflows uint8"},
+		{input: `keys({"a": 1})`, expected: []any{"a"}},
+		{input: `keys({"a": "b"})`, err: "argument 1: cannot use STRING as int"},
+		{input: `describe([1], "s")`, expected: "[1] STRING"},
+		{input: "nothing()", expected: nil},
+		{input: "div(1, 0)", err: "panic: runtime error: integer divide by zero"},
+		{input: "div(1, 0); 1", err: "panic: runtime error: integer divide by zero"},
+		{input: "add(1)", err: "wrong number of arguments. got=1, want=2"},
+		{input: `add(1, "2")`, err: "argument 2: cannot use STRING as int"},
+		{input: "map([1, 2], fn(x) { add(x, x) })", expected: []any{int64(2), int64(4)}},
+	}
+	for _, engine := range engines {
+		i := New(WithEngine(engine))
+		for name, fn := range funcs {
+			if err := i.Register(name, fn); err != nil {
+				t.Fatalf("%s: Register(%s): %s", engine, name, err)
+			}
+		}
+		if err := i.Register("x", 1); err == nil {
+			t.Errorf("%s: registered a non-function", engine)
+		}
+		for _, tt := range tests {
+			result, err := runString(i, tt.input)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("%s: %s: wrong error. want=%q, got=%v", engine, tt.input, tt.err, err)
+				}
+				if tt.err == "empty name" && !errors.Is(err, errEmpty) {
+					t.Errorf("%s: %s: error does not wrap the Go error", engine, tt.input)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %s: %s", engine, tt.input, err)
+				continue
+			}
+			if got := value(t, result); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: %s: wrong result. want=%#v, got=%#v", engine, tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	for _, engine := range engines {
+		i := New(WithEngine(engine))
+		i.Register("twice", func(n int) int { return 2 * n })
+		if _, err := i.RunString("let apply = fn(f, x, y = 1) { f(x) + y }; let n = 1;"); err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		tests := []struct {
+			name     string
+			args     []any
+			expected any
+			err      string
+		}{
+			{name: "twice", args: []any{4}, expected: int64(8)},
+			{name: "apply", args: []any{func(x int) int { return -x }, 5}, expected: int64(-4)},
+			{name: "apply", args: []any{func(x int) int { return -x }, 5, 10}, expected: int64(5)},
+			{name: "map", args: []any{[]int{1, 2}, func(x int) int { return x * 10 }}, expected: []any{int64(10), int64(20)}},
+			{name: "reverse", args: []any{[]string{"a", "b"}}, expected: []any{"b", "a"}},
+			{name: "missing", err: "undefined global missing"},
+			{name: "apply", args: []any{1.5}, err: "cannot convert float64 to a Monkey value"},
+			{name: "apply", args: []any{1}, err: "wrong number of arguments. got=1, want=2..3"},
+		}
+		for _, tt := range tests {
+			result, err := i.Call(tt.name, tt.args...)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("%s: %s: wrong error. want=%q, got=%v", engine, tt.name, tt.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %s: %s", engine, tt.name, err)
+				continue
+			}
+			if got := value(t, result); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: %s: wrong result. want=%#v, got=%#v", engine, tt.name, tt.expected, got)
+			}
+		}
+		if _, err := i.Call("n"); err == nil {
+			t.Errorf("%s: called a non-function", engine)
+		}
+		// the interpreter still works after calls
+		if result, err := i.RunString("apply(twice, n)"); err != nil || value(t, result) != int64(3) {
+			t.Errorf("%s: run after calls: %v, %v", engine, result, err)
+		}
+	}
+}
+
+func TestConversion(t *testing.T) {
+	type myString string
+	tests := []struct {
+		input    any
+		expected any // the result of FromObject
+	}{
+		{nil, nil},
+		{int8(-3), int64(-3)},
+		{uint64(1 << 40), int64(1 << 40)},
+		{myString("s"), "s"},
+		{false, false},
+		{[2]bool{true, false}, []any{true, false}},
+		{[]any{1, "a", nil, []int{}}, []any{int64(1), "a", nil, []any{}}},
+		{map[int]string{1: "one"}, map[any]any{int64(1): "one"}},
+		{map[bool][]int{true: {1}}, map[any]any{true: []any{int64(1)}}},
+		{&object.Integer{Value: 4}, int64(4)},
+		{(*int)(nil), nil},
+		{struct{ A int }{1}, struct{ A int }{1}},
+	}
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%#v): %s", tt.input, err)
+			continue
+		}
+		if got := value(t, obj); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToObject(%#v): wrong value. want=%#v, got=%#v", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []any{1.5, uint64(1 << 63), map[any]int{1.5: 1}, make(chan int)} {
+		if _, err := ToObject(input); err == nil {
+			t.Errorf("ToObject(%#v): expected an error", input)
+		}
+	}
+	if _, err := FromObject(&object.Builtin{}); err == nil {
+		t.Errorf("FromObject(builtin): expected an error")
+	}
+}
+
+func TestWithFileSystem(t *testing.T) {
+	for _, engine := range engines {
+		if _, err := New(WithEngine(engine)).RunString(`read_file("a.txt")`); err == nil {
+			t.Errorf("%s: file system builtins defined by default", engine)
+		}
+
+		access, err := filesystem.NewAccess(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		i := New(WithEngine(engine), WithFileSystem(access))
+		tests := []struct {
+			input    string
+			expected any
+		}{
+			{`write_file("a.txt", "hi")`, []any{nil, nil}},
+			{`let [text, err] = read_file("a.txt"); if (err) { err } else { text }`, "hi"},
+			{`let [text, err] = read_file("../a.txt"); if (err) { err } else { text }`, "read_file ../a.txt: outside the allowed directories"},
+			{`list_dir(".")[0]`, []any{"a.txt"}},
+		}
+		for _, tt := range tests {
+			result, err := i.RunString(tt.input)
+			if err != nil {
+				t.Errorf("%s: %s: %s", engine, tt.input, err)
+				continue
+			}
+			if got := value(t, result); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: %s: wrong result. want=%#v, got=%#v", engine, tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestWithIO(t *testing.T) {
+	for _, engine := range engines {
+		var out strings.Builder
+		i := New(WithEngine(engine), WithIO(object.NewIO(strings.NewReader("1\n2\n"), &out)))
+		if _, err := i.RunString(`let echo = fn() { println(read_line(), "!") }; echo();`); err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if _, err := i.Call("echo"); err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if out.String() != "1 !\n2 !\n" {
+			t.Errorf("%s: wrong output. got=%q", engine, out.String())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package monkey
+
+import (
+	"fmt"
+	"interpreter/object"
+	"reflect"
+)
+
+// GO_OBJ is the type of the values wrapping Go values.
+const GO_OBJ object.ObjectType = "GO"
+
+var _ object.Object = (*GoObject)(nil)
+var _ object.Indexable = (*GoObject)(nil)
+
+// GoObject exposes a Go value to scripts. Indexing it with the name of an
+// exported field of a struct, or of a pointer to a struct, returns the
+// value of the field converted by ToObject. Indexing it with the name of
+// an exported method returns the method as a builtin, which converts its
+// arguments and results like the functions converted by ToObject.
+//
+// Fields are read when they are indexed, so a script sees the changes that
+// methods with pointer receivers make. A value that is not a pointer is
+// wrapped as a copy, which has the methods of both the value and the
+// pointer receivers; those with pointer receivers change the copy.
+//
+// A panic of a method is raised as a Monkey error.
+type GoObject struct {
+	Value reflect.Value
+}
+
+// Wrap returns value as a GoObject. ToObject wraps structs and pointers to
+// structs; Wrap exposes the methods of other types.
+func Wrap(value any) *GoObject {
+	return wrap(reflect.ValueOf(value))
+}
+
+// wrap returns v as a GoObject, copying it to an addressable value unless
+// it is a pointer or an interface, so that its pointer methods are found.
+func wrap(v reflect.Value) *GoObject {
+	if !v.IsValid() || v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface || v.CanAddr() {
+		return &GoObject{Value: v}
+	}
+	addressable := reflect.New(v.Type()).Elem()
+	addressable.Set(v)
+	return &GoObject{Value: addressable}
+}
+
+func (g *GoObject) Type() object.ObjectType {
+	return GO_OBJ
+}
+
+func (g *GoObject) Inspect() string {
+	if !g.Value.IsValid() {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%v", g.Value.Interface())
+}
+
+// goType returns the name of the type of the wrapped value, or "nil".
+func (g *GoObject) goType() string {
+	if !g.Value.IsValid() {
+		return "nil"
+	}
+	return g.Value.Type().String()
+}
+
+// Index returns the field or method named by key.
+func (g *GoObject) Index(key object.Object) object.Object {
+	name, ok := key.(*object.StringObject)
+	if !ok {
+		return &object.Error{Message: fmt.Sprintf("index of %s must be STRING, got %s", g.goType(), key.Type())}
+	}
+	if !g.Value.IsValid() {
+		return &object.Error{Message: fmt.Sprintf("%s of nil", name.Value)}
+	}
+	methods := g.Value
+	if methods.CanAddr() {
+		methods = methods.Addr()
+	}
+	if method := methods.MethodByName(name.Value); method.IsValid() {
+		return builtin(method)
+	}
+	value := g.Value
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return &object.Error{Message: fmt.Sprintf("%s of nil %s", name.Value, g.goType())}
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Struct {
+		if field, ok := value.Type().FieldByName(name.Value); ok && field.IsExported() {
+			fieldValue, err := value.FieldByIndexErr(field.Index)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s of %s: %s", name.Value, g.goType(), err)}
+			}
+			result, err := toObject(fieldValue)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("%s of %s: %s", name.Value, g.goType(), err)}
+			}
+			return result
+		}
+	}
+	return &object.Error{Message: fmt.Sprintf("%s has no field or method %s", g.goType(), name.Value)}
+}
+
+// typeName describes the type of obj in conversion errors.
+func typeName(obj object.Object) string {
+	if g, ok := obj.(*GoObject); ok {
+		return g.goType()
+	}
+	return string(obj.Type())
+}
@@ -0,0 +1,163 @@
+package monkey
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type address struct {
+	City string
+}
+
+type audit struct {
+	Created string
+}
+
+type account struct {
+	audit
+	Owner   string
+	Balance int
+	Tags    []string
+	Address *address
+	Parent  *account
+	Rate    float64
+	history []int
+}
+
+var errNegative = errors.New("negative amount")
+
+func (a *account) Deposit(amount int) error {
+	if amount < 0 {
+		return errNegative
+	}
+	a.Balance += amount
+	a.history = append(a.history, amount)
+	return nil
+}
+
+func (a account) Summary() string {
+	return fmt.Sprintf("%s: %d", a.Owner, a.Balance)
+}
+
+func (a *account) Home() address {
+	return *a.Address
+}
+
+type counter struct {
+	N int
+}
+
+func (c *counter) Inc() {
+	c.N++
+}
+
+type celsius int
+
+func (c celsius) Fahrenheit() int {
+	return int(c)*9/5 + 32
+}
+
+func TestGoObject(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+		err      string
+	}{
+		{input: `acct["Owner"]`, expected: "ann"},
+		{input: `acct["Tags"]`, expected: []any{"a", "b"}},
+		{input: `acct["Created"]`, expected: "today"},
+		{input: `acct["Address"]["City"]`, expected: "Oslo"},
+		{input: `acct["Home"]()["City"]`, expected: "Oslo"},
+		{input: `acct["Parent"]`, expected: nil},
+		{input: `acct["Summary"]()`, expected: "ann: 10"},
+		{input: `acct["Deposit"](5); acct["Balance"]`, expected: int64(15)},
+		{input: `let deposit = acct["Deposit"]; deposit(1); acct["Summary"]()`, expected: "ann: 16"},
+		{input: `summary(acct)`, expected: "ann: 16"},
+		{input: `owner(acct)`, expected: "ann"},
+		{input: `temp["Fahrenheit"]()`, expected: int64(212)},
+		{input: `acct["Deposit"](-1)`, err: "negative amount"},
+		{input: `acct["Deposit"]("1")`, err: "argument 1: cannot use STRING as int"},
+		{input: `acct["history"]`, err: "*monkey.account has no field or method history"},
+		{input: `acct["Missing"]`, err: "*monkey.account has no field or method Missing"},
+		{input: `acct[1]`, err: "index of *monkey.account must be STRING, got INTEGER"},
+		{input: `acct["Rate"]`, err: "Rate of *monkey.account: cannot convert float64 to a Monkey value"},
+		{input: `owner(temp)`, err: "argument 1: cannot use monkey.celsius as *monkey.account"},
+		{input: `owner(1)`, err: "argument 1: cannot use INTEGER as *monkey.account"},
+		{input: `count["Inc"](); count["Inc"](); count["N"]`, expected: int64(2)},
+		{input: `reset(count); count["N"]`, expected: int64(0)},
+		{input: `none["Owner"]`, err: "Owner of nil"},
+		{input: `owner(none)`, err: "argument 1: cannot use nil as *monkey.account"},
+		{input: `nilAcct["Owner"]`, err: "Owner of nil *monkey.account"},
+		{input: `nilAcct["Summary"]()`, err: "panic: value method vm/monkey.account.Summary called using nil *account pointer"},
+	}
+	for _, engine := range engines {
+		acct := &account{
+			audit:   audit{Created: "today"},
+			Owner:   "ann",
+			Balance: 10,
+			Tags:    []string{"a", "b"},
+			Address: &address{City: "Oslo"},
+			Rate:    0.5,
+		}
+		i := New(WithEngine(engine))
+		for name, value := range map[string]any{
+			"acct":    acct,
+			"temp":    Wrap(celsius(100)),
+			"owner":   func(a *account) string { return a.Owner },
+			"summary": func(a account) string { return a.Summary() },
+			"count":   counter{},
+			"reset":   func(c *counter) { c.N = 0 },
+			"none":    Wrap(nil),
+			"nilAcct": Wrap((*account)(nil)),
+		} {
+			if err := i.SetGlobal(name, value); err != nil {
+				t.Fatalf("%s: SetGlobal(%s): %s", engine, name, err)
+			}
+		}
+		for _, tt := range tests {
+			result, err := runString(i, tt.input)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("%s: %s: wrong error. want=%q, got=%v", engine, tt.input, tt.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %s: %s", engine, tt.input, err)
+				continue
+			}
+			if got := value(t, result); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("%s: %s: wrong result. want=%#v, got=%#v", engine, tt.input, tt.expected, got)
+			}
+		}
+		if !reflect.DeepEqual(acct.history, []int{5, 1}) {
+			t.Errorf("%s: methods did not change the account: %v", engine, acct.history)
+		}
+		obj, _ := i.GetGlobal("acct")
+		if got := value(t, obj); got != acct {
+			t.Errorf("%s: FromObject returned %v, not the wrapped pointer", engine, got)
+		}
+		// a Go value returned to Go through a script
+		result, err := i.RunString(`acct["Home"]()`)
+		if err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if got := value(t, result); got != (address{City: "Oslo"}) {
+			t.Errorf("%s: wrong address %v", engine, got)
+		}
+	}
+	for _, tt := range []struct {
+		obj      *GoObject
+		expected string
+	}{
+		{Wrap(nil), "<nil>"},
+		{Wrap((*account)(nil)), "<nil>"},
+		{Wrap(counter{N: 3}), "{3}"},
+	} {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package vm
+
+import (
+	"interpreter/object"
+	"testing"
+
+	"vm/compiler"
+)
+
+var benchmarkPrograms = []struct {
+	name  string
+	input string
+}{
+	{"fibonacci", `
+let fibonacci = fn(x) {
+	if (x == 0) { return 0; }
+	if (x == 1) { return 1; }
+	fibonacci(x - 1) + fibonacci(x - 2)
+};
+fibonacci(20);
+`},
+	{"countdown", `
+let countdown = fn(n) { if (!(n == 0)) { countdown(n - 1) } else { n } };
+countdown(100000);
+`},
+	{"branches", `
+let classify = fn(n) { if (n > 10) { 1 } else { if (n > 5) { 2 } else { 3 } } };
+let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + classify(n - (n / 20) * 20)) } };
+sum(50000, 0);
+`},
+	// the arms of the chain jump to the end of the function, which the
+	// peephole optimizer turns into returns
+	{"dispatch", `
+let pick = fn(n) {
+	if (n == 0) { 10 } else { if (n == 1) { 20 } else { if (n == 2) { 30 } else { if (n == 3) { 40 } else { 50 } } } }
+};
+let run = fn(n, acc) { if (n == 0) { acc } else { run(n - 1, acc + pick(n - (n / 5) * 5)) } };
+run(50000, 0);
+`},
+}
+
+// BenchmarkVM runs each program with and without the peephole optimizer and
+// reports the instructions a run executes next to the time it takes.
+func BenchmarkVM(b *testing.B) {
+	for _, program := range benchmarkPrograms {
+		for _, peephole := range []bool{false, true} {
+			name := program.name
+			opts := []compiler.Option{compiler.WithoutPrelude()}
+			if peephole {
+				name += "/peephole"
+				opts = append(opts, compiler.WithPeephole())
+			}
+			b.Run(name, func(b *testing.B) {
+				comp := compiler.NewCompiler(opts...)
+				if err := comp.Compile(parse(program.input)); err != nil {
+					b.Fatalf("compiler error: %s", err)
+				}
+				bytecode := comp.ByteCode()
+				// the instructions are counted before the timed runs,
+				// which the meter would slow down
+				vm := NewVM(bytecode)
+				vm.SetLimits(object.Limits{})
+				if err := vm.Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := NewVM(bytecode).Run(); err != nil {
+						b.Fatalf("vm error: %s", err)
+					}
+				}
+				b.ReportMetric(float64(vm.meter.Steps()), "instructions/op")
+			})
+		}
+	}
+}
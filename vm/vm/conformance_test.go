@@ -0,0 +1,271 @@
+package vm
+
+import (
+	"flag"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/optimizer"
+	"interpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vm/compiler"
+)
+
+// The conformance tests run programs on the evaluator and on the VM, which
+// must agree on the output of a program and on its result or error and
+// where the error is.
+
+var update = flag.Bool("update", false, "rewrite the expected output of the conformance tests")
+
+// engines are the ways to run a program. Each returns what the program
+// wrote, followed by a line with its result or error.
+var engines = []struct {
+	name string
+	run  func(input string) (string, error)
+}{
+	{"evaluator", runEvaluator},
+	{"vm", func(input string) (string, error) { return runCompiled(input) }},
+	{"vm optimized", func(input string) (string, error) {
+		return runCompiled(input, compiler.WithOptimizer(optimizer.All), compiler.WithPeephole())
+	}},
+}
+
+// parseConformance parses input and expands its macros.
+func parseConformance(input string) (ast.Node, error) {
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parse errors: %s", strings.Join(p.Errors(), "; "))
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	return evaluator.ExpandMacros(program, macroEnv)
+}
+
+// endsWithExpression reports whether the result of program is the value of
+// its last statement, which the VM only keeps for expressions.
+func endsWithExpression(program ast.Node) bool {
+	stmts := program.(*ast.Program).Statements
+	if len(stmts) == 0 {
+		return false
+	}
+	_, ok := stmts[len(stmts)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func formatResult(out *strings.Builder, result object.Object) string {
+	if err, ok := result.(*object.Error); ok {
+		return formatError(out, err.Diagnostic())
+	}
+	return out.String() + "=> " + result.Inspect() + "\n"
+}
+
+func formatError(out *strings.Builder, d *diagnostic.Diagnostic) string {
+	at := ""
+	if d.Primary.IsValid() {
+		at = d.Primary.Start.String() + ": "
+	}
+	return out.String() + "error: " + at + d.Message + "\n"
+}
+
+func runEvaluator(input string) (string, error) {
+	program, err := parseConformance(input)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	env := object.NewEnvironment()
+	env.SetIO(object.NewIO(strings.NewReader(""), &out))
+	result := evaluator.Eval(program, env)
+	if _, ok := result.(*object.Error); !ok && !endsWithExpression(program) {
+		result = object.NULL
+	}
+	return formatResult(&out, result), nil
+}
+
+// runCompiled runs input on the VM. Compile errors are errors of the
+// program, like the errors the evaluator finds while running it.
+func runCompiled(input string, opts ...compiler.Option) (string, error) {
+	program, err := parseConformance(input)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	comp := compiler.NewCompiler(opts...)
+	if err := comp.Compile(program); err != nil {
+		return formatError(&out, diagnostic.FromError(err)[0]), nil
+	}
+	vm := NewVM(comp.ByteCode())
+	vm.SetIO(object.NewIO(strings.NewReader(""), &out))
+	if err := vm.Run(); err != nil {
+		return formatError(&out, diagnostic.FromError(err)[0]), nil
+	}
+	result := vm.LastPoppedStackElem()
+	if !endsWithExpression(program) {
+		result = Null
+	}
+	return formatResult(&out, result), nil
+}
+
+// TestConformance runs each program testdata/NAME.mk on every engine and
+// compares what it prints with testdata/NAME.out. Running the tests with
+// -update rewrites the .out files with the output of the evaluator.
+func TestConformance(t *testing.T) {
+	programs, err := filepath.Glob(filepath.Join("testdata", "*.mk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) == 0 {
+		t.Fatal("no programs in testdata")
+	}
+	for _, path := range programs {
+		name := strings.TrimSuffix(filepath.Base(path), ".mk")
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outPath := strings.TrimSuffix(path, ".mk") + ".out"
+			if *update {
+				got, err := runEvaluator(string(input))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(outPath, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, engine := range engines {
+				got, err := engine.run(string(input))
+				if err != nil {
+					t.Fatalf("%s: %s", engine.name, err)
+				}
+				if got != string(expected) {
+					t.Errorf("%s: wrong output.\nwant:\n%s\ngot:\n%s", engine.name, expected, got)
+				}
+			}
+		})
+	}
+}
+
+// FuzzConformance generates a program from the fuzzed bytes and checks
+// that every engine gives the same output for it.
+func FuzzConformance(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{5, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	f.Add([]byte("!5 < 3 == true"))
+	f.Add([]byte("let x = if (x) { [1, 2][0] } else { {\"a\": x}[\"a\"] }"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		input := (&programGenerator{data: data}).program()
+		var expected string
+		for i, engine := range engines {
+			got, err := engine.run(input)
+			if err != nil {
+				t.Fatalf("%s: %s\n%s", engine.name, err, input)
+			}
+			if i == 0 {
+				expected = got
+			} else if got != expected {
+				t.Errorf("engines disagree on\n%s\n%s:\n%s\n%s:\n%s", input, engines[0].name, expected, engine.name, got)
+			}
+		}
+	})
+}
+
+// programGenerator generates a program, using each byte of data to choose
+// between the ways to continue it. The programs always parse and end, and
+// avoid the differences between the engines that are by design: the VM
+// has no closures, and functions print differently.
+type programGenerator struct {
+	data    []byte
+	globals []string // the globals defined so far
+	names   []string // the names in scope
+}
+
+// choose returns a choice between n, or 0 once data runs out.
+func (g *programGenerator) choose(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+	return int(b) % n
+}
+
+func (g *programGenerator) program() string {
+	var stmts []string
+	for n := g.choose(4); n > 0; n-- {
+		if g.choose(2) == 0 {
+			name := fmt.Sprintf("v%c", 'a'+len(g.globals))
+			stmts = append(stmts, fmt.Sprintf("let %s = %s;", name, g.expression(3)))
+			g.globals = append(g.globals, name)
+			g.names = g.globals
+		} else {
+			stmts = append(stmts, fmt.Sprintf("puts(%s);", g.expression(3)))
+		}
+	}
+	return strings.Join(append(stmts, g.expression(3)), "\n")
+}
+
+func (g *programGenerator) expression(depth int) string {
+	if depth == 0 {
+		return g.literal()
+	}
+	switch g.choose(9) {
+	case 0:
+		return g.literal()
+	case 1:
+		if len(g.names) > 0 {
+			return g.names[g.choose(len(g.names))]
+		}
+		return g.literal()
+	case 2:
+		return fmt.Sprintf("(%s%s)", []string{"!", "-"}[g.choose(2)], g.expression(depth-1))
+	case 3:
+		ops := []string{"+", "-", "*", "/", "<", ">", "==", "!="}
+		return fmt.Sprintf("(%s %s %s)", g.expression(depth-1), ops[g.choose(len(ops))], g.expression(depth-1))
+	case 4:
+		if g.choose(2) == 0 {
+			return fmt.Sprintf("if (%s) { %s }", g.expression(depth-1), g.expression(depth-1))
+		}
+		return fmt.Sprintf("if (%s) { %s } else { %s }", g.expression(depth-1), g.expression(depth-1), g.expression(depth-1))
+	case 5:
+		return fmt.Sprintf("[%s, %s]", g.expression(depth-1), g.expression(depth-1))
+	case 6:
+		return fmt.Sprintf("(%s)[%s]", g.expression(depth-1), g.expression(depth-1))
+	case 7:
+		return fmt.Sprintf("{%s: %s}", g.expression(depth-1), g.expression(depth-1))
+	default:
+		// the body sees the globals and its parameter, but not the
+		// parameters of enclosing functions
+		arg := g.expression(depth - 1)
+		names := g.names
+		g.names = append(g.globals[:len(g.globals):len(g.globals)], "p")
+		body := g.expression(depth - 1)
+		g.names = names
+		return fmt.Sprintf("fn(p) { %s }(%s)", body, arg)
+	}
+}
+
+func (g *programGenerator) literal() string {
+	switch g.choose(4) {
+	case 0:
+		return fmt.Sprint(g.choose(7) - 2)
+	case 1:
+		return []string{"true", "false"}[g.choose(2)]
+	case 2:
+		return []string{`""`, `"a"`, `"bc"`}[g.choose(3)]
+	default:
+		return "puts()"
+	}
+}
@@ -2,6 +2,8 @@ package vm
 
 import (
 	"interpreter/object"
+	"interpreter/token"
+	"sort"
 
 	"vm/code"
 )
@@ -23,3 +25,19 @@ func NewFrame(fn *object.CompiledFunction, basePointer int) *Frame {
 func (f *Frame) Instructions() code.Instructions {
 	return f.fn.Instructions
 }
+
+// position returns where the instruction the frame is at was compiled from,
+// if the compiler recorded it.
+func (f *Frame) position() (token.Position, bool) {
+	positions := f.fn.Positions
+	i := sort.Search(len(positions), func(i int) bool { return positions[i].Offset > f.ip }) - 1
+	if i < 0 || positions[i].Offset >= len(f.fn.Instructions) {
+		return token.Position{}, false
+	}
+	def, err := code.LookUp(f.fn.Instructions[positions[i].Offset])
+	if err != nil || f.ip > positions[i].Offset+def.Width() {
+		// the frame is at a later instruction
+		return token.Position{}, false
+	}
+	return positions[i].Pos, true
+}
@@ -0,0 +1,7 @@
+puts(1 + 2 * 3);
+puts((10 - 4) / 2);
+puts(-7 / 2);
+puts(9223372036854775807 + 1);
+puts(1 < 2, 2 < 1, 3 > 2, 1 == 1, 1 != 1);
+let x = 5;
+x * x - x
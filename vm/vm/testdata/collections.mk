@@ -0,0 +1,10 @@
+let a = [1, 2, 3];
+puts(a[0], a[2], a[3], a[-1]);
+puts(first(a), last(a), rest(a), push(a, 4), a);
+let h = {"one": 1, 2: "two", true: [3]};
+puts(h["one"], h[2], h[true], h["missing"]);
+puts(map(a, fn(x) { x * 2 }));
+puts(reduce(a, 0, fn(acc, x) { acc + x }));
+let [x, y, ...more] = [1, 2, 3, 4];
+puts(x, y, more);
+{"key": [a[1], h[2]]}
@@ -0,0 +1,2 @@
+let f = fn(a, b) { a };
+f(1)
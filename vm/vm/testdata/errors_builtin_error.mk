@@ -0,0 +1,2 @@
+puts("before");
+len(1)
@@ -0,0 +1,3 @@
+puts("before");
+json_parse("x");
+puts(1);
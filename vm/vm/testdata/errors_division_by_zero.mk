@@ -0,0 +1,3 @@
+let zero = 0;
+puts("before");
+10 / zero
@@ -0,0 +1,3 @@
+let f = fn(x) { puts(x); x - "1" };
+f(1);
+puts("after")
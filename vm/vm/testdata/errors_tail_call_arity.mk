@@ -0,0 +1,3 @@
+fn f(a) { a }
+fn g() { f() }
+g()
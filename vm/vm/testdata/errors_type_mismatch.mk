@@ -0,0 +1,2 @@
+puts("before");
+1 + true
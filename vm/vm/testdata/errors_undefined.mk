@@ -0,0 +1 @@
+undefined + 1
@@ -0,0 +1 @@
+true > false
@@ -0,0 +1,17 @@
+let apply = fn(f, x) { f(x) };
+let square = fn(x) { x * x };
+puts(apply(square, 7));
+puts(apply(fn(s) { s + "!" }, "hi"));
+fn fib(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }
+puts(fib(15));
+fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+puts(isEven(10), isOdd(7));
+let early = fn(x) { if (x > 0) { return "positive"; } "not positive" };
+puts(early(1), early(0));
+let next = fn(a, b = match (a) { x => x + 1 }) { [a, b] };
+puts(next(1, 5), next(1));
+fn triangle(n) { fn go(k, acc) { if (k == 0) { acc } else { go(k - 1, acc + k) } } go(n, 0) }
+puts(triangle(100));
+fn loop(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + n) } }
+loop(10000, 0)
@@ -0,0 +1,18 @@
+fn parity(n) {
+	fn isEven(k) { if (k == 0) { true } else { isOdd(k - 1) } }
+	fn isOdd(k) { if (k == 0) { false } else { isEven(k - 1) } }
+	[isEven(n), isOdd(n)]
+}
+puts(parity(10), parity(7));
+fn counter(n) {
+	let step = fn(k) { next(next(k)) };
+	fn next(k) { k + 1 }
+	step(n)
+}
+puts(counter(3));
+fn apply() {
+	fn twice(f, x) { f(f(x)) }
+	fn inc(x) { x + 1 }
+	twice(fn(x) { inc(inc(x)) }, 0)
+}
+apply()
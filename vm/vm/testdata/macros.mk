@@ -0,0 +1,7 @@
+let unless = macro(cond, then, otherwise) {
+  quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+};
+puts(unless(10 > 5, "not greater", "greater"));
+puts(unless(1 > 5, "A", "B"));
+let twice = macro(x) { quote(unquote(x) * 2) };
+twice(1 + 2)
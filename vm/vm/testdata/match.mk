@@ -0,0 +1,12 @@
+let describe = fn(value) {
+  match (value) {
+    0 => "zero",
+    [first, ...others] => "array starting with " + describe(first),
+    {"name": name} => "named " + name,
+    _ => "something else"
+  }
+};
+puts(describe(0));
+puts(describe([0, 1]));
+puts(describe({"name": "monkey"}));
+describe(true)
@@ -0,0 +1,6 @@
+puts(1);
+let f = fn(x) { if (x > 2) { return x * 10 }; x };
+puts(f(1), f(3));
+if (f(5) > 40) { puts("halt"); return [f(2), 7] };
+puts("unreachable");
+9
@@ -0,0 +1,7 @@
+let greet = fn(name) { "hello, " + name };
+puts(greet("world"));
+puts(len(""), len("four"));
+print("a", 1, true);
+println();
+println("b", [1, "c"]);
+greet("") + "!"
@@ -0,0 +1,6 @@
+puts(!true, !false, !5, !!5, !0, !"", !puts());
+puts(if (0) { "zero is truthy" } else { "zero is falsy" });
+puts(if ("") { "empty string is truthy" });
+puts(if (puts()) { "null is truthy" } else { "null is falsy" });
+puts(if ([]) { "empty array is truthy" });
+true == !false
@@ -0,0 +1,259 @@
+package vm
+
+import (
+	"fmt"
+	"interpreter/object"
+
+	"vm/code"
+	"vm/compiler"
+)
+
+// VerifyError describes why Verify rejected bytecode.
+type VerifyError struct {
+	Function string // "main" or "constant N"
+	Offset   int    // offset of the offending instruction
+	Message  string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("invalid bytecode in %s at %04d: %s", e.Function, e.Offset, e.Message)
+}
+
+// Verify checks that the VM can run bytecode without failing on malformed
+// instructions. It checks the main instructions and those of every
+// CompiledFunction constant:
+//
+//   - a function has at least as many locals as parameters, at most as many
+//     defaults as parameters, and an entry for each number of defaults
+//     passed,
+//   - every opcode is defined and has all its operands,
+//   - jumps and default entries go to the start of an instruction or to the
+//     end of the instructions,
+//   - constant, global, local and builtin indexes are in range, and
+//     OpImport refers to a CompiledFunction,
+//   - the main instructions do not return, make tail calls or push the
+//     current function, which need a calling frame, and only they halt,
+//   - no path through a function runs past its last instruction, which
+//     only the main instructions may end at,
+//   - every instruction finds the values it pops on the stack, the stack
+//     has the same depth on every path to an instruction, and its maximum
+//     depth fits the stack.
+//
+// Errors that depend on the values computed, such as calling a non-function,
+// are left to Run.
+func Verify(bytecode *compiler.ByteCode) error {
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	if err := verifyFunction("main", main, bytecode.Constants); err != nil {
+		return err
+	}
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			if err := verifyFunction(fmt.Sprintf("constant %d", i), fn, bytecode.Constants); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// NewVerifiedVM returns a VM running bytecode, or an error if bytecode
+// fails Verify.
+func NewVerifiedVM(bytecode *compiler.ByteCode) (*VM, error) {
+	if err := Verify(bytecode); err != nil {
+		return nil, err
+	}
+	return NewVM(bytecode), nil
+}
+
+// verifiedInstruction is a decoded instruction.
+type verifiedInstruction struct {
+	op       code.Opcode
+	operands []int
+	next     int // offset of the following instruction
+}
+
+func verifyFunction(name string, fn *object.CompiledFunction, constants []object.Object) error {
+	ins := code.Instructions(fn.Instructions)
+	fail := func(offset int, format string, a ...any) error {
+		return &VerifyError{Function: name, Offset: offset, Message: fmt.Sprintf(format, a...)}
+	}
+
+	params := fn.NumParameters
+	if fn.Variadic {
+		params++
+	}
+	switch {
+	case params > fn.NumLocals:
+		return fail(0, "function has %d parameters but %d locals", params, fn.NumLocals)
+	case fn.NumDefaults > fn.NumParameters:
+		return fail(0, "function has %d defaults but %d parameters", fn.NumDefaults, fn.NumParameters)
+	case fn.NumDefaults > 0 && len(fn.DefaultEntries) != fn.NumDefaults+1,
+		fn.NumDefaults == 0 && len(fn.DefaultEntries) != 0:
+		return fail(0, "function has %d defaults but %d entries", fn.NumDefaults, len(fn.DefaultEntries))
+	}
+
+	decoded := map[int]verifiedInstruction{}
+	offsets := []int{}
+	for i := 0; i < len(ins); {
+		def, err := code.LookUp(ins[i])
+		if err != nil {
+			return fail(i, "%s", err)
+		}
+		if i+1+def.Width() > len(ins) {
+			return fail(i, "%s truncated", def.Name)
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		decoded[i] = verifiedInstruction{op: code.Opcode(ins[i]), operands: operands, next: i + 1 + read}
+		offsets = append(offsets, i)
+		i += 1 + read
+	}
+	isBoundary := func(offset int) bool {
+		_, ok := decoded[offset]
+		return ok || offset == len(ins)
+	}
+
+	for _, offset := range offsets {
+		in := decoded[offset]
+		switch in.op {
+		case code.OpReturnValue, code.OpReturn, code.OpTailCall:
+			if name == "main" {
+				def, _ := code.LookUp(byte(in.op))
+				return fail(offset, "%s outside a function", def.Name)
+			}
+		case code.OpCurrentFunction:
+			if name == "main" {
+				return fail(offset, "OpCurrentFunction outside a function")
+			}
+		case code.OpHalt:
+			if name != "main" {
+				return fail(offset, "OpHalt inside a function")
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpIfTrue:
+			if !isBoundary(in.operands[0]) {
+				return fail(offset, "jump to %d is not at an instruction", in.operands[0])
+			}
+		case code.OpConstant, code.OpMatchFail:
+			if in.operands[0] >= len(constants) {
+				return fail(offset, "constant %d out of range", in.operands[0])
+			}
+		case code.OpImport:
+			if in.operands[0] >= len(constants) {
+				return fail(offset, "constant %d out of range", in.operands[0])
+			}
+			if _, ok := constants[in.operands[0]].(*object.CompiledFunction); !ok {
+				return fail(offset, "import of constant %d, which is not a function", in.operands[0])
+			}
+			if in.operands[1] >= GlobalSize {
+				return fail(offset, "global %d out of range", in.operands[1])
+			}
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if in.operands[0] >= GlobalSize {
+				return fail(offset, "global %d out of range", in.operands[0])
+			}
+		case code.OpGetLocal, code.OpSetLocal:
+			if in.operands[0] >= fn.NumLocals {
+				return fail(offset, "local %d out of range", in.operands[0])
+			}
+		case code.OpGetBuiltin:
+			if in.operands[0] >= len(object.Builtins) {
+				return fail(offset, "builtin %d out of range", in.operands[0])
+			}
+		case code.OpHash:
+			if in.operands[0]%2 != 0 {
+				return fail(offset, "odd number of hash elements %d", in.operands[0])
+			}
+		}
+	}
+
+	starts := []int{0}
+	for _, entry := range fn.DefaultEntries {
+		if !isBoundary(entry) {
+			return fail(0, "default entry %d is not at an instruction", entry)
+		}
+		starts = append(starts, entry)
+	}
+	return verifyStack(fn, name == "main", decoded, starts, fail)
+}
+
+// stackEffect returns how many values an instruction pops and pushes.
+func stackEffect(in verifiedInstruction) (pops, pushes int) {
+	switch in.op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpImport, code.OpCurrentFunction:
+		return 0, 1
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual,
+		code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpIndex, code.OpMatchValue,
+		code.OpHasKey, code.OpHasIndex:
+		return 2, 1
+	case code.OpMinus, code.OpBang, code.OpMatchArray, code.OpMatchHash, code.OpSliceFrom:
+		return 1, 1
+	case code.OpPop, code.OpJumpNotTruthy, code.OpJumpIfTrue, code.OpSetGlobal,
+		code.OpSetLocal, code.OpReturnValue, code.OpMatchFail, code.OpHalt:
+		return 1, 0
+	case code.OpArray, code.OpHash:
+		return in.operands[0], 1
+	case code.OpCall, code.OpTailCall:
+		// the callee and its arguments
+		return in.operands[0] + 1, 1
+	}
+	// OpJump, OpReturn
+	return 0, 0
+}
+
+// successors returns the offsets execution can continue at after in.
+func successors(in verifiedInstruction) []int {
+	switch in.op {
+	case code.OpJump:
+		return []int{in.operands[0]}
+	case code.OpJumpNotTruthy, code.OpJumpIfTrue:
+		return []int{in.next, in.operands[0]}
+	case code.OpReturnValue, code.OpReturn, code.OpMatchFail, code.OpHalt:
+		return nil
+	}
+	return []int{in.next}
+}
+
+// verifyStack follows every path from starts through the instructions of fn
+// and checks the depth of its operand stack. Paths may reach the end of the
+// instructions only if fn is main.
+func verifyStack(fn *object.CompiledFunction, main bool, decoded map[int]verifiedInstruction, starts []int,
+	fail func(int, string, ...any) error) error {
+	depths := map[int]int{}
+	work := []int{}
+	for _, start := range starts {
+		depths[start] = 0
+		work = append(work, start)
+	}
+	maxDepth := 0
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+		in, ok := decoded[offset]
+		if !ok {
+			// the end of the instructions
+			if !main {
+				return fail(offset, "falls off the end of the function")
+			}
+			continue
+		}
+		depth := depths[offset]
+		pops, pushes := stackEffect(in)
+		if depth < pops {
+			return fail(offset, "pops %d values from a stack of %d", pops, depth)
+		}
+		depth += pushes - pops
+		maxDepth = max(maxDepth, depth)
+		if fn.NumLocals+maxDepth > StackSize {
+			return fail(offset, "stack depth %d exceeds the stack size", fn.NumLocals+maxDepth)
+		}
+		for _, next := range successors(in) {
+			if seen, ok := depths[next]; !ok {
+				depths[next] = depth
+				work = append(work, next)
+			} else if seen != depth {
+				return fail(next, "stack depth %d on one path and %d on another", seen, depth)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package vm
+
+import (
+	"interpreter/object"
+	"strings"
+	"testing"
+
+	"vm/code"
+	"vm/compiler"
+)
+
+func instructions(ins ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, in := range ins {
+		out = append(out, in...)
+	}
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	fn := func(numLocals int, ins ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: instructions(ins...), NumLocals: numLocals}
+	}
+	integer := &object.Integer{Value: 1}
+	tests := []struct {
+		name      string
+		main      code.Instructions
+		constants []object.Object
+		expected  string // empty if the bytecode is valid
+	}{
+		{
+			name:      "valid",
+			main:      instructions(code.Make(code.OpConstant, 0), code.Make(code.OpPop)),
+			constants: []object.Object{integer},
+		},
+		{
+			name:     "undefined opcode",
+			main:     code.Instructions{255},
+			expected: "main at 0000: opcode 255 undefined",
+		},
+		{
+			name:     "truncated operand",
+			main:     code.Instructions{byte(code.OpTrue), byte(code.OpConstant), 0},
+			expected: "main at 0001: OpConstant truncated",
+		},
+		{
+			name:     "jump into an instruction",
+			main:     instructions(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5), code.Make(code.OpGetGlobal, 0)),
+			expected: "main at 0001: jump to 5 is not at an instruction",
+		},
+		{
+			name:     "jump past the end",
+			main:     instructions(code.Make(code.OpJump, 4)),
+			expected: "main at 0000: jump to 4 is not at an instruction",
+		},
+		{
+			name:     "jump to the end",
+			main:     instructions(code.Make(code.OpJump, 3)),
+			expected: "",
+		},
+		{
+			name:      "constant out of range",
+			main:      instructions(code.Make(code.OpConstant, 1)),
+			constants: []object.Object{integer},
+			expected:  "main at 0000: constant 1 out of range",
+		},
+		{
+			name:      "import of a non-function",
+			main:      instructions(code.Make(code.OpImport, 0, 0)),
+			constants: []object.Object{integer},
+			expected:  "main at 0000: import of constant 0, which is not a function",
+		},
+		{
+			name:     "local in main",
+			main:     instructions(code.Make(code.OpGetLocal, 0)),
+			expected: "main at 0000: local 0 out of range",
+		},
+		{
+			name:     "builtin out of range",
+			main:     instructions(code.Make(code.OpGetBuiltin, 200)),
+			expected: "main at 0000: builtin 200 out of range",
+		},
+		{
+			name:     "odd hash",
+			main:     instructions(code.Make(code.OpNull), code.Make(code.OpHash, 1)),
+			expected: "main at 0001: odd number of hash elements 1",
+		},
+		{
+			name:     "stack underflow",
+			main:     instructions(code.Make(code.OpTrue), code.Make(code.OpAdd)),
+			expected: "main at 0001: pops 2 values from a stack of 1",
+		},
+		{
+			name:     "call without callee",
+			main:     instructions(code.Make(code.OpTrue), code.Make(code.OpCall, 1)),
+			expected: "main at 0001: pops 2 values from a stack of 1",
+		},
+		{
+			name: "unbalanced branches",
+			main: instructions(
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 6),
+				code.Make(code.OpTrue),
+				code.Make(code.OpTrue),
+				code.Make(code.OpNull),
+			),
+			expected: "main at 0006: stack depth 0 on one path and 2 on another",
+		},
+		{
+			name: "stack overflow",
+			main: func() code.Instructions {
+				ins := code.Instructions{}
+				for i := 0; i <= StackSize; i++ {
+					ins = append(ins, byte(code.OpTrue))
+				}
+				return ins
+			}(),
+			expected: "main at 2048: stack depth 2049 exceeds the stack size",
+		},
+		{
+			name: "bad function",
+			main: instructions(code.Make(code.OpConstant, 1)),
+			constants: []object.Object{
+				integer,
+				fn(1, code.Make(code.OpGetLocal, 0), code.Make(code.OpSetLocal, 1)),
+			},
+			expected: "constant 1 at 0002: local 1 out of range",
+		},
+		{
+			name: "return without value",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				fn(0, code.Make(code.OpReturnValue)),
+			},
+			expected: "constant 0 at 0000: pops 1 values from a stack of 0",
+		},
+		{
+			name:     "return in main",
+			main:     instructions(code.Make(code.OpReturn)),
+			expected: "main at 0000: OpReturn outside a function",
+		},
+		{
+			name:     "return value in main",
+			main:     instructions(code.Make(code.OpTrue), code.Make(code.OpReturnValue)),
+			expected: "main at 0001: OpReturnValue outside a function",
+		},
+		{
+			name:      "tail call in main",
+			main:      instructions(code.Make(code.OpConstant, 0), code.Make(code.OpTailCall, 0)),
+			constants: []object.Object{integer},
+			expected:  "main at 0003: OpTailCall outside a function",
+		},
+		{
+			name: "halt in main",
+			main: instructions(code.Make(code.OpTrue), code.Make(code.OpHalt), code.Make(code.OpNull)),
+		},
+		{
+			name: "halt in a function",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				fn(0, code.Make(code.OpTrue), code.Make(code.OpHalt)),
+			},
+			expected: "constant 0 at 0001: OpHalt inside a function",
+		},
+		{
+			name:     "current function in main",
+			main:     instructions(code.Make(code.OpCurrentFunction), code.Make(code.OpPop)),
+			expected: "main at 0000: OpCurrentFunction outside a function",
+		},
+		{
+			name: "bad default entry",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				&object.CompiledFunction{
+					Instructions:   instructions(code.Make(code.OpConstant, 0), code.Make(code.OpReturn)),
+					NumDefaults:    1,
+					NumParameters:  1,
+					NumLocals:      1,
+					DefaultEntries: []int{0, 2},
+				},
+			},
+			expected: "constant 0 at 0000: default entry 2 is not at an instruction",
+		},
+		{
+			name: "too few locals",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				&object.CompiledFunction{
+					Instructions:  instructions(code.Make(code.OpReturn)),
+					NumParameters: 1,
+					Variadic:      true,
+					NumLocals:     1,
+				},
+			},
+			expected: "constant 0 at 0000: function has 2 parameters but 1 locals",
+		},
+		{
+			name: "too many defaults",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				&object.CompiledFunction{
+					Instructions:   instructions(code.Make(code.OpReturn)),
+					NumDefaults:    2,
+					NumParameters:  1,
+					NumLocals:      1,
+					DefaultEntries: []int{0, 0, 0},
+				},
+			},
+			expected: "constant 0 at 0000: function has 2 defaults but 1 parameters",
+		},
+		{
+			name: "missing default entry",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				&object.CompiledFunction{
+					Instructions:   instructions(code.Make(code.OpReturn)),
+					NumDefaults:    1,
+					NumParameters:  1,
+					NumLocals:      1,
+					DefaultEntries: []int{0},
+				},
+			},
+			expected: "constant 0 at 0000: function has 1 defaults but 1 entries",
+		},
+		{
+			name: "entries without defaults",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				&object.CompiledFunction{
+					Instructions:   instructions(code.Make(code.OpReturn)),
+					DefaultEntries: []int{0},
+				},
+			},
+			expected: "constant 0 at 0000: function has 0 defaults but 1 entries",
+		},
+		{
+			name: "function falls off the end",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				fn(0, code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 5), code.Make(code.OpReturn)),
+			},
+			expected: "constant 0 at 0005: falls off the end of the function",
+		},
+		{
+			name: "default entry at the end",
+			main: instructions(code.Make(code.OpConstant, 0)),
+			constants: []object.Object{
+				&object.CompiledFunction{
+					Instructions:   instructions(code.Make(code.OpReturn)),
+					NumDefaults:    1,
+					NumParameters:  1,
+					NumLocals:      1,
+					DefaultEntries: []int{0, 1},
+				},
+			},
+			expected: "constant 0 at 0001: falls off the end of the function",
+		},
+	}
+	for _, tt := range tests {
+		bytecode := &compiler.ByteCode{Instructions: tt.main, Constants: tt.constants}
+		_, err := NewVerifiedVM(bytecode)
+		switch {
+		case tt.expected == "" && err != nil:
+			t.Errorf("%s: valid bytecode rejected: %s", tt.name, err)
+		case tt.expected != "" && err == nil:
+			t.Errorf("%s: invalid bytecode accepted", tt.name)
+		case tt.expected != "" && !strings.HasSuffix(err.Error(), tt.expected):
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.name, tt.expected, err)
+		}
+	}
+}
+
+// TestRunVerified runs bytecode that passes Verify but fails at run time,
+// which must return an error instead of panicking.
+func TestRunVerified(t *testing.T) {
+	tests := []struct {
+		name      string
+		main      code.Instructions
+		constants []object.Object
+		expected  string
+	}{
+		{
+			name:     "unset global",
+			main:     instructions(code.Make(code.OpGetGlobal, 5), code.Make(code.OpMinus), code.Make(code.OpPop)),
+			expected: "global 5 is not set",
+		},
+		{
+			name: "unset local",
+			main: instructions(code.Make(code.OpConstant, 0), code.Make(code.OpCall, 0), code.Make(code.OpPop)),
+			constants: []object.Object{
+				&object.CompiledFunction{
+					Instructions: instructions(code.Make(code.OpGetLocal, 0), code.Make(code.OpReturnValue)),
+					NumLocals:    1,
+				},
+			},
+			expected: "local 0 is not set",
+		},
+		{
+			name: "call of a non-function",
+			main: instructions(code.Make(code.OpConstant, 0), code.Make(code.OpCall, 0), code.Make(code.OpPop)),
+			constants: []object.Object{
+				&object.Integer{Value: 1},
+			},
+			expected: "not a function: INTEGER",
+		},
+	}
+	for _, tt := range tests {
+		vm, err := NewVerifiedVM(&compiler.ByteCode{Instructions: tt.main, Constants: tt.constants})
+		if err != nil {
+			t.Fatalf("%s: bytecode rejected: %s", tt.name, err)
+		}
+		if err := vm.Run(); err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"fmt"
+	"interpreter/diagnostic"
 	"interpreter/object"
 
 	"vm/code"
@@ -12,9 +13,11 @@ const StackSize = 2048
 const MaxFrames = 1024
 const GlobalSize = 65536
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+// The VM uses the singletons of package object, as the evaluator does, so
+// values can be passed between the engines.
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 type VM struct {
 	constants  []object.Object
@@ -23,11 +26,24 @@ type VM struct {
 	frames     []*Frame
 	frameIndex int
 	sp         int
+	meter      *object.Meter // nil if execution is not limited
+	io         *object.IO    // nil for object.DefaultIO
 }
 
 func NewVM(bytecode *compiler.ByteCode) *VM {
+	return NewVMWithGlobals(bytecode, make([]object.Object, GlobalSize))
+}
 
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+// NewVMWithGlobals returns a VM running bytecode with globals. Passing the
+// globals of a VM that ran an earlier program lets bytecode compiled with
+// compiler.WithState use its globals. globals shorter than GlobalSize are
+// extended to GlobalSize, which may copy them; Globals returns the globals
+// the VM uses.
+func NewVMWithGlobals(bytecode *compiler.ByteCode, globals []object.Object) *VM {
+	if len(globals) < GlobalSize {
+		globals = append(globals, make([]object.Object, GlobalSize-len(globals))...)
+	}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions, File: bytecode.File}
 	mainFrame := NewFrame(mainFn, 0)
 
 	frames := make([]*Frame, MaxFrames)
@@ -36,12 +52,23 @@ func NewVM(bytecode *compiler.ByteCode) *VM {
 		constants:  bytecode.Constants,
 		stack:      make([]object.Object, StackSize),
 		sp:         0,
-		globals:    make([]object.Object, GlobalSize),
+		globals:    globals,
 		frames:     frames,
 		frameIndex: 1,
 	}
 }
 
+// SetLimits makes Run stop with an error when the program exceeds limits.
+// Steps are instructions executed.
+func (v *VM) SetLimits(limits object.Limits) {
+	v.meter = object.NewMeter(limits)
+}
+
+// SetIO sets the input and output of the builtins the program calls.
+func (v *VM) SetIO(io *object.IO) {
+	v.io = io
+}
+
 func (v *VM) currentFrame() *Frame {
 	return v.frames[v.frameIndex-1]
 }
@@ -67,11 +94,82 @@ func (v *VM) StackTop() object.Object {
 }
 
 func (v *VM) Run() error {
+	if err := v.run(1); err != nil {
+		return v.runtimeError(err)
+	}
+	return nil
+}
+
+// maxNoteFrames is the number of functions runtimeError lists at most.
+const maxNoteFrames = 10
+
+// runtimeError returns err, which stopped the program, as a diagnostic
+// pointing at the instruction that failed, with the functions being run,
+// innermost first, and where they were called as notes.
+func (v *VM) runtimeError(err error) error {
+	d := &diagnostic.Diagnostic{Severity: diagnostic.Error, Code: diagnostic.Runtime, Message: err.Error(), Err: err}
+	current := v.currentFrame()
+	if pos, ok := current.position(); ok {
+		d.Primary, d.File = diagnostic.At(pos), current.fn.File
+	}
+	for i := v.frameIndex - 1; i > 0; i-- {
+		if len(d.Notes) == maxNoteFrames {
+			d.Notes = append(d.Notes, fmt.Sprintf("and %d more calls", i))
+			break
+		}
+		name := v.frames[i].fn.Name
+		if name == "" {
+			name = "an anonymous function"
+		}
+		note := "in " + name
+		if pos, ok := v.frames[i-1].position(); ok {
+			note += ", called at " + pos.String()
+		}
+		d.Notes = append(d.Notes, note)
+	}
+	return d
+}
+
+// Globals returns the globals of v.
+func (v *VM) Globals() []object.Object {
+	return v.globals
+}
+
+// Call calls fn, a compiled function or builtin, with args and returns its
+// result. It must not be called while Run is running; after Run returned,
+// fn can be a function the program stored in a global.
+func (v *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	frameIndex, sp := v.frameIndex, v.sp
+	defer func() {
+		v.frameIndex, v.sp = frameIndex, sp
+	}()
+	for _, obj := range append([]object.Object{fn}, args...) {
+		if err := v.push(obj); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.callFunction(len(args)); err != nil {
+		return nil, v.runtimeError(err)
+	}
+	if v.frameIndex > frameIndex {
+		if err := v.run(frameIndex + 1); err != nil {
+			return nil, v.runtimeError(err)
+		}
+	}
+	return v.stack[v.sp-1], nil
+}
+
+// run executes instructions until the current frame ends or fewer than
+// minFrames frames are left.
+func (v *VM) run(minFrames int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for v.currentFrame().ip < len(v.currentFrame().Instructions())-1 {
+	for v.frameIndex >= minFrames && v.currentFrame().ip < len(v.currentFrame().Instructions())-1 {
+		if err := v.meter.Step(); err != nil {
+			return err
+		}
 		v.currentFrame().ip++
 		ip = v.currentFrame().ip
 		ins = v.currentFrame().Instructions()
@@ -84,7 +182,7 @@ func (v *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpDiv, code.OpAdd, code.OpMul, code.OpSub, code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpDiv, code.OpAdd, code.OpMul, code.OpSub, code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
 			err := v.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -128,6 +226,16 @@ func (v *VM) Run() error {
 			if !isTruthy(condition) {
 				v.currentFrame().ip = pos - 1
 			}
+		case code.OpJumpIfTrue:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			v.currentFrame().ip += 2
+			condition, err := v.pop()
+			if err != nil {
+				return err
+			}
+			if isTruthy(condition) {
+				v.currentFrame().ip = pos - 1
+			}
 		case code.OpNull:
 			err := v.push(Null)
 			if err != nil {
@@ -145,6 +253,9 @@ func (v *VM) Run() error {
 			idx := code.ReadUint16(ins[ip+1:])
 			v.currentFrame().ip += 2
 			val := v.globals[idx]
+			if val == nil {
+				return fmt.Errorf("global %d is not set", idx)
+			}
 			err := v.push(val)
 			if err != nil {
 				return err
@@ -161,7 +272,7 @@ func (v *VM) Run() error {
 				arr.Elements[num-1] = elm
 				num -= 1
 			}
-			err := v.push(arr)
+			err := v.pushNew(arr)
 			if err != nil {
 				return err
 			}
@@ -190,13 +301,26 @@ func (v *VM) Run() error {
 			if err != nil {
 				return err
 			}
+			v.meter.Leave()
 			frame := v.popFrame()
 			v.sp = frame.basePointer - 1
 			err = v.push(returnValue)
 			if err != nil {
 				return err
 			}
+		case code.OpCurrentFunction:
+			if err := v.push(v.currentFrame().fn); err != nil {
+				return err
+			}
+		case code.OpHalt:
+			// the popped value stays above the stack as the result
+			if _, err := v.pop(); err != nil {
+				return err
+			}
+			v.currentFrame().ip = len(ins) - 1
+			return nil
 		case code.OpReturn:
+			v.meter.Leave()
 			frame := v.popFrame()
 			// 弹出CompiledFunction object
 			v.sp = frame.basePointer - 1
@@ -206,6 +330,33 @@ func (v *VM) Run() error {
 				return err
 			}
 
+		case code.OpImport:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			slot := code.ReadUint16(ins[ip+3:])
+			v.currentFrame().ip += 4
+			if exports := v.globals[slot]; exports != nil {
+				err := v.push(exports)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			// the module function stores its exports in the slot and returns them
+			err := v.push(v.constants[constIndex])
+			if err != nil {
+				return err
+			}
+			err = v.callFunction(0)
+			if err != nil {
+				return err
+			}
+		case code.OpGetBuiltin:
+			builtinIndex := ins[ip+1]
+			v.currentFrame().ip += 1
+			err := v.push(object.Builtins[builtinIndex].Builtin)
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := ins[ip+1]
 			v.currentFrame().ip += 1
@@ -213,6 +364,105 @@ func (v *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpTailCall:
+			numArgs := ins[ip+1]
+			v.currentFrame().ip += 1
+			err := v.tailCallFunction(int(numArgs))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchValue:
+			pattern, err := v.pop()
+			if err != nil {
+				return err
+			}
+			value, err := v.pop()
+			if err != nil {
+				return err
+			}
+			err = v.push(nativeBoolToBooleanObject(object.SameValue(pattern, value)))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			min := int(code.ReadUint16(ins[ip+1:]))
+			max := int(code.ReadUint16(ins[ip+3:]))
+			v.currentFrame().ip += 4
+			value, err := v.pop()
+			if err != nil {
+				return err
+			}
+			arr, ok := value.(*object.ArrayObject)
+			matched := ok && len(arr.Elements) >= min &&
+				(max == code.MatchArrayUnbounded || len(arr.Elements) <= max)
+			err = v.push(nativeBoolToBooleanObject(matched))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchHash:
+			value, err := v.pop()
+			if err != nil {
+				return err
+			}
+			_, ok := value.(*object.HashObject)
+			err = v.push(nativeBoolToBooleanObject(ok))
+			if err != nil {
+				return err
+			}
+		case code.OpHasKey:
+			key, err := v.pop()
+			if err != nil {
+				return err
+			}
+			value, err := v.pop()
+			if err != nil {
+				return err
+			}
+			err = v.push(nativeBoolToBooleanObject(hasKey(value, key)))
+			if err != nil {
+				return err
+			}
+		case code.OpHasIndex:
+			idx, err := v.pop()
+			if err != nil {
+				return err
+			}
+			value, err := v.pop()
+			if err != nil {
+				return err
+			}
+			err = v.push(nativeBoolToBooleanObject(hasIndex(value, idx)))
+			if err != nil {
+				return err
+			}
+		case code.OpSliceFrom:
+			start := int(code.ReadUint16(ins[ip+1:]))
+			v.currentFrame().ip += 2
+			value, err := v.pop()
+			if err != nil {
+				return err
+			}
+			arr, ok := value.(*object.ArrayObject)
+			if !ok {
+				return fmt.Errorf("can't slice %s", value.Type())
+			}
+			rest := []object.Object{}
+			if len(arr.Elements) > start {
+				rest = append(rest, arr.Elements[start:]...)
+			}
+			err = v.pushNew(&object.ArrayObject{Elements: rest})
+			if err != nil {
+				return err
+			}
+		case code.OpMatchFail:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			v.currentFrame().ip += 2
+			value, err := v.pop()
+			if err != nil {
+				return err
+			}
+			pattern := v.constants[constIndex].Inspect()
+			return fmt.Errorf("pattern %s does not match %s", pattern, value.Inspect())
 		case code.OpSetLocal:
 			localIndex := ins[ip+1]
 			v.currentFrame().ip += 1
@@ -222,7 +472,11 @@ func (v *VM) Run() error {
 			localIndex := ins[ip+1]
 			v.currentFrame().ip += 1
 			frame := v.currentFrame()
-			err := v.push(v.stack[frame.basePointer+int(localIndex)])
+			val := v.stack[frame.basePointer+int(localIndex)]
+			if val == nil {
+				return fmt.Errorf("local %d is not set", localIndex)
+			}
+			err := v.push(val)
 			if err != nil {
 				return err
 			}
@@ -231,16 +485,120 @@ func (v *VM) Run() error {
 	return nil
 }
 func (v *VM) callFunction(numArgs int) error {
-	fn, ok := v.stack[v.sp-1-int(numArgs)].(*object.CompiledFunction)
-	if !ok {
-		return fmt.Errorf("calling non-funcion")
+	switch callee := v.stack[v.sp-1-numArgs].(type) {
+	case *object.CompiledFunction:
+		return v.callCompiledFunction(callee, numArgs)
+	case *object.Builtin:
+		return v.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
 	}
-	if numArgs != fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments, want %d, got %d", fn.NumParameters, numArgs)
+}
+
+func (v *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := v.stack[v.sp-numArgs : v.sp]
+	result := builtin.Call(v.io, args...)
+	v.sp = v.sp - numArgs - 1
+	if err, ok := result.(*object.Error); ok {
+		return builtinError{obj: err}
+	}
+	if result == nil {
+		return v.push(Null)
+	}
+	return v.pushNew(result)
+}
+
+// builtinError is an error a builtin returned, which stops the program as
+// it stops the evaluator.
+type builtinError struct {
+	obj *object.Error
+}
+
+func (e builtinError) Error() string {
+	return e.obj.Message
+}
+
+func (e builtinError) Unwrap() error {
+	return e.obj.Err
+}
+
+// callCompiledFunction pushes a frame for fn.
+func (v *VM) callCompiledFunction(fn *object.CompiledFunction, numArgs int) error {
+	if v.frameIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	if err := v.meter.Enter(); err != nil {
+		return err
 	}
 	frame := NewFrame(fn, v.sp-numArgs)
+	if err := v.enterFunction(frame, numArgs); err != nil {
+		return err
+	}
 	v.pushFrame(frame)
-	v.sp = frame.basePointer + fn.NumLocals
+	return nil
+}
+
+// tailCallFunction calls the callee below the numArgs arguments on the
+// stack in place of the current frame. The callee and its arguments are
+// moved down over those of the current function, so the stack does not grow.
+func (v *VM) tailCallFunction(numArgs int) error {
+	fn, ok := v.stack[v.sp-1-numArgs].(*object.CompiledFunction)
+	if !ok {
+		return v.callFunction(numArgs)
+	}
+	// the frame of the caller is kept for the error of a wrong call
+	if err := checkArity(fn, numArgs); err != nil {
+		return err
+	}
+	frame := v.currentFrame()
+	copy(v.stack[frame.basePointer-1:], v.stack[v.sp-1-numArgs:v.sp])
+	v.sp = frame.basePointer + numArgs
+	frame.fn, frame.ip = fn, -1
+	return v.enterFunction(frame, numArgs)
+}
+
+// enterFunction prepares frame to run its function with the numArgs
+// arguments at its base pointer. The arguments after the named parameters
+// of a variadic function are packed into an array in the slot after them,
+// and missing parameters with defaults are computed by starting at the
+// matching entry of DefaultEntries.
+func (v *VM) enterFunction(frame *Frame, numArgs int) error {
+	fn := frame.fn
+	if err := checkArity(fn, numArgs); err != nil {
+		return err
+	}
+	required := fn.NumParameters - fn.NumDefaults
+	basePointer := frame.basePointer
+	if basePointer+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	if fn.Variadic {
+		rest := []object.Object{}
+		if numArgs > fn.NumParameters {
+			rest = append(rest, v.stack[basePointer+fn.NumParameters:v.sp]...)
+		}
+		restArray := &object.ArrayObject{Elements: rest}
+		if err := v.meter.Allocate(restArray); err != nil {
+			return err
+		}
+		v.stack[basePointer+fn.NumParameters] = restArray
+	}
+	if fn.NumDefaults > 0 {
+		frame.ip = fn.DefaultEntries[min(numArgs, fn.NumParameters)-required] - 1
+	}
+	v.sp = basePointer + fn.NumLocals
+	return nil
+}
+
+// checkArity returns an error unless fn takes numArgs arguments.
+func checkArity(fn *object.CompiledFunction, numArgs int) error {
+	required, max := fn.NumParameters-fn.NumDefaults, fn.NumParameters
+	if fn.Variadic {
+		max = -1
+	}
+	if numArgs < required || (max >= 0 && numArgs > max) {
+		return fmt.Errorf("%s", object.ArityMismatch(numArgs, required, max))
+	}
 	return nil
 }
 
@@ -250,11 +608,22 @@ func (v *VM) executeIndexExpression(left, idx object.Object) error {
 		return v.executeArrayIndex(left, idx)
 	case left.Type() == object.HASH_OBJ:
 		return v.executeHashIndex(left, idx)
+	case isIndexable(left):
+		result := left.(object.Indexable).Index(idx)
+		if err, ok := result.(*object.Error); ok {
+			return fmt.Errorf("%s", err.Message)
+		}
+		return v.push(result)
 	default:
 		return fmt.Errorf("index operator not supported: %s", left.Type())
 	}
 }
 
+func isIndexable(obj object.Object) bool {
+	_, ok := obj.(object.Indexable)
+	return ok
+}
+
 func (v *VM) executeArrayIndex(left, idx object.Object) error {
 	arr := left.(*object.ArrayObject)
 	i := idx.(*object.Integer).Value
@@ -279,25 +648,54 @@ func (v *VM) executeHashIndex(left, idx object.Object) error {
 }
 
 func (v *VM) buildHashPairs(num int) error {
+	if v.sp < num {
+		return fmt.Errorf("nothing in stack")
+	}
 	hash := &object.HashObject{Pairs: make(map[object.HashKey]object.HashPair)}
-	for num > 0 {
-		value, err := v.pop()
-		if err != nil {
-			return err
-		}
-		key, err := v.pop()
-		if err != nil {
-			return err
-		}
-		switch hashable := key.(type) {
-		case object.Hashable:
-			hash.Pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
-		default:
-			return fmt.Errorf("type %s can't support hashable", hashable.Type())
+	// the keys are hashed in the order they were pushed, like the
+	// evaluator does
+	elements := v.stack[v.sp-num : v.sp]
+	for i := 0; i < num; i += 2 {
+		key, value := elements[i], elements[i+1]
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
-		num -= 2
+		hash.Pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	v.sp -= num
+	return v.pushNew(hash)
+}
+
+func nativeBoolToBooleanObject(b bool) *object.Boolean {
+	if b {
+		return True
+	}
+	return False
+}
+
+// hasKey reports whether value is a hash with key.
+func hasKey(value, key object.Object) bool {
+	hash, ok := value.(*object.HashObject)
+	if !ok {
+		return false
+	}
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return false
+	}
+	_, ok = hash.Pairs[hashable.HashKey()]
+	return ok
+}
+
+// hasIndex reports whether value is an array and idx an index within it.
+func hasIndex(value, idx object.Object) bool {
+	arr, ok := value.(*object.ArrayObject)
+	if !ok {
+		return false
 	}
-	return v.push(hash)
+	i, ok := idx.(*object.Integer)
+	return ok && i.Value >= 0 && i.Value < int64(len(arr.Elements))
 }
 
 func isTruthy(obj object.Object) bool {
@@ -316,9 +714,9 @@ func (v *VM) executeMinusOperator() error {
 		return err
 	}
 	if result, ok := operand.(*object.Integer); ok {
-		return v.push(&object.Integer{Value: -result.Value})
+		return v.pushNew(&object.Integer{Value: -result.Value})
 	}
-	return fmt.Errorf("unsupported type:%s for negation operator", operand.Type())
+	return fmt.Errorf("unknown operator: -%s", operand.Type())
 }
 
 func (v *VM) executeBangOpeartor() error {
@@ -334,10 +732,29 @@ func (v *VM) executeBangOpeartor() error {
 	case Null:
 		return v.push(True)
 	default:
-		return v.push(True)
+		return v.push(False)
 	}
+}
 
+// operators are the operators compiled to the binary operation opcodes, as
+// written in the source.
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
 }
+
+// unknownOperator returns the error of op applied to operands of types it
+// does not support.
+func unknownOperator(op code.Opcode, left, right object.Object) error {
+	return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+}
+
 func (v *VM) executeBinaryOperation(op code.Opcode) error {
 	right, err := v.pop()
 	if err != nil {
@@ -358,29 +775,30 @@ func (v *VM) executeBinaryOperation(op code.Opcode) error {
 	if leftType == object.STRING_OBJ && rightType == object.STRING_OBJ {
 		return v.executeStringOperation(op, left, right)
 	}
-	return fmt.Errorf("type misstach,%s %s %s", string(leftType), string(op), string(rightType))
+	if leftType != rightType {
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	}
+	return unknownOperator(op, left, right)
 }
 func (v *VM) executeStringOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return unknownOperator(op, left, right)
+	}
 	leftValue := left.(*object.StringObject).Value
 	rightValue := right.(*object.StringObject).Value
-	switch op {
-	case code.OpAdd:
-		return v.push(&object.StringObject{Value: leftValue + rightValue})
-
-	}
-	return nil
+	return v.pushNew(&object.StringObject{Value: leftValue + rightValue})
 }
 
 func (v *VM) executeBooleanOperation(op code.Opcode, left, right object.Object) error {
 	leftValue := left.(*object.Boolean).Value
 	rightValue := right.(*object.Boolean).Value
-	if op == code.OpEqual {
-		v.push(&object.Boolean{Value: leftValue == rightValue})
-
-	} else {
-		v.push(&object.Boolean{Value: leftValue != rightValue})
+	switch op {
+	case code.OpEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return v.push(nativeBoolToBooleanObject(leftValue != rightValue))
 	}
-	return nil
+	return unknownOperator(op, left, right)
 }
 
 func (v *VM) executeIntegerOperation(op code.Opcode, left, right object.Object) error {
@@ -389,16 +807,16 @@ func (v *VM) executeIntegerOperation(op code.Opcode, left, right object.Object)
 	var err error
 	switch op {
 	case code.OpAdd:
-		err = v.push(&object.Integer{Value: leftValue + rightValue})
+		err = v.pushNew(&object.Integer{Value: leftValue + rightValue})
 	case code.OpSub:
-		err = v.push(&object.Integer{Value: leftValue - rightValue})
+		err = v.pushNew(&object.Integer{Value: leftValue - rightValue})
 	case code.OpMul:
-		err = v.push(&object.Integer{Value: leftValue * rightValue})
+		err = v.pushNew(&object.Integer{Value: leftValue * rightValue})
 	case code.OpDiv:
 		if rightValue == 0 {
-			return fmt.Errorf("can't div zero")
+			return fmt.Errorf("division by zero")
 		}
-		err = v.push(&object.Integer{Value: leftValue / rightValue})
+		err = v.pushNew(&object.Integer{Value: leftValue / rightValue})
 	case code.OpEqual:
 		if leftValue == rightValue {
 			err = v.push(True)
@@ -411,6 +829,12 @@ func (v *VM) executeIntegerOperation(op code.Opcode, left, right object.Object)
 		} else {
 			err = v.push(False)
 		}
+	case code.OpLessThan:
+		if leftValue < rightValue {
+			err = v.push(True)
+		} else {
+			err = v.push(False)
+		}
 	case code.OpNotEqual:
 		if leftValue == rightValue {
 			err = v.push(False)
@@ -430,6 +854,14 @@ func (v *VM) pop() (object.Object, error) {
 	return ret, nil
 }
 
+// pushNew pushes o, a value allocated by the VM, counting it on the meter.
+func (v *VM) pushNew(o object.Object) error {
+	if err := v.meter.Allocate(o); err != nil {
+		return err
+	}
+	return v.push(o)
+}
+
 func (v *VM) push(o object.Object) error {
 	if v.sp >= StackSize {
 		return fmt.Errorf("stack overflow")
@@ -1,11 +1,20 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"interpreter/ast"
+	"interpreter/diagnostic"
+	"interpreter/evaluator"
 	"interpreter/lexer"
+	"interpreter/module"
 	"interpreter/object"
+	"interpreter/optimizer"
 	"interpreter/parser"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"vm/compiler"
 )
@@ -60,8 +69,8 @@ func TestBooleanExpressions(t *testing.T) {
 		{"!!true", true},
 		{"!false", true},
 		{"!!false", false},
-		{"!!5", false},
-		{"!5", true},
+		{"!!5", true},
+		{"!5", false},
 		{"!(if(false){5;})", true},
 	}
 	runVmTests(t, tests)
@@ -323,29 +332,667 @@ func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
 	runVmTests(t, tests)
 }
 
-func runVmTests(t *testing.T, tests []vmTestCase) {
-	t.Helper()
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`puts("hello", "world!")`, Null},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`rest([1, 2, 3])`, []any{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []any{1}},
+		{`let apply = fn(f, x) { f(x) }; apply(len, [1, 2])`, 2},
+		{`json_parse("[1, true]")`, []any{1, true}},
+		{`json_parse(json_stringify({"a": [5]}))["a"][0]`, 5},
+		{`json_stringify({"b": [1, "x"], "a": json_parse("null")})`, `{"a":null,"b":[1,"x"]}`},
+	}
+	runVmTests(t, tests)
+}
 
-	for idx, tt := range tests {
-		program := parse(tt.input)
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+		let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+		countDown(10);
+		`, 0},
+		{`
+		let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		fib(15);
+		`, 610},
+		{`let a = 1; let a = a + 1; a`, 2},
+	}
+	runVmTests(t, tests)
+}
+
+func TestPrelude(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []any{2, 4, 6}},
+		{`filter(range(0, 6), fn(x) { x / 2 * 2 == x })`, []any{0, 2, 4}},
+		{`reduce([1, 2, 3], 10, fn(acc, x) { acc + x })`, 16},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, true},
+		{`all([1, 2, 3], fn(x) { x > 2 })`, false},
+		{`contains([1, 2, 3], 2)`, true},
+		{`reverse([1, 2, 3])`, []any{3, 2, 1}},
+		{`concat([1], [2, 3])`, []any{1, 2, 3}},
+		{`take([1, 2, 3], 2)`, []any{1, 2}},
+		{`drop([1, 2, 3], 2)`, []any{3}},
+		{`range(2, 5)`, []any{2, 3, 4}},
+		{`len(zip([1, 2, 3], ["a", "b"]))`, 2},
+		{`zip([1, 2, 3], ["a", "b"])[1]`, []any{2, "b"}},
+		{`sum(range(1, 101))`, 5050},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`let map = fn(x) { x }; map(5)`, 5},
+	}
+	runVmTests(t, tests)
+}
+
+func TestWithoutPrelude(t *testing.T) {
+	comp := compiler.NewCompiler(compiler.WithoutPrelude())
+	err := comp.Compile(parse(`sum([1, 2])`))
+	if err == nil {
+		t.Fatalf("expected compile error for prelude function without prelude")
+	}
+	if err.Error() != "identifier not found: sum" {
+		t.Errorf("wrong error. got=%q", err)
+	}
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{`fn add(a, b) { a + b }; add(1, 2)`, 3},
+		{`fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } } fact(5)`, 120},
+		{`let r = isEven(10); fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } } fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } } r`, true},
+		{`fn outer() { fn inner() { 41 } inner() + 1 } outer()`, 42},
+		{`fn outer() { let x = twice(2); fn twice(n) { n * 2 } x } outer()`, 4},
+		{`fn sum(a, b = 10, ...rest) { a + b + len(rest) } sum(1) + sum(1, 2, 3, 4)`, 16},
+		{`let f = 1; fn f() { 2 } f`, 1},
+		{`let f = fn() { fn g() { 1 } }; f()`, Null},
+		{`fn outer(n) { fn inner(k) { if (k == 0) { 0 } else { k + inner(k - 1) } } inner(n) } outer(100)`, 5050},
+		{`fn outer() { let fact = fn(k) { if (k < 2) { 1 } else { k * fact(k - 1) } }; fact(5) } outer()`, 120},
+		{`fn outer(n) { fn isEven(k) { if (k == 0) { true } else { isOdd(k - 1) } } fn isOdd(k) { if (k == 0) { false } else { isEven(k - 1) } } isOdd(n) } outer(7)`, true},
+		{`fn outer() { fn inc(x) { x + 1 } fn(x) { inc(x) } } outer()(1)`, 2},
+		{`fn outer() { fn loop(k) { if (k == 0) { "done" } else { loop(k - 1) } } loop(100000) } outer()`, "done"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestFunctionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn add(a, b) { a + b } add`, "CompiledFunction[add]"},
+		{`let id = fn(x) { x }; id`, "CompiledFunction[id]"},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler(compiler.WithoutPrelude())
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong inspect. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestOptimizedPrograms(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 + 2 * 3", 7},
+		{`"foo" + "bar"`, "foobar"},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (true) { let x = 5; x * 2 }", 10},
+		{"if (false) { 1 }; 5", 5},
+		{"let x = if (false) { 1 }; x", Null},
+		{"let f = fn() { if (true) { return 1; } 2 }; f()", 1},
+		{"let f = fn() { return 3; 4 }; f()", 3},
+		{"let f = fn() { return g(); fn g() { 7 } }; f()", 7},
+		{"let f = fn(n) { if (true) { n } }; f(4)", 4},
+		{`match (1 + 1) { 2 => "two", _ => "other" }`, "two"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []vmTestCase{
+		{`let loop = fn(n) { if (n == 0) { 0 } else { loop(n - 1) } }; loop(100000)`, 0},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(10000, 0)`, 50005000},
+		{`fn even(n) { if (n == 0) { true } else { odd(n - 1) } } fn odd(n) { if (n == 0) { false } else { even(n - 1) } } even(100001)`, false},
+		{`let count = fn(xs, n) { match (xs) { [] => n, [_, ...rest] => count(rest, n + 1) } }; count([1, 2, 3], 0)`, 3},
+		{`let size = fn(x) { len(x) }; size("abc")`, 3},
+		{`let depth = fn(n) { if (n == 0) { 0 } else { 1 + depth(n - 1) } }; depth(100)`, 100},
+		{`let apply = fn(f, x) { f(x) }; apply(fn(x) { x * 2 }, 21)`, 42},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStackOverflow(t *testing.T) {
+	input := `let depth = fn(n) { if (n == 0) { 0 } else { 1 + depth(n - 1) } }; depth(5000)`
+	comp := compiler.NewCompiler(compiler.WithoutPrelude())
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	err := NewVM(comp.ByteCode()).Run()
+	if err == nil || err.Error() != "stack overflow" {
+		t.Fatalf("expected stack overflow error. got=%v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected error // nil if the program must finish
+	}{
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(100)", object.Limits{MaxSteps: 100000, MaxCallDepth: 10, MaxAllocated: 100000}, nil},
+		{"let f = fn() { f() }; f()", object.Limits{MaxSteps: 10000}, object.ErrStepLimit},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", object.Limits{MaxCallDepth: 100}, object.ErrCallDepthLimit},
+		{"let f = fn(s) { f(s + s) }; f(\"ab\")", object.Limits{MaxAllocated: 1 << 20}, object.ErrAllocationLimit},
+		{"let f = fn(a) { f(push(a, 1)) }; f([])", object.Limits{MaxAllocated: 1 << 20}, object.ErrAllocationLimit},
+		{"let f = fn() { f() }; f()", object.Limits{Context: canceled}, object.ErrCanceled},
+		{"let f = fn() { f() }; f()", object.Limits{Context: canceled}, context.Canceled},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler(compiler.WithoutPrelude())
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := NewVM(comp.ByteCode())
+		vm.SetLimits(tt.limits)
+		err := vm.Run()
+		if !errors.Is(err, tt.expected) || (tt.expected == nil && err != nil) {
+			t.Errorf("%q stopped with the wrong error. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrorDiagnostic(t *testing.T) {
+	tests := []struct {
+		input    string
+		pos      string
+		expected []string // the notes
+	}{
+		{"1 + true", "1:3", nil},
+		{"let inner = fn() { -true }; let outer = fn() { 1 + inner() }; outer()", "1:20",
+			[]string{"in inner, called at 1:57", "in outer, called at 1:68"}},
+		{"fn(x) { x / 0 }(1)", "1:11", []string{"in an anonymous function, called at 1:16"}},
+		{"let f = fn(n) { if (n == 0) { 1 + true } else { 1 + f(n - 1) } }; f(20)", "1:33", []string{
+			"in f, called at 1:54", "in f, called at 1:54", "in f, called at 1:54", "in f, called at 1:54", "in f, called at 1:54",
+			"in f, called at 1:54", "in f, called at 1:54", "in f, called at 1:54", "in f, called at 1:54", "in f, called at 1:54",
+			"and 11 more calls",
+		}},
+		{`let xs = [1]; xs["a"]`, "1:17", nil},
+		{`len(1)`, "1:4", nil},
+		{"let [a, b] = [1];", "1:1", nil},
+		{"fn(a, b) { a }(1)", "1:15", nil},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler(compiler.WithoutPrelude())
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := NewVM(comp.ByteCode()).Run()
+		var d *diagnostic.Diagnostic
+		if !errors.As(err, &d) {
+			t.Errorf("%q: error is not a diagnostic. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+		if d.Code != diagnostic.Runtime || d.Message != err.Error() || d.Primary.Start.String() != tt.pos {
+			t.Errorf("%q: wrong diagnostic at %s: %s", tt.input, tt.pos, d)
+		}
+		if fmt.Sprint(d.Notes) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: wrong notes. want=%q, got=%q", tt.input, tt.expected, d.Notes)
+		}
+	}
+}
+
+func TestShortGlobals(t *testing.T) {
+	comp := compiler.NewCompiler(compiler.WithoutPrelude())
+	if err := comp.Compile(parse(`let a = 1; let b = 2; a + b`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	for _, globals := range [][]object.Object{nil, make([]object.Object, 1)} {
+		vm := NewVMWithGlobals(comp.ByteCode(), globals)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, 3, vm.LastPoppedStackElem())
+		if len(vm.Globals()) != GlobalSize {
+			t.Errorf("wrong number of globals. want=%d, got=%d", GlobalSize, len(vm.Globals()))
+		}
+	}
+}
+
+func TestIO(t *testing.T) {
+	input := `let name = read_line(); println("hello,", name); print(1, [2]); puts("", read_all())`
+	comp := compiler.NewCompiler(compiler.WithoutPrelude())
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out strings.Builder
+	vm := NewVM(comp.ByteCode())
+	vm.SetIO(object.NewIO(strings.NewReader("world\nrest"), &out))
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	expected := "hello, world\n1 [2]\nrest\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestFunctionParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(a, b = 2) { a + b }; f(1)`, 3},
+		{`let f = fn(a, b = 2) { a + b }; f(1, 5)`, 6},
+		{`let f = fn(a, b = a * 10, c = b + 1) { [a, b, c] }; f(1)`, []any{1, 10, 11}},
+		{`let f = fn(a, b = a * 10, c = b + 1) { [a, b, c] }; f(1, 2)`, []any{1, 2, 3}},
+		{`let f = fn(...xs) { xs }; f()`, []any{}},
+		{`let f = fn(...xs) { xs }; f(1, 2, 3)`, []any{1, 2, 3}},
+		{`let f = fn(a, ...xs) { len(xs) + a }; f(10, 1, 2)`, 12},
+		{`let f = fn(a, b = 5, ...xs) { [a, b, xs] }; let r = f(1); r[1] + len(r[2])`, 5},
+		{`let f = fn(a, b = 5, ...xs) { [a, b, xs] }; let r = f(1, 2, 3, 4); r[1] + len(r[2])`, 4},
+		{`let add = fn(...xs) { reduce(xs, 0, fn(acc, x) { acc + x }) }; add(1, 2, 3, 4)`, 10},
+		{`let f = fn(x = 1) { x }; let g = fn() { f() }; g()`, 1},
+		{`let k = 7; let f = fn(x = k) { x }; f()`, 7},
+		{`let count = fn(n, acc = 0) { if (n == 0) { acc } else { count(n - 1, acc + n) } }; count(4)`, 10},
+		{`let f = fn(a, b = 1) { let c = a + b; c * 2 }; f(1) + f(1, 2)`, 10},
+		// the bindings of a default come after the slots of the parameters
+		{`let f = fn(a, b = match (a) { x => x + 1 }) { [a, b] }; f(1, 5)`, []any{1, 5}},
+		{`let f = fn(a, b = match (a) { x => x + 1 }) { [a, b] }; f(1)`, []any{1, 2}},
+		{`let f = fn(a, b = match (a) { x => x }, ...r) { [b, r] }; f(1, 2, 3)`, []any{2, []any{3}}},
+		{`let f = fn(a, b = match (a) { x => x }, ...r) { [b, r] }; f(1)`, []any{1, []any{}}},
+	}
+	runVmTests(t, tests)
+}
+
+// TestBuiltinErrors checks that an error a builtin returns stops the
+// program, as it does in the evaluator.
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{"first(1)", "argument to `first` must be ARRAY, got INTEGER"},
+		{"push(1, 1)", "argument to `push` must be ARRAY, got INTEGER"},
+		{`json_parse("[1")`, "json_parse: unexpected end of JSON input at offset 2"},
+		{`json_parse("x"); puts(1); 2`, "json_parse: invalid character 'x' looking for beginning of value at offset 0"},
+		{`let f = fn(x) { let n = len(x); n + 1 }; f(1); 3`, "argument to `len` not supported, got INTEGER"},
+	}
+	for _, tt := range tests {
 		comp := compiler.NewCompiler()
-		err := comp.Compile(program)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		var out strings.Builder
+		vm := NewVM(comp.ByteCode())
+		vm.SetIO(object.NewIO(strings.NewReader(""), &out))
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%q: the program ran on after the error and printed %q", tt.input, out.String())
+		}
+	}
+}
+
+func TestFunctionArityErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a, b) { a }(1)`, "wrong number of arguments. got=1, want=2"},
+		{`fn(a) { a }(1, 2)`, "wrong number of arguments. got=2, want=1"},
+		{`fn(a, b = 1) { a }()`, "wrong number of arguments. got=0, want=1..2"},
+		{`fn(a, b = 1) { a }(1, 2, 3)`, "wrong number of arguments. got=3, want=1..2"},
+		{`fn(a, ...r) { a }()`, "wrong number of arguments. got=0, want>=1"},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler(compiler.WithoutPrelude())
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := NewVM(comp.ByteCode()).Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{`let [a, b] = [1, 2]; a + b`, 3},
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; rest`, []any{3, 4}},
+		{`let [a, ...rest] = [1]; rest`, []any{}},
+		{`let {name, age} = {"name": "monkey", "age": 3}; name`, "monkey"},
+		{`let {"first": f, "info": {age}} = {"first": "m", "info": {"age": 7}}; age`, 7},
+		{`let [a, [b, c]] = [1, [2, 3]]; a * b * c`, 6},
+		{`let [a, b = 10] = [1]; a + b`, 11},
+		{`let [a, b = a * 2] = [4]; b`, 8},
+		{`let [x = 1, y = 2] = []; x + y`, 3},
+		{`let {name, age = 30} = {"name": "m"}; age`, 30},
+		{`let {age = 30} = {"age": 5}; age`, 5},
+		{`let [_, second] = [1, 2]; second`, 2},
+		{`let f = fn(p) { let [x, y] = p; x * y }; f([3, 4])`, 12},
+		{`let f = fn(p) { let {x, y = 1} = p; x - y }; f({"x": 5}) + f({"x": 5, "y": 5})`, 4},
+		{`let a = 1; let [a, b] = [a + 1, a + 2]; a * b`, 6},
+		{`match ([1]) { [a, b = 5] => a + b }`, 6},
+		{`match ({}) { {x = 1} => x }`, 1},
+		{`match ([1, 2]) { [a, b = 5, c = 6] => a + b + c }`, 9},
+	}
+	runVmTests(t, tests)
+}
+
+func TestDestructuringLetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = [1];`, "pattern [a, b] does not match [1]"},
+		{`let [a] = [1, 2];`, "pattern [a] does not match [1, 2]"},
+		{`let {name} = [1];`, "pattern {name} does not match [1]"},
+		{`let {a} = {"b": 1};`, "pattern {a} does not match {b: 1}"},
+		{`let [a, [b]] = [1, 2];`, "pattern [a, [b]] does not match [1, 2]"},
+		{`let f = fn() { let [x] = 5; x }; f()`, "pattern [x] does not match 5"},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler(compiler.WithoutPrelude())
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		err := NewVM(comp.ByteCode()).Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []vmTestCase{
+		{`match (1) { 1 => "one", 2 => "two" }`, "one"},
+		{`match (3) { 1 => "one", _ => "other" }`, "other"},
+		{`match (3) { 1 => "one" }`, Null},
+		{`match ("a") { 1 => "int", "a" => "str" }`, "str"},
+		{`match (true) { false => 0, true => 1 }`, 1},
+		{`match (-1) { -1 => "neg", _ => "pos" }`, "neg"},
+		{`match (5) { x => x * 2 }`, 10},
+		{`match ([1, 2, 3]) { [a, b] => 0, [a, b, c] => a + b + c }`, 6},
+		{`match ([1, 2, 3]) { [first, ...rest] => rest }`, []any{2, 3}},
+		{`match ([]) { [x, ...r] => x, [] => -1 }`, -1},
+		{`match ([1]) { [_, ..._] => "non-empty" }`, "non-empty"},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a * b * c }`, 6},
+		{`match ({"name": "monkey", "age": 3}) { {"name": n, "age": 4} => n, {name, age} => name + "!" }`, "monkey!"},
+		{`match ({"a": 1}) { {"b": x} => x, {"a": [y]} => y, {"a": y} => y + 1 }`, 2},
+		{`match ({1: "x"}) { {1: v} => v }`, "x"},
+		{`match ({"a": 1}) { [a] => 1, {"a": a} if a == 1 => 2 }`, 2},
+		{`match (7) { x if x > 10 => "big", x if x > 5 => "medium", _ => "small" }`, "medium"},
+		{`match (fn(x) { x }) { 1 => 1, _ => 2 }`, 2},
+		{`match (1 + 1) { 2 => match ("x") { "x" => 20 } }`, 20},
+		{`let x = 1; match (2) { x => x }; x`, 1},
+		{`let f = fn(v) { match (v) { [h, ...t] => h + f(t), [] => 0 } }; f([1, 2, 3, 4])`, 10},
+		{`let g = fn(p) { let z = 3; match (p) { {x} => x + z, _ => z } }; g({"x": 4}) + g(1)`, 10},
+	}
+	runVmTests(t, tests)
+}
+
+func TestMacros(t *testing.T) {
+	tests := []vmTestCase{
+		{`let infix = macro() { quote(1 + 2) }; infix()`, 3},
+		{`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) }; reverse(2 + 2, 10 - 5)`, 1},
+		{`
+		let unless = macro(condition, consequence, alternative) {
+			quote(if (!(unquote(condition))) { unquote(consequence) } else { unquote(alternative) })
+		};
+		unless(10 > 5, "not greater", "greater")
+		`, "greater"},
+		{`
+		let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+		let f = fn(n) { twice(n * 2) };
+		f(3)
+		`, 12},
+		{`let square = macro(x) { let q = quote(unquote(x) * unquote(x)); q }; square(1 + 2)`, 9},
+		{`let k = macro() { quote(unquote(2 * 21)) }; k()`, 42},
+		{`let id = macro(x) { x }; map([1, 2], fn(x) { id(x + 1) })`, []any{2, 3}},
+	}
+
+	for _, tt := range tests {
+		vmResult := runWithMacros(t, tt.input)
+		testExpectedObject(t, tt.expected, vmResult)
+
+		program := parse(tt.input)
+		macroEnv := object.NewEnvironment()
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Fatalf("expand error: %s", err)
+		}
+		evalResult := evaluator.Eval(expanded, object.NewEnvironment())
+		if evalResult.Inspect() != vmResult.Inspect() {
+			t.Errorf("engines disagree on %q. evaluator=%s, vm=%s", tt.input, evalResult.Inspect(), vmResult.Inspect())
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1)`, "quote is only supported inside macros"},
+		{`let f = fn() { macro(x) { x } }; f()`, "macro literal is only allowed in a top-level let statement"},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewCompiler(compiler.WithoutPrelude())
+		err := comp.Compile(parse(tt.input))
+		if err == nil {
+			t.Errorf("expected compile error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func runWithMacros(t *testing.T, input string) object.Object {
+	t.Helper()
+	program := parse(input)
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	if _, err := evaluator.ExpandMacros(program, macroEnv); err != nil {
+		t.Fatalf("expand error: %s", err)
+	}
+	comp := compiler.NewCompiler()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := NewVM(comp.ByteCode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return vm.LastPoppedStackElem()
+}
+
+func TestImportExpression(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "lib/math.mk", `
+let square = fn(x) { x * x };
+export let cube = fn(x) { square(x) * x };
+export let answer = 42;
+`)
+	writeModule(t, dir, "lib/counter.mk", `export let id = import "./math.mk";`)
+	writeModule(t, dir, "vendor/greet.mk", `export let hello = fn(name) { "hello " + name };`)
+	writeModule(t, dir, "lib/parity.mk", `
+export fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+`)
+	writeModule(t, dir, "lib/macros.mk", `
+let double = macro(x) { quote(unquote(x) + unquote(x)) };
+export let twice = fn(n) { double(n) };
+`)
+
+	tests := []vmTestCase{
+		{`let m = import "lib/math.mk"; m["answer"]`, 42},
+		{`let m = import "lib/math"; m["cube"](3)`, 27},
+		{`let m = import "lib/math.mk"; m["square"]`, Null},
+		{`let b = import "lib/counter.mk"; b["id"]["cube"](2)`, 8},
+		{`let g = import "greet.mk"; g["hello"]("monkey")`, "hello monkey"},
+		{`let m = import "lib/macros.mk"; m["twice"](4)`, 8},
+		{`let p = import "lib/parity.mk"; if (p["isEven"](6)) { 1 } else { 0 }`, 1},
+		{`let answer = 1; let m = import "lib/math.mk"; let x = 2; answer + x + m["answer"]`, 45},
+		{`let load = fn() { import "lib/math.mk" }; load()["answer"] + load()["answer"]`, 84},
+	}
+	for _, tt := range tests {
+		loader := module.NewLoader(filepath.Join(dir, "vendor"))
+		comp := compiler.NewCompiler(compiler.WithLoader(loader, filepath.Join(dir, "main.mk")))
+		err := comp.Compile(parse(tt.input))
 		if err != nil {
 			t.Fatalf("compiler error:%s", err)
 		}
 		vm := NewVM(comp.ByteCode())
 		err = vm.Run()
 		if err != nil {
-			println("faild testcase ", idx)
-			println(comp.ByteCode().Instructions.String())
 			t.Fatalf("vm error: %s", err)
 		}
-		stackElem := vm.LastPoppedStackElem()
-		testExpectedObject(t, tt.expected, stackElem)
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+func TestImportEvaluatesModuleOnce(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "lib.mk", `export let items = [1, 2, 3];`)
+	input := `
+let load = fn() { import "lib.mk" };
+let a = load();
+let b = import "./lib.mk";
+[a, b]`
+	loader := module.NewLoader()
+	comp := compiler.NewCompiler(compiler.WithLoader(loader, filepath.Join(dir, "main.mk")))
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error:%s", err)
+	}
+	vm := NewVM(comp.ByteCode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	pair, ok := vm.LastPoppedStackElem().(*object.ArrayObject)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T", vm.LastPoppedStackElem())
+	}
+	if pair.Elements[0] != pair.Elements[1] {
+		t.Errorf("module evaluated more than once")
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "a.mk", `export let b = import "b.mk";`)
+	writeModule(t, dir, "b.mk", `export let a = import "a.mk";`)
+	comp := compiler.NewCompiler(compiler.WithLoader(module.NewLoader(), filepath.Join(dir, "main.mk")))
+	err := comp.Compile(parse(`import "a.mk"`))
+	if err == nil {
+		t.Fatalf("expected import cycle error")
+	}
+	a, b := filepath.Join(dir, "a.mk"), filepath.Join(dir, "b.mk")
+	expected := "import cycle: " + a + " -> " + b + " -> " + a
+	if err.Error() != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, err.Error())
+	}
+}
+
+func writeModule(t *testing.T, dir, name, source string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	// every program must give the same result with the optimizers and
+	// after a round trip through the .mkc format
+	configs := []struct {
+		opts      []compiler.Option
+		serialize bool
+	}{
+		{},
+		{opts: []compiler.Option{compiler.WithPeephole()}},
+		{opts: []compiler.Option{compiler.WithOptimizer(optimizer.All), compiler.WithPeephole()}},
+		{serialize: true},
+	}
+	for _, config := range configs {
+		for idx, tt := range tests {
+			program := parse(tt.input)
+			comp := compiler.NewCompiler(config.opts...)
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error:%s", err)
+			}
+			bytecode := comp.ByteCode()
+			if config.serialize {
+				bytecode = roundTrip(t, bytecode)
+			}
+			vm, err := NewVerifiedVM(bytecode)
+			if err != nil {
+				t.Fatalf("%q: %s\n%s", tt.input, err, bytecode.Instructions)
+			}
+			err = vm.Run()
+			if err != nil {
+				println("faild testcase ", idx)
+				println(bytecode.Instructions.String())
+				t.Fatalf("vm error: %s", err)
+			}
+			stackElem := vm.LastPoppedStackElem()
+			testExpectedObject(t, tt.expected, stackElem)
+		}
 	}
 
 }
 
+// roundTrip encodes and decodes bytecode.
+func roundTrip(t *testing.T, bytecode *compiler.ByteCode) *compiler.ByteCode {
+	t.Helper()
+	data, err := bytecode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("cannot serialize bytecode: %s", err)
+	}
+	decoded := &compiler.ByteCode{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("cannot deserialize bytecode: %s", err)
+	}
+	return decoded
+}
+
 func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 	t.Helper()
 	switch expected := expected.(type) {
@@ -378,6 +1025,15 @@ func testExpectedObject(t *testing.T, expected any, actual object.Object) {
 		if actual != Null {
 			t.Errorf("object is not Null:%T %+v)", actual, actual)
 		}
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%q, got=%q", expected.Message, errObj.Message)
+		}
 
 	}
 }
@@ -409,6 +1065,11 @@ func testArrayObject(expecteds []any, actual object.Object) error {
 	}
 	for i, o := range arr.Elements {
 		switch expected := expecteds[i].(type) {
+		case int:
+			err := testIntegerObject(int64(expected), o)
+			if err != nil {
+				return err
+			}
 		case int64:
 			err := testIntegerObject(expected, o)
 			if err != nil {